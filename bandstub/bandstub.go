@@ -0,0 +1,321 @@
+// Package bandstub is a local stand-in for the parts of the BandChain REST API that the feeder uses.
+// It is meant to be served with net/http/httptest so that the feeder can be tested without BandChain.
+package bandstub
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OracleScript struct {
+	Schema string
+	// Result is the OBI encoded result of every request to this oracle script.
+	Result []byte
+}
+
+type request struct {
+	ID             uint64
+	OracleScriptID uint64
+	Calldata       []byte
+	AskCount       uint64
+	MinCount       uint64
+	ClientID       string
+	CreatedAt      time.Time
+}
+
+// Server serves the BandChain REST API from memory.
+type Server struct {
+	// ResolveDelay is how long a submitted request takes to be resolved. A negative delay means never.
+	ResolveDelay time.Duration
+	// TxCode is the code returned for every broadcast transaction. Non-zero codes do not create requests.
+	TxCode uint32
+
+	mtx           sync.Mutex
+	oracleScripts map[uint64]OracleScript
+	requests      map[uint64]*request
+	sequences     map[string]uint64
+	nextID        uint64
+	mux           *http.ServeMux
+}
+
+func NewServer() *Server {
+	s := &Server{
+		oracleScripts: map[uint64]OracleScript{},
+		requests:      map[uint64]*request{},
+		sequences:     map[string]uint64{},
+		nextID:        1,
+		mux:           http.NewServeMux(),
+	}
+	s.mux.HandleFunc("/oracle/oracle_scripts/", s.handleOracleScript)
+	s.mux.HandleFunc("/oracle/request_search", s.handleRequestSearch)
+	s.mux.HandleFunc("/oracle/requests/", s.handleRequest)
+	s.mux.HandleFunc("/auth/accounts/", s.handleAccount)
+	s.mux.HandleFunc("/txs", s.handleTxs)
+	return s
+}
+
+// SetOracleScript registers the schema and the result of an oracle script.
+func (s *Server) SetOracleScript(id uint64, schema string, result []byte) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	s.oracleScripts[id] = OracleScript{Schema: schema, Result: result}
+}
+
+// Requests returns the number of requests submitted through /txs.
+func (s *Server) Requests() int {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	return len(s.requests)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"height": "1", "result": result})
+}
+
+func writeError(w http.ResponseWriter, status int, err string) {
+	writeJSON(w, status, map[string]string{"error": err})
+}
+
+func idFromPath(path string, prefix string) (uint64, error) {
+	return strconv.ParseUint(strings.TrimPrefix(path, prefix), 10, 64)
+}
+
+func (s *Server) handleOracleScript(w http.ResponseWriter, r *http.Request) {
+	id, err := idFromPath(r.URL.Path, "/oracle/oracle_scripts/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mtx.Lock()
+	os, ok := s.oracleScripts[id]
+	s.mtx.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("oracle script %d not found", id))
+		return
+	}
+
+	writeResult(w, map[string]interface{}{
+		"owner":           "band1stub",
+		"name":            fmt.Sprintf("oracle script %d", id),
+		"description":     "",
+		"filename":        "",
+		"schema":          os.Schema,
+		"source_code_url": "",
+	})
+}
+
+// bandResult renders a request in the shape of the request_search and requests endpoints.
+// The response packet is only filled once the request is resolved.
+func (s *Server) bandResult(req *request, resolved bool) map[string]interface{} {
+	result := map[string]interface{}{
+		"request": map[string]interface{}{
+			"oracle_script_id": strconv.FormatUint(req.OracleScriptID, 10),
+			"calldata":         req.Calldata,
+			"min_count":        strconv.FormatUint(req.MinCount, 10),
+			"request_height":   "1",
+			"request_time":     req.CreatedAt,
+			"client_id":        req.ClientID,
+		},
+		"reports": []interface{}{},
+		"result":  nil,
+	}
+	if !resolved {
+		return result
+	}
+
+	result["result"] = map[string]interface{}{
+		"request_packet_data": map[string]interface{}{
+			"client_id":        req.ClientID,
+			"oracle_script_id": strconv.FormatUint(req.OracleScriptID, 10),
+			"calldata":         req.Calldata,
+			"ask_count":        strconv.FormatUint(req.AskCount, 10),
+			"min_count":        strconv.FormatUint(req.MinCount, 10),
+		},
+		"response_packet_data": map[string]interface{}{
+			"client_id":      req.ClientID,
+			"request_id":     strconv.FormatUint(req.ID, 10),
+			"ans_count":      strconv.FormatUint(req.AskCount, 10),
+			"request_time":   strconv.FormatInt(req.CreatedAt.Unix(), 10),
+			"resolve_time":   strconv.FormatInt(req.CreatedAt.Add(s.ResolveDelay).Unix(), 10),
+			"resolve_status": 1,
+			"result":         s.oracleScripts[req.OracleScriptID].Result,
+		},
+	}
+	return result
+}
+
+func (s *Server) handleRequestSearch(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	oid, err := strconv.ParseUint(q.Get("oid"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	minCount, _ := strconv.ParseUint(q.Get("min_count"), 10, 64)
+	askCount, _ := strconv.ParseUint(q.Get("ask_count"), 10, 64)
+	calldata, err := hex.DecodeString(q.Get("calldata"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if _, ok := s.oracleScripts[oid]; !ok {
+		writeError(w, http.StatusNotFound, "request with specified specification not found")
+		return
+	}
+
+	// Searching always finds an old, already resolved request.
+	req := &request{
+		OracleScriptID: oid,
+		Calldata:       calldata,
+		AskCount:       askCount,
+		MinCount:       minCount,
+		ClientID:       "search",
+		CreatedAt:      time.Now().Add(-time.Hour),
+	}
+	writeResult(w, s.bandResult(req, true))
+}
+
+func (s *Server) handleRequest(w http.ResponseWriter, r *http.Request) {
+	id, err := idFromPath(r.URL.Path, "/oracle/requests/")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	req, ok := s.requests[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("request %d not found", id))
+		return
+	}
+
+	resolved := s.ResolveDelay >= 0 && time.Since(req.CreatedAt) >= s.ResolveDelay
+	writeResult(w, s.bandResult(req, resolved))
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request) {
+	address := strings.TrimPrefix(r.URL.Path, "/auth/accounts/")
+
+	s.mtx.Lock()
+	sequence := s.sequences[address]
+	s.mtx.Unlock()
+
+	writeResult(w, map[string]interface{}{
+		"type": "cosmos-sdk/Account",
+		"value": map[string]interface{}{
+			"address":        address,
+			"coins":          []interface{}{},
+			"public_key":     nil,
+			"account_number": "1",
+			"sequence":       strconv.FormatUint(sequence, 10),
+		},
+	})
+}
+
+type msgRequestData struct {
+	OracleScriptID uint64 `json:"oracle_script_id,string"`
+	Calldata       []byte `json:"calldata"`
+	AskCount       uint64 `json:"ask_count,string"`
+	MinCount       uint64 `json:"min_count,string"`
+	ClientID       string `json:"client_id"`
+	Sender         string `json:"sender"`
+}
+
+type broadcastReq struct {
+	Tx struct {
+		Msg []struct {
+			Type  string         `json:"type"`
+			Value msgRequestData `json:"value"`
+		} `json:"msg"`
+	} `json:"tx"`
+	Mode string `json:"mode"`
+}
+
+func (s *Server) handleTxs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+
+	var req broadcastReq
+	err := json.NewDecoder(r.Body).Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	txHash := fmt.Sprintf("%064X", s.nextID)
+	if s.TxCode != 0 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"height": "1", "txhash": txHash, "code": s.TxCode, "raw_log": "stub failure",
+		})
+		return
+	}
+
+	logs := []interface{}{}
+	for idx, msg := range req.Tx.Msg {
+		if msg.Type != "oracle/Request" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("unsupported msg type %s", msg.Type))
+			return
+		}
+		if _, ok := s.oracleScripts[msg.Value.OracleScriptID]; !ok {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("oracle script %d not found", msg.Value.OracleScriptID))
+			return
+		}
+
+		id := s.nextID
+		s.nextID++
+		s.requests[id] = &request{
+			ID:             id,
+			OracleScriptID: msg.Value.OracleScriptID,
+			Calldata:       msg.Value.Calldata,
+			AskCount:       msg.Value.AskCount,
+			MinCount:       msg.Value.MinCount,
+			ClientID:       msg.Value.ClientID,
+			CreatedAt:      time.Now(),
+		}
+		s.sequences[msg.Value.Sender]++
+
+		logs = append(logs, map[string]interface{}{
+			"msg_index": idx,
+			"events": []interface{}{
+				map[string]interface{}{
+					"type":       "request",
+					"attributes": []interface{}{map[string]string{"key": "id", "value": strconv.FormatUint(id, 10)}},
+				},
+			},
+		})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"height": "1", "txhash": txHash, "code": 0, "raw_log": "", "logs": logs,
+	})
+}
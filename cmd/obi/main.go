@@ -0,0 +1,136 @@
+// Command obi converts between OBI encoded bytes and JSON.
+//
+//	echo 000000044c554e4100000000000f4240 | obi decode --schema "{symbol:string,multiplier:u64}"
+//	echo '{"symbol":"LUNA","multiplier":1000000}' | obi encode --schema "{symbol:string,multiplier:u64}"
+//
+// An oracle script schema such as "{symbol:string}/{px:u64}" can be given together with --part.
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: obi encode|decode --schema <schema> [--part input|output] [--format hex|base64]")
+	fmt.Fprintln(os.Stderr, "  encode reads JSON from stdin and writes the OBI bytes")
+	fmt.Fprintln(os.Stderr, "  decode reads OBI bytes from stdin and writes JSON")
+}
+
+func pickSchema(schema string, part string) (string, error) {
+	if !strings.Contains(schema, "/") {
+		if part != "" {
+			return "", fmt.Errorf("--part is only for oracle script schemas")
+		}
+		return schema, nil
+	}
+	input, output, err := obi.ParseOracleScriptSchema(schema)
+	if err != nil {
+		return "", err
+	}
+	switch part {
+	case "input":
+		return input.String(), nil
+	case "output":
+		return output.String(), nil
+	default:
+		return "", fmt.Errorf("--part must be input or output for an oracle script schema")
+	}
+}
+
+func parseBytes(s string, format string) ([]byte, error) {
+	s = strings.TrimSpace(s)
+	switch format {
+	case "hex":
+		return hex.DecodeString(strings.TrimPrefix(s, "0x"))
+	case "base64":
+		return base64.StdEncoding.DecodeString(s)
+	default:
+		return nil, fmt.Errorf("unknown format %s", format)
+	}
+}
+
+func formatBytes(bz []byte, format string) (string, error) {
+	switch format {
+	case "hex":
+		return hex.EncodeToString(bz), nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString(bz), nil
+	default:
+		return "", fmt.Errorf("unknown format %s", format)
+	}
+}
+
+// run runs the command in args, reading its input from stdin and writing its output to stdout.
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) < 1 {
+		usage()
+		return fmt.Errorf("missing command")
+	}
+	if args[0] != "encode" && args[0] != "decode" {
+		usage()
+		return fmt.Errorf("unknown command %s", args[0])
+	}
+
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	schema := fs.String("schema", "", "OBI schema, or oracle script schema together with --part")
+	part := fs.String("part", "", "input or output part of an oracle script schema")
+	format := fs.String("format", "hex", "hex or base64 for the OBI bytes")
+	err := fs.Parse(args[1:])
+	if err != nil {
+		return err
+	}
+	if *schema == "" {
+		return fmt.Errorf("--schema is required")
+	}
+
+	s, err := pickSchema(*schema, *part)
+	if err != nil {
+		return err
+	}
+
+	in, err := ioutil.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "encode":
+		bz, err := obi.FromJSON(s, in)
+		if err != nil {
+			return err
+		}
+		out, err := formatBytes(bz, *format)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, out)
+	case "decode":
+		bz, err := parseBytes(string(in), *format)
+		if err != nil {
+			return err
+		}
+		out, err := obi.ToJSON(s, bz)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(stdout, string(out))
+	}
+	return nil
+}
+
+func main() {
+	err := run(os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const lunaSchema = "{symbol:string,multiplier:u64}"
+
+// unreadable is a stdin that fails the test when it is read.
+type unreadable struct{ t *testing.T }
+
+func (r unreadable) Read(p []byte) (int, error) {
+	r.t.Fatal("stdin was read")
+	return 0, nil
+}
+
+func runWith(stdin string, args ...string) (string, error) {
+	out := &bytes.Buffer{}
+	err := run(args, strings.NewReader(stdin), out)
+	return out.String(), err
+}
+
+func TestEncodeDecode(t *testing.T) {
+	testCases := []struct {
+		args []string
+		json string
+		obi  string
+	}{
+		{[]string{"--schema", lunaSchema}, `{"symbol":"LUNA","multiplier":1000000}`, "000000044c554e4100000000000f4240"},
+		{[]string{"--schema", lunaSchema, "--format", "base64"}, `{"symbol":"LUNA","multiplier":1000000}`, "AAAABExVTkEAAAAAAA9CQA=="},
+		{[]string{"--schema", lunaSchema + "/{px:u64}", "--part", "input"}, `{"symbol":"LUNA","multiplier":1000000}`, "000000044c554e4100000000000f4240"},
+		{[]string{"--schema", lunaSchema + "/{px:u64}", "--part", "output"}, `{"px":5}`, "0000000000000005"},
+	}
+	for _, tc := range testCases {
+		out, err := runWith(tc.json, append([]string{"encode"}, tc.args...)...)
+		if err != nil || out != tc.obi+"\n" {
+			t.Errorf("encode %v of %s = %q, %v, want %s", tc.args, tc.json, out, err, tc.obi)
+		}
+		out, err = runWith(tc.obi+"\n", append([]string{"decode"}, tc.args...)...)
+		if err != nil || out != tc.json+"\n" {
+			t.Errorf("decode %v of %s = %q, %v, want %s", tc.args, tc.obi, out, err, tc.json)
+		}
+	}
+
+	out, err := runWith("0x0000000000000005", "decode", "--schema", "u64")
+	if err != nil || out != "5\n" {
+		t.Errorf("decode of 0x prefixed hex = %q, %v", out, err)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	testCases := []struct {
+		args  []string
+		stdin string
+		err   string
+	}{
+		{[]string{"encode"}, "1", "--schema is required"},
+		{[]string{"encode", "--schema", "u64", "--part", "input"}, "1", "--part is only for oracle script schemas"},
+		{[]string{"encode", "--schema", "u64/u64"}, "1", "--part must be input or output"},
+		{[]string{"encode", "--schema", "{a:u64"}, "1", "obi: invalid schema"},
+		{[]string{"encode", "--schema", "u64"}, `"x"`, "is not an integer"},
+		{[]string{"encode", "--schema", "u64", "--format", "base32"}, "1", "unknown format base32"},
+		{[]string{"decode", "--schema", "u64", "--format", "base32"}, "00", "unknown format base32"},
+		{[]string{"decode", "--schema", "u64"}, "zz", "invalid byte"},
+		{[]string{"decode", "--schema", "u64"}, "0001", "obi: cannot decode u64"},
+		{[]string{"decode", "--schema", "u64", "--unknown"}, "00", "flag provided but not defined"},
+	}
+	for _, tc := range testCases {
+		_, err := runWith(tc.stdin, tc.args...)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("run %v returned %v, want %q", tc.args, err, tc.err)
+		}
+	}
+}
+
+func TestUnknownCommandDoesNotReadStdin(t *testing.T) {
+	for _, args := range [][]string{nil, {"convert", "--schema", "u64"}} {
+		err := run(args, unreadable{t}, &bytes.Buffer{})
+		if err == nil {
+			t.Errorf("run %v returned no error", args)
+		}
+	}
+}
@@ -0,0 +1,656 @@
+// Command obigen generates OBISchema, MarshalOBI, AppendOBI and UnmarshalOBI methods for Go structs,
+// so they are encoded without reflection.
+//
+//	//go:generate go run ../cmd/obigen -type LunaPriceCallData,FxPriceCallData
+//
+// reads the named struct types from the Go files of the current directory. Fields are encoded in
+// declaration order and must be tagged with their OBI name like `obi:"symbol"`. Fields of types of
+// the package that implement their own OBISchema, MarshalOBI and UnmarshalOBI methods are encoded by
+// calling them. Only fields of types of other packages are encoded with the reflection path of the
+// obi package.
+//
+//	obigen -schema "{symbol:string,multiplier:u64}" -name CallData -package main
+//
+// generates the struct types of an OBI schema together with their methods.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+const OBI_IMPORT = "github.com/bandprotocol/band-terra-oracle/obi"
+
+var primitives = map[string]string{
+	"uint8":  "Unsigned8",
+	"byte":   "Unsigned8",
+	"uint16": "Unsigned16",
+	"uint32": "Unsigned32",
+	"uint64": "Unsigned64",
+	"int8":   "Signed8",
+	"int16":  "Signed16",
+	"int32":  "Signed32",
+	"int64":  "Signed64",
+}
+
+var primitiveSchemas = map[string]string{
+	"uint8":  "u8",
+	"byte":   "u8",
+	"uint16": "u16",
+	"uint32": "u32",
+	"uint64": "u64",
+	"int8":   "i8",
+	"int16":  "i16",
+	"int32":  "i32",
+	"int64":  "i64",
+	"string": "string",
+	"bool":   "bool",
+}
+
+// genType is a Go type the generator knows how to encode.
+type genType struct {
+	// Kind is one of primitive, string, bool, bytes, slice, array, option, map, struct, marshaler
+	// or fallback.
+	Kind   string
+	GoType string
+	// Base is the predeclared type of a primitive, string, bool or bytes GoType, which differs from
+	// GoType for a named type.
+	Base string
+	Key  *genType
+	Elem *genType
+	Len  string
+	// Append is set for a marshaler that also implements AppendOBI.
+	Append bool
+}
+
+type field struct {
+	Name string
+	Tag  string
+	Type *genType
+}
+
+type generator struct {
+	structs map[string]*ast.StructType
+	// named holds the underlying types of the types declared in the package, and methods the names
+	// of their methods.
+	named     map[string]ast.Expr
+	methods   map[string]map[string]bool
+	resolving map[string]bool
+	targets   map[string]bool
+	buf       bytes.Buffer
+	temps     int
+	usesErr   bool
+}
+
+// temp returns a new name for a local variable of the generated code.
+func (g *generator) temp(prefix string) string {
+	g.temps++
+	return fmt.Sprintf("%s%d", prefix, g.temps)
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+func (g *generator) resolve(expr ast.Expr) (*genType, error) {
+	goType := types.ExprString(expr)
+	switch t := expr.(type) {
+	case *ast.Ident:
+		if _, ok := primitives[t.Name]; ok {
+			return &genType{Kind: "primitive", GoType: goType, Base: goType}, nil
+		}
+		switch t.Name {
+		case "string", "bool":
+			return &genType{Kind: t.Name, GoType: goType, Base: goType}, nil
+		case "int", "uint", "uintptr", "float32", "float64", "complex64", "complex128", "rune":
+			return nil, fmt.Errorf("%s is not supported by obi", t.Name)
+		}
+		if g.targets[t.Name] {
+			return &genType{Kind: "struct", GoType: goType}, nil
+		}
+		methods := g.methods[t.Name]
+		if methods["OBISchema"] && methods["MarshalOBI"] && methods["UnmarshalOBI"] {
+			return &genType{Kind: "marshaler", GoType: goType, Append: methods["AppendOBI"]}, nil
+		}
+		underlying, ok := g.named[t.Name]
+		if !ok {
+			return &genType{Kind: "fallback", GoType: goType}, nil
+		}
+		if _, ok := underlying.(*ast.StructType); ok {
+			return nil, fmt.Errorf("struct type %s must be generated too", t.Name)
+		}
+		if g.resolving[t.Name] {
+			return nil, fmt.Errorf("recursive type %s is not supported", t.Name)
+		}
+		g.resolving[t.Name] = true
+		defer delete(g.resolving, t.Name)
+		res, err := g.resolve(underlying)
+		if err != nil {
+			return nil, err
+		}
+		named := *res
+		named.GoType = goType
+		return &named, nil
+	case *ast.ArrayType:
+		elem, err := g.resolve(t.Elt)
+		if err != nil {
+			return nil, err
+		}
+		if t.Len == nil {
+			if elem.Base == "byte" || elem.Base == "uint8" {
+				return &genType{Kind: "bytes", GoType: goType, Base: "[]byte"}, nil
+			}
+			return &genType{Kind: "slice", GoType: goType, Elem: elem}, nil
+		}
+		lit, ok := t.Len.(*ast.BasicLit)
+		if !ok || lit.Kind != token.INT {
+			return nil, fmt.Errorf("array length of %s must be an integer literal", goType)
+		}
+		return &genType{Kind: "array", GoType: goType, Elem: elem, Len: lit.Value}, nil
+	case *ast.StarExpr:
+		elem, err := g.resolve(t.X)
+		if err != nil {
+			return nil, err
+		}
+		return &genType{Kind: "option", GoType: goType, Elem: elem}, nil
+	case *ast.MapType:
+		key, err := g.resolve(t.Key)
+		if err != nil {
+			return nil, err
+		}
+		elem, err := g.resolve(t.Value)
+		if err != nil {
+			return nil, err
+		}
+		return &genType{Kind: "map", GoType: goType, Key: key, Elem: elem}, nil
+	case *ast.SelectorExpr:
+		return &genType{Kind: "fallback", GoType: goType}, nil
+	default:
+		return nil, fmt.Errorf("unsupported type %s", goType)
+	}
+}
+
+func (g *generator) fields(name string) ([]field, error) {
+	st := g.structs[name]
+	fields := []field{}
+	for _, f := range st.Fields.List {
+		if len(f.Names) == 0 {
+			return nil, fmt.Errorf("embedded field %s of %s is not supported", types.ExprString(f.Type), name)
+		}
+		tag := ""
+		if f.Tag != nil {
+			raw, err := strconv.Unquote(f.Tag.Value)
+			if err != nil {
+				return nil, err
+			}
+			tag = reflect.StructTag(raw).Get("obi")
+		}
+		if tag == "-" {
+			continue
+		}
+		t, err := g.resolve(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("field %s of %s: %v", f.Names[0].Name, name, err)
+		}
+		for _, ident := range f.Names {
+			if tag == "" {
+				return nil, fmt.Errorf("field %s of %s must be tagged with its obi name or `obi:\"-\"`", ident.Name, name)
+			}
+			if !ident.IsExported() {
+				return nil, fmt.Errorf("unexported field %s of %s cannot be encoded", ident.Name, name)
+			}
+			fields = append(fields, field{Name: ident.Name, Tag: tag, Type: t})
+		}
+	}
+	return fields, nil
+}
+
+// schemaParts returns the parts of the Go expression building the schema of t.
+func schemaParts(t *genType) []string {
+	switch t.Kind {
+	case "primitive", "string", "bool":
+		return []string{strconv.Quote(primitiveSchemas[t.Base])}
+	case "bytes":
+		return []string{`"bytes"`}
+	case "slice":
+		return append(append([]string{`"["`}, schemaParts(t.Elem)...), `"]"`)
+	case "array":
+		return append(append([]string{`"["`}, schemaParts(t.Elem)...), strconv.Quote(";"+t.Len+"]"))
+	case "option":
+		return append(append([]string{`"option<"`}, schemaParts(t.Elem)...), `">"`)
+	case "map":
+		parts := append(append([]string{`"map<"`}, schemaParts(t.Key)...), `","`)
+		return append(append(parts, schemaParts(t.Elem)...), `">"`)
+	case "struct":
+		return []string{fmt.Sprintf("%s{}.OBISchema()", t.GoType)}
+	case "marshaler":
+		return []string{fmt.Sprintf("new(%s).OBISchema()", t.GoType)}
+	default:
+		return []string{fmt.Sprintf("obi.MustGetSchema(*new(%s))", t.GoType)}
+	}
+}
+
+// joinParts concatenates the schema parts, merging neighbouring string literals.
+func joinParts(parts []string) string {
+	merged := []string{}
+	for _, part := range parts {
+		if len(merged) != 0 && strings.HasPrefix(part, `"`) && strings.HasPrefix(merged[len(merged)-1], `"`) {
+			prev, _ := strconv.Unquote(merged[len(merged)-1])
+			curr, _ := strconv.Unquote(part)
+			merged[len(merged)-1] = strconv.Quote(prev + curr)
+			continue
+		}
+		merged = append(merged, part)
+	}
+	return strings.Join(merged, " + ")
+}
+
+// encode generates the code appending the encoding of x of type t to the buffer named dst.
+func (g *generator) encode(dst string, x string, t *genType) {
+	switch t.Kind {
+	case "primitive":
+		switch primitives[t.Base] {
+		case "Unsigned8", "Signed8":
+			g.printf("%s = append(%s, byte(%s))\n", dst, dst, x)
+		case "Unsigned16", "Signed16":
+			g.printf("%s = binary.BigEndian.AppendUint16(%s, uint16(%s))\n", dst, dst, x)
+		case "Unsigned32", "Signed32":
+			g.printf("%s = binary.BigEndian.AppendUint32(%s, uint32(%s))\n", dst, dst, x)
+		default:
+			g.printf("%s = binary.BigEndian.AppendUint64(%s, uint64(%s))\n", dst, dst, x)
+		}
+	case "string", "bytes":
+		g.printf("%s = binary.BigEndian.AppendUint32(%s, uint32(len(%s)))\n", dst, dst, x)
+		g.printf("%s = append(%s, %s...)\n", dst, dst, x)
+	case "bool":
+		g.printf("if %s {\n%s = append(%s, 1)\n} else {\n%s = append(%s, 0)\n}\n", x, dst, dst, dst, dst)
+	case "slice":
+		g.printf("%s = binary.BigEndian.AppendUint32(%s, uint32(len(%s)))\n", dst, dst, x)
+		idx := g.temp("i")
+		g.printf("for %s := range %s {\n", idx, x)
+		g.encode(dst, fmt.Sprintf("%s[%s]", x, idx), t.Elem)
+		g.printf("}\n")
+	case "array":
+		idx := g.temp("i")
+		g.printf("for %s := range %s {\n", idx, x)
+		g.encode(dst, fmt.Sprintf("%s[%s]", x, idx), t.Elem)
+		g.printf("}\n")
+	case "option":
+		g.printf("if %s == nil {\n%s = append(%s, 0)\n} else {\n%s = append(%s, 1)\n", x, dst, dst, dst, dst)
+		g.encode(dst, "(*"+x+")", t.Elem)
+		g.printf("}\n")
+	case "map":
+		g.usesErr = true
+		entries := g.temp("entries")
+		key, value := g.temp("k"), g.temp("v")
+		kb, vb := g.temp("kb"), g.temp("vb")
+		g.printf("%s := make([]obi.EncodedEntry, 0, len(%s))\n", entries, x)
+		g.printf("for %s, %s := range %s {\nvar %s, %s []byte\n", key, value, x, kb, vb)
+		g.encode(kb, key, t.Key)
+		g.encode(vb, value, t.Elem)
+		g.printf("%s = append(%s, obi.EncodedEntry{Key: %s, Value: %s})\n}\n", entries, entries, kb, vb)
+		g.printf("%s, err = obi.AppendEntries(%s, %s)\nif err != nil {\nreturn nil, err\n}\n", dst, dst, entries)
+	case "struct":
+		g.usesErr = true
+		g.printf("%s, err = %s.AppendOBI(%s)\nif err != nil {\nreturn nil, err\n}\n", dst, x, dst)
+	case "marshaler":
+		g.usesErr = true
+		if t.Append {
+			g.printf("%s, err = %s.AppendOBI(%s)\nif err != nil {\nreturn nil, err\n}\n", dst, x, dst)
+			return
+		}
+		bz := g.temp("bz")
+		g.printf("var %s []byte\n%s, err = %s.MarshalOBI()\nif err != nil {\nreturn nil, err\n}\n", bz, bz, x)
+		g.printf("%s = append(%s, %s...)\n", dst, dst, bz)
+	default:
+		g.usesErr = true
+		bz := g.temp("bz")
+		g.printf("var %s []byte\n%s, err = obi.Encode(%s)\nif err != nil {\nreturn nil, err\n}\n", bz, bz, x)
+		g.printf("%s = append(%s, %s...)\n", dst, dst, bz)
+	}
+}
+
+// decode generates the code decoding x of type t from the front of rem.
+func (g *generator) decode(x string, t *genType) {
+	g.usesErr = true
+	switch t.Kind {
+	case "primitive", "string", "bool", "bytes":
+		fn := map[string]string{"string": "String", "bool": "Bool", "bytes": "Bytes"}[t.Kind]
+		if fn == "" {
+			fn = primitives[t.Base]
+		}
+		if t.GoType == t.Base {
+			g.printf("%s, rem, err = obi.Decode%s(rem)\nif err != nil {\nreturn nil, err\n}\n", x, fn)
+			return
+		}
+		// A named type is converted from its predeclared type.
+		val := g.temp("val")
+		g.printf("var %s %s\n%s, rem, err = obi.Decode%s(rem)\nif err != nil {\nreturn nil, err\n}\n", val, t.Base, val, fn)
+		g.printf("%s = %s(%s)\n", x, t.GoType, val)
+	case "slice":
+		n := g.temp("n")
+		idx := g.temp("i")
+		g.printf("var %s int\n%s, rem, err = obi.DecodeLength(rem)\nif err != nil {\nreturn nil, err\n}\n", n, n)
+		g.printf("%s = make(%s, %s)\n", x, t.GoType, n)
+		g.printf("for %s := range %s {\n", idx, x)
+		g.decode(fmt.Sprintf("%s[%s]", x, idx), t.Elem)
+		g.printf("}\n")
+	case "array":
+		idx := g.temp("i")
+		g.printf("for %s := range %s {\n", idx, x)
+		g.decode(fmt.Sprintf("%s[%s]", x, idx), t.Elem)
+		g.printf("}\n")
+	case "option":
+		present := g.temp("present")
+		g.printf("var %s bool\n%s, rem, err = obi.DecodeBool(rem)\nif err != nil {\nreturn nil, err\n}\n", present, present)
+		g.printf("if %s {\n%s = new(%s)\n", present, x, strings.TrimPrefix(t.GoType, "*"))
+		g.decode("(*"+x+")", t.Elem)
+		g.printf("} else {\n%s = nil\n}\n", x)
+	case "map":
+		n, idx := g.temp("n"), g.temp("i")
+		key, value := g.temp("k"), g.temp("v")
+		start, prev := g.temp("start"), g.temp("prev")
+		g.printf("var %s int\n%s, rem, err = obi.DecodeLength(rem)\nif err != nil {\nreturn nil, err\n}\n", n, n)
+		g.printf("%s = make(%s, %s)\nvar %s []byte\n", x, t.GoType, n, prev)
+		g.printf("for %s := 0; %s < %s; %s++ {\nvar %s %s\nvar %s %s\n%s := rem\n", idx, idx, n, idx, key, t.Key.GoType, value, t.Elem.GoType, start)
+		g.decode(key, t.Key)
+		// The keys must be sorted by their encoding like the reflection path checks.
+		g.printf("if %s != nil && bytes.Compare(%s, %s[:len(%s)-len(rem)]) >= 0 {\nreturn nil, obi.ErrUnsortedMapKeys\n}\n", prev, prev, start, start)
+		g.printf("%s = %s[:len(%s)-len(rem)]\n", prev, start, start)
+		g.decode(value, t.Elem)
+		g.printf("%s[%s] = %s\n}\n", x, key, value)
+	case "struct", "marshaler":
+		g.printf("rem, err = %s.UnmarshalOBI(rem)\nif err != nil {\nreturn nil, err\n}\n", x)
+	default:
+		g.printf("rem, err = obi.DecodeLenient(rem, &%s)\nif err != nil {\nreturn nil, err\n}\n", x)
+	}
+}
+
+// body generates a function body with the generator, declaring err only if it is used.
+func (g *generator) body(gen func()) string {
+	outer := g.buf
+	g.buf = bytes.Buffer{}
+	g.usesErr = false
+	g.temps = 0
+	gen()
+	res := g.buf.String()
+	if g.usesErr {
+		res = "var err error\n" + res
+	}
+	g.buf = outer
+	return res
+}
+
+func (g *generator) generate(name string) error {
+	fields, err := g.fields(name)
+	if err != nil {
+		return err
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("%s has no obi fields", name)
+	}
+
+	parts := []string{`"{"`}
+	for idx, f := range fields {
+		sep := ","
+		if idx == 0 {
+			sep = ""
+		}
+		parts = append(parts, strconv.Quote(sep+f.Tag+":"))
+		parts = append(parts, schemaParts(f.Type)...)
+	}
+	parts = append(parts, `"}"`)
+
+	encode := g.body(func() {
+		for _, f := range fields {
+			g.encode("b", "v."+f.Name, f.Type)
+		}
+	})
+	decode := g.body(func() {
+		for _, f := range fields {
+			g.decode("v."+f.Name, f.Type)
+		}
+	})
+
+	g.printf("// OBISchema returns the OBI schema of %s.\n", name)
+	g.printf("func (v %s) OBISchema() string {\nreturn %s\n}\n\n", name, joinParts(parts))
+	g.printf("// MarshalOBI encodes %s into OBI bytes.\n", name)
+	g.printf("func (v %s) MarshalOBI() ([]byte, error) {\nreturn v.AppendOBI(nil)\n}\n\n", name)
+	g.printf("// AppendOBI appends the OBI encoding of %s to b.\n", name)
+	g.printf("func (v %s) AppendOBI(b []byte) ([]byte, error) {\n%sreturn b, nil\n}\n\n", name, encode)
+	g.printf("// UnmarshalOBI decodes %s from the front of data and returns the remaining bytes.\n", name)
+	g.printf("func (v *%s) UnmarshalOBI(data []byte) ([]byte, error) {\nrem := data\n%sreturn rem, nil\n}\n\n", name, decode)
+	return nil
+}
+
+func camelCase(name string) string {
+	res := ""
+	for _, part := range strings.Split(name, "_") {
+		if part != "" {
+			res += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return res
+}
+
+// schemaDecls writes the Go struct declarations of a struct schema, naming nested structs after their
+// field, and returns the names of the declared types.
+func schemaDecls(b *strings.Builder, name string, schema *obi.Schema) ([]string, error) {
+	if schema.Kind != obi.KindStruct {
+		return nil, fmt.Errorf("schema of %s must be a struct", name)
+	}
+	names := []string{name}
+	nested := []string{}
+	nestedDecls := &strings.Builder{}
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, f := range schema.Fields {
+		goName := camelCase(f.Name)
+		if goName == "" || !token.IsIdentifier(goName) {
+			return nil, fmt.Errorf("field %s of %s has no Go name", f.Name, name)
+		}
+		goType, err := schemaGoType(nestedDecls, name+goName, f.Type, &nested)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(b, "%s %s `json:%q obi:%q`\n", goName, goType, f.Name, f.Name)
+	}
+	b.WriteString("}\n\n")
+	b.WriteString(nestedDecls.String())
+	return append(names, nested...), nil
+}
+
+func schemaGoType(b *strings.Builder, name string, schema *obi.Schema, nested *[]string) (string, error) {
+	switch schema.Kind {
+	case obi.KindVector:
+		elem, err := schemaGoType(b, name, schema.Elem, nested)
+		return "[]" + elem, err
+	case obi.KindArray:
+		elem, err := schemaGoType(b, name, schema.Elem, nested)
+		return fmt.Sprintf("[%d]%s", schema.Len, elem), err
+	case obi.KindOption:
+		elem, err := schemaGoType(b, name, schema.Elem, nested)
+		return "*" + elem, err
+	case obi.KindMap:
+		key, err := schemaGoType(b, name+"Key", schema.Key, nested)
+		if err != nil {
+			return "", err
+		}
+		elem, err := schemaGoType(b, name, schema.Elem, nested)
+		return fmt.Sprintf("map[%s]%s", key, elem), err
+	case obi.KindBytes:
+		return "[]byte", nil
+	case obi.KindStruct:
+		names, err := schemaDecls(b, name, schema)
+		if err != nil {
+			return "", err
+		}
+		*nested = append(*nested, names...)
+		return name, nil
+	default:
+		for goType, s := range primitiveSchemas {
+			if goType != "byte" && s == schema.String() {
+				return goType, nil
+			}
+		}
+		return "", fmt.Errorf("unsupported schema %s", schema)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: obigen -type <Type,...> [-dir .] [-output obi_gen.go]")
+	fmt.Fprintln(os.Stderr, "       obigen -schema <schema> -name <Type> -package <pkg> [-output <file>]")
+}
+
+func run(args []string) error {
+	fs := flag.NewFlagSet("obigen", flag.ContinueOnError)
+	typeNames := fs.String("type", "", "comma separated names of the struct types to generate methods for")
+	dir := fs.String("dir", ".", "directory of the Go files declaring the types")
+	schema := fs.String("schema", "", "OBI struct schema to generate types and methods for")
+	name := fs.String("name", "", "name of the type generated from --schema")
+	pkg := fs.String("package", os.Getenv("GOPACKAGE"), "package of the generated file")
+	output := fs.String("output", "obi_gen.go", "generated file, relative to --dir")
+	err := fs.Parse(args)
+	if err != nil {
+		return err
+	}
+
+	outPath := filepath.Join(*dir, *output)
+	decls := &strings.Builder{}
+	targets := []string{}
+	fset := token.NewFileSet()
+	files := []*ast.File{}
+
+	switch {
+	case *schema != "" && *typeNames == "":
+		if *name == "" || *pkg == "" {
+			usage()
+			return fmt.Errorf("-name and -package are required with -schema")
+		}
+		s, err := obi.ParseSchema(*schema)
+		if err != nil {
+			return err
+		}
+		targets, err = schemaDecls(decls, *name, s)
+		if err != nil {
+			return err
+		}
+		file, err := parser.ParseFile(fset, "schema.go", "package "+*pkg+"\n\n"+decls.String(), 0)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	case *typeNames != "" && *schema == "":
+		targets = strings.Split(*typeNames, ",")
+		paths, err := filepath.Glob(filepath.Join(*dir, "*.go"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			if strings.HasSuffix(path, "_test.go") || filepath.Clean(path) == filepath.Clean(outPath) {
+				continue
+			}
+			file, err := parser.ParseFile(fset, path, nil, 0)
+			if err != nil {
+				return err
+			}
+			if *pkg == "" {
+				*pkg = file.Name.Name
+			}
+			files = append(files, file)
+		}
+	default:
+		usage()
+		return fmt.Errorf("exactly one of -type and -schema is required")
+	}
+
+	g := &generator{
+		structs:   map[string]*ast.StructType{},
+		named:     map[string]ast.Expr{},
+		methods:   map[string]map[string]bool{},
+		resolving: map[string]bool{},
+		targets:   map[string]bool{},
+	}
+	for _, target := range targets {
+		g.targets[target] = true
+	}
+	for _, file := range files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.TypeSpec:
+				g.named[n.Name.Name] = n.Type
+				if st, ok := n.Type.(*ast.StructType); ok {
+					g.structs[n.Name.Name] = st
+				}
+			case *ast.FuncDecl:
+				if n.Recv == nil || len(n.Recv.List) != 1 {
+					return true
+				}
+				recv := n.Recv.List[0].Type
+				if star, ok := recv.(*ast.StarExpr); ok {
+					recv = star.X
+				}
+				if ident, ok := recv.(*ast.Ident); ok {
+					if g.methods[ident.Name] == nil {
+						g.methods[ident.Name] = map[string]bool{}
+					}
+					g.methods[ident.Name][n.Name.Name] = true
+				}
+			}
+			return true
+		})
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		if g.structs[target] == nil {
+			return fmt.Errorf("struct type %s is not found", target)
+		}
+		err := g.generate(target)
+		if err != nil {
+			return err
+		}
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintf(src, "// Code generated by obigen. DO NOT EDIT.\n\npackage %s\n\n", *pkg)
+	std := []string{}
+	for _, imp := range []struct{ pkg, use string }{{"bytes", "bytes.Compare("}, {"encoding/binary", "binary.BigEndian."}} {
+		if bytes.Contains(g.buf.Bytes(), []byte(imp.use)) {
+			std = append(std, strconv.Quote(imp.pkg))
+		}
+	}
+	if len(std) != 0 {
+		fmt.Fprintf(src, "import (\n%s\n\nobi %q\n)\n\n", strings.Join(std, "\n"), OBI_IMPORT)
+	} else {
+		fmt.Fprintf(src, "import obi %q\n\n", OBI_IMPORT)
+	}
+	src.WriteString(decls.String())
+	src.Write(g.buf.Bytes())
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		return fmt.Errorf("generated invalid code, %v", err)
+	}
+	return ioutil.WriteFile(outPath, formatted, 0644)
+}
+
+func main() {
+	err := run(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	ALERT_CRITICAL = "critical"
+	ALERT_WARNING  = "warning"
+
+	// PRICE_SOURCE_DOWN_ALERT is the prefix of the key of the alert of a price source that is down.
+	PRICE_SOURCE_DOWN_ALERT = "price_source_down:"
+)
+
+// PagerDutyConfig is a PagerDuty Events API v2 integration.
+type PagerDutyConfig struct {
+	// URL defaults to the PagerDuty events endpoint.
+	URL        string `json:"url"`
+	RoutingKey string `json:"routing_key"`
+}
+
+// AlertConfig describes where alerts are sent and when they are raised.
+type AlertConfig struct {
+	// Webhooks receive every alert as JSON.
+	Webhooks []string `json:"webhooks"`
+	// Slack are Slack incoming webhook URLs, or any that accept Slack's {"text": ...} messages.
+	Slack     []string          `json:"slack"`
+	PagerDuty []PagerDutyConfig `json:"pagerduty"`
+	Timeout   Duration          `json:"timeout"`
+	// RepeatInterval is how often an alert that is still firing is sent again. Zero sends it once.
+	RepeatInterval Duration `json:"repeat_interval"`
+
+	// MaxMissedRounds is how many vote periods may go by without a confirmed round.
+	MaxMissedRounds int64 `json:"max_missed_rounds"`
+	// MaxBlockAge is how old the latest block may be before the node is out of sync.
+	MaxBlockAge Duration `json:"max_block_age"`
+	// MissWarningRatio is the share of the misses allowed in a slash window that may be used up
+	// before a warning is raised. A critical alert is raised when no more misses are allowed.
+	MissWarningRatio float64 `json:"miss_warning_ratio"`
+}
+
+func DefaultAlertConfig() AlertConfig {
+	return AlertConfig{
+		Timeout:         Duration{5 * time.Second},
+		RepeatInterval:  Duration{1 * time.Hour},
+		MaxMissedRounds: 2,
+		MaxBlockAge:     Duration{1 * time.Minute},
+
+		MissWarningRatio: 0.5,
+	}
+}
+
+// Alert is a condition of the feeder that needs attention. Alerts with the same key are the same
+// condition, which is resolved when it no longer holds.
+type Alert struct {
+	Key      string                 `json:"key"`
+	Severity string                 `json:"severity"`
+	Summary  string                 `json:"summary"`
+	Details  map[string]interface{} `json:"details,omitempty"`
+	Resolved bool                   `json:"resolved"`
+	At       time.Time              `json:"at"`
+}
+
+// AlertSink delivers alerts.
+type AlertSink interface {
+	Send(alert Alert) error
+}
+
+func postJSON(client *http.Client, url string, v interface{}) error {
+	bz, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(bz))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s responded with status %d, %s", url, resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+// WebhookSink posts every alert as JSON.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s WebhookSink) Send(alert Alert) error {
+	return postJSON(s.Client, s.URL, alert)
+}
+
+// SlackSink posts every alert as a Slack message.
+type SlackSink struct {
+	URL    string
+	Client *http.Client
+}
+
+func (s SlackSink) Send(alert Alert) error {
+	return postJSON(s.Client, s.URL, map[string]string{"text": alertText(alert)})
+}
+
+// alertText formats the alert as a line of text, e.g. "[FIRING] critical: summary (key) height=10".
+func alertText(alert Alert) string {
+	b := &strings.Builder{}
+	if alert.Resolved {
+		fmt.Fprintf(b, "[RESOLVED] %s (%s)", alert.Summary, alert.Key)
+	} else {
+		fmt.Fprintf(b, "[FIRING] %s: %s (%s)", alert.Severity, alert.Summary, alert.Key)
+	}
+	keys := []string{}
+	for k := range alert.Details {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		fmt.Fprintf(b, " %s=%v", k, alert.Details[k])
+	}
+	return b.String()
+}
+
+const PAGERDUTY_EVENTS_URL = "https://events.pagerduty.com/v2/enqueue"
+
+// PagerDutySink triggers and resolves PagerDuty events, deduplicated by the source and the key of
+// the alert so that feeders sharing a routing key do not resolve each other's incidents.
+type PagerDutySink struct {
+	URL        string
+	RoutingKey string
+	// Source is the source of the events, e.g. the validator address.
+	Source string
+	Client *http.Client
+}
+
+func (s PagerDutySink) Send(alert Alert) error {
+	event := map[string]interface{}{
+		"routing_key":  s.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    s.Source + "/" + alert.Key,
+	}
+	if alert.Resolved {
+		event["event_action"] = "resolve"
+	} else {
+		event["payload"] = map[string]interface{}{
+			"summary":        alert.Summary,
+			"source":         s.Source,
+			"severity":       alert.Severity,
+			"timestamp":      alert.At.Format(time.RFC3339),
+			"custom_details": alert.Details,
+		}
+	}
+	return postJSON(s.Client, s.URL, event)
+}
+
+// NewAlertSinks returns the sinks of the config.
+func NewAlertSinks(cfg AlertConfig, source string) []AlertSink {
+	client := &http.Client{Timeout: cfg.Timeout.Duration}
+	sinks := []AlertSink{}
+	for _, url := range cfg.Webhooks {
+		sinks = append(sinks, WebhookSink{URL: url, Client: client})
+	}
+	for _, url := range cfg.Slack {
+		sinks = append(sinks, SlackSink{URL: url, Client: client})
+	}
+	for _, pd := range cfg.PagerDuty {
+		url := pd.URL
+		if url == "" {
+			url = PAGERDUTY_EVENTS_URL
+		}
+		sinks = append(sinks, PagerDutySink{URL: url, RoutingKey: pd.RoutingKey, Source: source, Client: client})
+	}
+	return sinks
+}
+
+type firingAlert struct {
+	alert  Alert
+	sentAt time.Time
+}
+
+// Alerter sends alerts to its sinks. An alert is sent when it starts firing and again every
+// RepeatInterval while it keeps firing, and a recovery is sent when it is resolved.
+type Alerter struct {
+	Sinks          []AlertSink
+	Clock          Clock
+	RepeatInterval time.Duration
+
+	mtx    sync.Mutex
+	firing map[string]firingAlert
+}
+
+func NewAlerter(sinks []AlertSink, clock Clock, repeatInterval time.Duration) *Alerter {
+	return &Alerter{
+		Sinks:          sinks,
+		Clock:          clock,
+		RepeatInterval: repeatInterval,
+		firing:         map[string]firingAlert{},
+	}
+}
+
+// Fire raises the alert of the key unless it was sent within RepeatInterval.
+func (a *Alerter) Fire(key string, severity string, summary string, details map[string]interface{}) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	now := a.Clock.Now()
+	alert := Alert{Key: key, Severity: severity, Summary: summary, Details: details, At: now}
+	prev, ok := a.firing[key]
+	if ok && (a.RepeatInterval <= 0 || now.Sub(prev.sentAt) < a.RepeatInterval) {
+		prev.alert = alert
+		a.firing[key] = prev
+		return
+	}
+	a.firing[key] = firingAlert{alert: alert, sentAt: now}
+	logger.Warn("alert_firing", "key", key, "severity", severity, "summary", summary)
+	a.send(alert)
+}
+
+// Resolve sends the recovery of the alert of the key if it is firing.
+func (a *Alerter) Resolve(key string) {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	prev, ok := a.firing[key]
+	if !ok {
+		return
+	}
+	delete(a.firing, key)
+	alert := prev.alert
+	alert.Resolved = true
+	alert.At = a.Clock.Now()
+	logger.Info("alert_resolved", "key", key, "summary", alert.Summary)
+	a.send(alert)
+}
+
+// Set fires the alert of the key if the condition holds and resolves it otherwise.
+func (a *Alerter) Set(condition bool, key string, severity string, summary string, details map[string]interface{}) {
+	if condition {
+		a.Fire(key, severity, summary, details)
+	} else {
+		a.Resolve(key)
+	}
+}
+
+// Firing returns the keys of the alerts that are firing.
+func (a *Alerter) Firing() []string {
+	a.mtx.Lock()
+	defer a.mtx.Unlock()
+
+	keys := []string{}
+	for key := range a.firing {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (a *Alerter) send(alert Alert) {
+	for _, sink := range a.Sinks {
+		err := sink.Send(alert)
+		if err != nil {
+			logger.Error("alert_send_failed", "key", alert.Key, "sink", fmt.Sprintf("%T", sink), "error", err)
+		}
+	}
+}
+
+// Check raises and resolves the alerts of the feeder from its status and the health of its price
+// sources, after every step of the main loop.
+func (a *Alerter) Check(cfg AlertConfig, status FeederStatus, sources map[string]error) {
+	now := a.Clock.Now()
+
+	if status.VotePeriod > 0 && !status.NodeStatusAt.IsZero() {
+		// Rounds are missed since the last confirmed one, or since the feeder started if none was.
+		since := status.LastPrevoteRound
+		if since < status.StartRound {
+			since = status.StartRound
+		}
+		missed := status.CurrentRound - since
+		a.Set(missed > cfg.MaxMissedRounds, "rounds_missed", ALERT_CRITICAL,
+			fmt.Sprintf("no round was confirmed in the last %d vote periods", missed),
+			map[string]interface{}{"current_round": status.CurrentRound, "last_prevote_round": status.LastPrevoteRound, "start_round": status.StartRound})
+	}
+
+	if status.LastTx != nil {
+		a.Set(status.LastTx.Code != 0, "tx_failed", ALERT_CRITICAL,
+			fmt.Sprintf("transaction of round %d failed with code %d", status.LastTx.Round, status.LastTx.Code),
+			map[string]interface{}{"round": status.LastTx.Round, "tx_hash": status.LastTx.Hash, "code": status.LastTx.Code})
+	}
+
+	outOfSync := ""
+	switch {
+	case status.NodeStatusAt.IsZero() || now.Sub(status.NodeStatusAt) > cfg.MaxBlockAge.Duration:
+		outOfSync = "node status cannot be fetched"
+	case status.CatchingUp:
+		outOfSync = "node is catching up"
+	case now.Sub(status.LatestBlockTime) > cfg.MaxBlockAge.Duration:
+		outOfSync = fmt.Sprintf("latest block is %s old", now.Sub(status.LatestBlockTime).Round(time.Second))
+	}
+	a.Set(outOfSync != "", "node_out_of_sync", ALERT_CRITICAL, outOfSync,
+		map[string]interface{}{"height": status.LatestHeight})
+
+	if p := status.Performance; p != nil {
+		details := map[string]interface{}{
+			"miss_counter": p.MissCounter, "max_misses": p.MaxMisses, "window_end": p.WindowEnd,
+			"valid_vote_rate": p.ValidVoteRate.String(), "min_valid_per_window": p.MinValidPerWindow.String(),
+		}
+		a.Set(p.RemainingMisses > 0 && float64(p.MissCounter) > cfg.MissWarningRatio*float64(p.MaxMisses),
+			"miss_counter_high", ALERT_WARNING,
+			fmt.Sprintf("missed %d of the %d vote periods allowed in the slash window", p.MissCounter, p.MaxMisses), details)
+		summary := fmt.Sprintf("missed all %d vote periods allowed in the slash window, the validator is slashed at height %d if it misses another one",
+			p.MaxMisses, p.WindowEnd)
+		if p.RemainingMisses < 0 {
+			summary = fmt.Sprintf("missed %d vote periods, more than the %d allowed in the slash window, the validator is slashed at height %d",
+				p.MissCounter, p.MaxMisses, p.WindowEnd)
+		}
+		a.Set(p.RemainingMisses <= 0, "slash_imminent", ALERT_CRITICAL, summary, details)
+	}
+
+	for source, err := range sources {
+		key := PRICE_SOURCE_DOWN_ALERT + source
+		if err != nil {
+			a.Fire(key, ALERT_WARNING, fmt.Sprintf("price source %s is down", source), map[string]interface{}{"error": err.Error()})
+		} else {
+			a.Resolve(key)
+		}
+	}
+	// A source that is no longer queried is not known to be down.
+	for _, key := range a.Firing() {
+		source := strings.TrimPrefix(key, PRICE_SOURCE_DOWN_ALERT)
+		if _, queried := sources[source]; source != key && !queried {
+			a.Resolve(key)
+		}
+	}
+}
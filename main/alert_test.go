@@ -0,0 +1,413 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// sinkServer is an alert endpoint that keeps the JSON bodies it receives and responds with status.
+type sinkServer struct {
+	bodies []map[string]interface{}
+	status int
+}
+
+func newSinkServer(t *testing.T) (*sinkServer, string) {
+	s := &sinkServer{status: http.StatusOK}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("sink got %s with content type %q", r.Method, r.Header.Get("Content-Type"))
+		}
+		bz, _ := ioutil.ReadAll(r.Body)
+		body := map[string]interface{}{}
+		err := json.Unmarshal(bz, &body)
+		if err != nil {
+			t.Errorf("sink got %s, %v", bz, err)
+		}
+		s.bodies = append(s.bodies, body)
+		w.WriteHeader(s.status)
+		fmt.Fprint(w, "sink response")
+	}))
+	t.Cleanup(srv.Close)
+	return s, srv.URL
+}
+
+func testAlert(resolved bool) Alert {
+	return Alert{
+		Key:      "rounds_missed",
+		Severity: ALERT_CRITICAL,
+		Summary:  "no round was confirmed in the last 3 vote periods",
+		Details:  map[string]interface{}{"current_round": 7, "last_prevote_round": 4},
+		Resolved: resolved,
+		At:       time.Date(2020, 9, 1, 12, 0, 0, 0, time.UTC),
+	}
+}
+
+func TestWebhookSink(t *testing.T) {
+	server, url := newSinkServer(t)
+	err := WebhookSink{URL: url, Client: http.DefaultClient}.Send(testAlert(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"key":      "rounds_missed",
+		"severity": "critical",
+		"summary":  "no round was confirmed in the last 3 vote periods",
+		"details":  map[string]interface{}{"current_round": 7.0, "last_prevote_round": 4.0},
+		"resolved": false,
+		"at":       "2020-09-01T12:00:00Z",
+	}
+	if len(server.bodies) != 1 || !reflect.DeepEqual(server.bodies[0], want) {
+		t.Errorf("webhook got %v, want %v", server.bodies, want)
+	}
+}
+
+func TestSlackSink(t *testing.T) {
+	server, url := newSinkServer(t)
+	sink := SlackSink{URL: url, Client: http.DefaultClient}
+	for _, alert := range []Alert{testAlert(false), testAlert(true)} {
+		err := sink.Send(alert)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []map[string]interface{}{
+		{"text": "[FIRING] critical: no round was confirmed in the last 3 vote periods (rounds_missed) current_round=7 last_prevote_round=4"},
+		{"text": "[RESOLVED] no round was confirmed in the last 3 vote periods (rounds_missed) current_round=7 last_prevote_round=4"},
+	}
+	if !reflect.DeepEqual(server.bodies, want) {
+		t.Errorf("slack got %v, want %v", server.bodies, want)
+	}
+}
+
+func TestPagerDutySink(t *testing.T) {
+	server, url := newSinkServer(t)
+	sink := PagerDutySink{URL: url, RoutingKey: "routing-key", Source: "terravaloper1abc", Client: http.DefaultClient}
+	for _, alert := range []Alert{testAlert(false), testAlert(true)} {
+		err := sink.Send(alert)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []map[string]interface{}{
+		{
+			"routing_key":  "routing-key",
+			"event_action": "trigger",
+			"dedup_key":    "terravaloper1abc/rounds_missed",
+			"payload": map[string]interface{}{
+				"summary":        "no round was confirmed in the last 3 vote periods",
+				"source":         "terravaloper1abc",
+				"severity":       "critical",
+				"timestamp":      "2020-09-01T12:00:00Z",
+				"custom_details": map[string]interface{}{"current_round": 7.0, "last_prevote_round": 4.0},
+			},
+		},
+		// A resolve only needs the dedup key.
+		{"routing_key": "routing-key", "event_action": "resolve", "dedup_key": "terravaloper1abc/rounds_missed"},
+	}
+	if !reflect.DeepEqual(server.bodies, want) {
+		t.Errorf("pagerduty got %v, want %v", server.bodies, want)
+	}
+}
+
+func TestSinkRejected(t *testing.T) {
+	server, url := newSinkServer(t)
+	server.status = http.StatusBadRequest
+	sinks := NewAlertSinks(AlertConfig{Webhooks: []string{url}, Slack: []string{url}, PagerDuty: []PagerDutyConfig{{URL: url}}}, "terravaloper1abc")
+	if len(sinks) != 3 {
+		t.Fatalf("NewAlertSinks returned %d sinks, want 3", len(sinks))
+	}
+	for _, sink := range sinks {
+		err := sink.Send(testAlert(false))
+		if err == nil || !strings.Contains(err.Error(), "status 400, sink response") {
+			t.Errorf("%T returned %v for a rejected alert", sink, err)
+		}
+	}
+}
+
+type recordingSink struct {
+	alerts []Alert
+}
+
+func (s *recordingSink) Send(alert Alert) error {
+	s.alerts = append(s.alerts, alert)
+	return nil
+}
+
+// events returns the alerts sent since the last call, as sorted "fire:key" or "resolve:key".
+func (s *recordingSink) events() []string {
+	events := []string{}
+	for _, alert := range s.alerts {
+		if alert.Resolved {
+			events = append(events, "resolve:"+alert.Key)
+		} else {
+			events = append(events, "fire:"+alert.Key)
+		}
+	}
+	s.alerts = nil
+	sort.Strings(events)
+	return events
+}
+
+func newTestAlerter() (*Alerter, *recordingSink, FeederStatus) {
+	sink := &recordingSink{}
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	status := FeederStatus{VotePeriod: 5, NodeStatusAt: clock.now, LatestBlockTime: clock.now}
+	return NewAlerter([]AlertSink{sink}, clock, time.Hour), sink, status
+}
+
+func TestCheckRoundsMissed(t *testing.T) {
+	cfg := DefaultAlertConfig()
+	alerter, sink, status := newTestAlerter()
+
+	// A feeder that starts far into the chain has confirmed no round yet.
+	status.StartRound = 1000
+	status.CurrentRound = 1000
+	for round := int64(1000); round <= 1002; round++ {
+		status.CurrentRound = round
+		alerter.Check(cfg, status, nil)
+		if events := sink.events(); len(events) != 0 {
+			t.Fatalf("round %d after the start sent %v", round-status.StartRound, events)
+		}
+	}
+	status.CurrentRound = 1003
+	alerter.Check(cfg, status, nil)
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"fire:rounds_missed"}) {
+		t.Fatalf("3 rounds after the start sent %v", events)
+	}
+
+	// The missed rounds count from the last confirmed round once there is one.
+	status.LastPrevoteRound = 1003
+	alerter.Check(cfg, status, nil)
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"resolve:rounds_missed"}) {
+		t.Fatalf("a confirmed round sent %v", events)
+	}
+	status.CurrentRound = 1006
+	alerter.Check(cfg, status, nil)
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"fire:rounds_missed"}) {
+		t.Fatalf("3 rounds after the confirmed round sent %v", events)
+	}
+}
+
+func TestCheckRoundsMissedBeforeNodeStatus(t *testing.T) {
+	alerter, sink, status := newTestAlerter()
+	status.NodeStatusAt = time.Time{}
+	status.CurrentRound = 1000
+	alerter.Check(DefaultAlertConfig(), status, nil)
+	for _, key := range alerter.Firing() {
+		if key == "rounds_missed" {
+			t.Errorf("rounds_missed fired before the node status was known, sent %v", sink.events())
+		}
+	}
+}
+
+func TestCheckPriceSources(t *testing.T) {
+	cfg := DefaultAlertConfig()
+	alerter, sink, status := newTestAlerter()
+	down := errors.New("down")
+
+	alerter.Check(cfg, status, map[string]error{"band": down, "primary": down})
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"fire:price_source_down:band", "fire:price_source_down:primary"}) {
+		t.Fatalf("down sources sent %v", events)
+	}
+
+	// Band recovers, so the primary provider is no longer queried.
+	alerter.Check(cfg, status, map[string]error{"band": nil})
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"resolve:price_source_down:band", "resolve:price_source_down:primary"}) {
+		t.Fatalf("recovered band sent %v", events)
+	}
+	if firing := alerter.Firing(); len(firing) != 0 {
+		t.Errorf("alerts %v are firing after every source recovered or was no longer queried", firing)
+	}
+}
+
+func TestAlerterRepeatsFiringAlerts(t *testing.T) {
+	sink := &recordingSink{}
+	start := time.Unix(1600000000, 0)
+	clock := &fakeClock{now: start}
+	alerter := NewAlerter([]AlertSink{sink}, clock, time.Hour)
+
+	for _, tc := range []struct {
+		after   time.Duration
+		summary string
+		sent    bool
+	}{
+		{0, "first", true},
+		// The alert is only updated within the repeat interval.
+		{30 * time.Minute, "second", false},
+		{59 * time.Minute, "third", false},
+		{time.Hour, "fourth", true},
+		{time.Hour + time.Minute, "fifth", false},
+	} {
+		clock.now = start.Add(tc.after)
+		alerter.Fire("rounds_missed", ALERT_CRITICAL, tc.summary, nil)
+		sent := len(sink.alerts) == 1 && sink.alerts[0].Summary == tc.summary && sink.alerts[0].At.Equal(clock.now)
+		if sent != tc.sent || (!tc.sent && len(sink.alerts) != 0) {
+			t.Errorf("fire %q after %s sent %+v, expect sent %v", tc.summary, tc.after, sink.alerts, tc.sent)
+		}
+		sink.alerts = nil
+	}
+
+	// The recovery has the latest summary.
+	clock.now = start.Add(2 * time.Hour)
+	alerter.Resolve("rounds_missed")
+	if len(sink.alerts) != 1 || !sink.alerts[0].Resolved || sink.alerts[0].Summary != "fifth" || !sink.alerts[0].At.Equal(clock.now) {
+		t.Errorf("resolve sent %+v, expect the recovery of the fifth alert", sink.alerts)
+	}
+	sink.alerts = nil
+	alerter.Resolve("rounds_missed")
+	if len(sink.alerts) != 0 {
+		t.Errorf("resolve of a resolved alert sent %+v", sink.alerts)
+	}
+
+	// An alert that fires again after its recovery is sent at once.
+	alerter.Fire("rounds_missed", ALERT_CRITICAL, "again", nil)
+	if len(sink.alerts) != 1 || sink.alerts[0].Summary != "again" {
+		t.Errorf("fire after the recovery sent %+v", sink.alerts)
+	}
+}
+
+func TestAlerterWithoutRepeatInterval(t *testing.T) {
+	sink := &recordingSink{}
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	alerter := NewAlerter([]AlertSink{sink}, clock, 0)
+	for day := 0; day < 3; day++ {
+		alerter.Fire("tx_failed", ALERT_CRITICAL, "failed", nil)
+		clock.now = clock.now.Add(24 * time.Hour)
+	}
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"fire:tx_failed"}) {
+		t.Errorf("alert without a repeat interval sent %v", events)
+	}
+}
+
+func TestCheckTxFailed(t *testing.T) {
+	cfg := DefaultAlertConfig()
+	alerter, sink, status := newTestAlerter()
+
+	status.LastTx = &TxStatus{Round: 7, Hash: "ABCD", Code: 5, Height: 36}
+	alerter.Check(cfg, status, nil)
+	if len(sink.alerts) != 1 || sink.alerts[0].Key != "tx_failed" || sink.alerts[0].Summary != "transaction of round 7 failed with code 5" {
+		t.Fatalf("failed tx sent %+v", sink.alerts)
+	}
+	if details := sink.alerts[0].Details; details["tx_hash"] != "ABCD" || details["code"] != uint32(5) || details["round"] != int64(7) {
+		t.Errorf("failed tx sent details %v", details)
+	}
+	sink.alerts = nil
+
+	// Before the next tx the status has no tx, which keeps the alert.
+	status.LastTx = nil
+	alerter.Check(cfg, status, nil)
+	if events := sink.events(); len(events) != 0 {
+		t.Errorf("status without a tx sent %v", events)
+	}
+	status.LastTx = &TxStatus{Round: 8, Hash: "EF01", Height: 41}
+	alerter.Check(cfg, status, nil)
+	if events := sink.events(); !reflect.DeepEqual(events, []string{"resolve:tx_failed"}) {
+		t.Errorf("successful tx sent %v", events)
+	}
+}
+
+func TestCheckNodeOutOfSync(t *testing.T) {
+	testCases := []struct {
+		name    string
+		update  func(status *FeederStatus, now time.Time)
+		summary string
+	}{
+		{"synced", func(status *FeederStatus, now time.Time) {}, ""},
+		{"catching up", func(status *FeederStatus, now time.Time) { status.CatchingUp = true }, "node is catching up"},
+		{"stale block", func(status *FeederStatus, now time.Time) { status.LatestBlockTime = now.Add(-90 * time.Second) }, "latest block is 1m30s old"},
+		{"no node status", func(status *FeederStatus, now time.Time) { status.NodeStatusAt = time.Time{} }, "node status cannot be fetched"},
+		{"stale node status", func(status *FeederStatus, now time.Time) { status.NodeStatusAt = now.Add(-2 * time.Minute) }, "node status cannot be fetched"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := DefaultAlertConfig()
+			alerter, sink, status := newTestAlerter()
+			status.LatestHeight = 36
+			tc.update(&status, alerter.Clock.Now())
+			alerter.Check(cfg, status, nil)
+			if tc.summary == "" {
+				if len(sink.alerts) != 0 {
+					t.Errorf("synced node sent %+v", sink.alerts)
+				}
+				return
+			}
+			if len(sink.alerts) != 1 || sink.alerts[0].Key != "node_out_of_sync" || sink.alerts[0].Summary != tc.summary || sink.alerts[0].Details["height"] != int64(36) {
+				t.Fatalf("sent %+v, expect node_out_of_sync with %q", sink.alerts, tc.summary)
+			}
+			sink.alerts = nil
+
+			_, _, synced := newTestAlerter()
+			alerter.Check(cfg, synced, nil)
+			if events := sink.events(); !reflect.DeepEqual(events, []string{"resolve:node_out_of_sync"}) {
+				t.Errorf("synced node sent %v", events)
+			}
+		})
+	}
+}
+
+func performance(t *testing.T, missCounter int64) *OraclePerformance {
+	p, err := NewOraclePerformance(terra_types.Params{VotePeriod: 5, SlashWindow: 100, MinValidPerWindow: sdk.MustNewDecFromStr("0.65")}, 150, missCounter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &p
+}
+
+func TestCheckMissCounter(t *testing.T) {
+	cfg := DefaultAlertConfig()
+	alerter, sink, status := newTestAlerter()
+
+	// 13 of the 20 vote periods of the window must be valid, so 7 may be missed, and more than half
+	// of them is high.
+	for _, tc := range []struct {
+		missCounter int64
+		events      []string
+	}{
+		{3, []string{}},
+		{4, []string{"fire:miss_counter_high"}},
+		{6, []string{}},
+		{7, []string{"fire:slash_imminent", "resolve:miss_counter_high"}},
+		{9, []string{}},
+		// A new window starts without misses.
+		{0, []string{"resolve:slash_imminent"}},
+	} {
+		status.Performance = performance(t, tc.missCounter)
+		alerter.Check(cfg, status, nil)
+		if events := sink.events(); !reflect.DeepEqual(events, tc.events) {
+			t.Errorf("miss counter %d sent %v, expect %v", tc.missCounter, events, tc.events)
+		}
+	}
+}
+
+func TestCheckSlashImminentSummary(t *testing.T) {
+	for _, tc := range []struct {
+		missCounter int64
+		summary     string
+	}{
+		{7, "missed all 7 vote periods allowed in the slash window, the validator is slashed at height 199 if it misses another one"},
+		{9, "missed 9 vote periods, more than the 7 allowed in the slash window, the validator is slashed at height 199"},
+	} {
+		alerter, sink, status := newTestAlerter()
+		status.Performance = performance(t, tc.missCounter)
+		alerter.Check(DefaultAlertConfig(), status, nil)
+		if len(sink.alerts) != 1 || sink.alerts[0].Key != "slash_imminent" || sink.alerts[0].Summary != tc.summary {
+			t.Errorf("miss counter %d sent %+v, expect slash_imminent with %q", tc.missCounter, sink.alerts, tc.summary)
+			continue
+		}
+		if details := sink.alerts[0].Details; details["max_misses"] != int64(7) || details["valid_vote_rate"] != performance(t, tc.missCounter).ValidVoteRate.String() {
+			t.Errorf("miss counter %d sent details %v", tc.missCounter, details)
+		}
+	}
+}
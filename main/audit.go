@@ -0,0 +1,272 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// AuditConfig describes the audit log, which keeps a JSON line for every round of the feeder.
+type AuditConfig struct {
+	// Path is the file to append to. The audit log is off if it is empty.
+	Path string `json:"path"`
+	// MaxSizeMB is how large the file may grow before it is rotated to Path.1, Path.1 to Path.2 and so on.
+	MaxSizeMB int64 `json:"max_size_mb"`
+	// MaxBackups is how many rotated files to keep.
+	MaxBackups int `json:"max_backups"`
+}
+
+func DefaultAuditConfig() AuditConfig {
+	return AuditConfig{Path: "", MaxSizeMB: 100, MaxBackups: 10}
+}
+
+// AuditVote is a vote of a round along with the salt and the hash of its prevote.
+type AuditVote struct {
+	Denom        string  `json:"denom"`
+	ExchangeRate sdk.Dec `json:"exchange_rate"`
+	Salt         string  `json:"salt"`
+	Hash         string  `json:"hash"`
+}
+
+// AuditRecord is what the feeder saw, decided and sent in a round.
+type AuditRecord struct {
+	Round      int64 `json:"round"`
+	VotePeriod int64 `json:"vote_period"`
+	// Height is the block height the round started at.
+	Height int64     `json:"height"`
+	Time   time.Time `json:"time"`
+	// Prevotes are the prevotes of the validator that were on chain when the round started.
+	Prevotes terra_types.ExchangeRatePrevotes `json:"prevotes"`
+	// Fetch is what the price sources returned, from the raw Band results to the resolved prices.
+	Fetch *PriceFetch `json:"fetch,omitempty"`
+	// Prices are the prices the round voted with.
+	Prices map[string]sdk.Dec `json:"prices,omitempty"`
+	// Revealed are the votes of the previous round revealed in the round, if Reveal.
+	Reveal   bool        `json:"reveal"`
+	Revealed []AuditVote `json:"revealed,omitempty"`
+	// Committed are the new votes whose prevotes were sent in the round.
+	Committed []AuditVote `json:"committed,omitempty"`
+	// Msgs are the messages of the transaction in amino JSON.
+	Msgs     json.RawMessage `json:"msgs,omitempty"`
+	TxHash   string          `json:"tx_hash,omitempty"`
+	TxHeight int64           `json:"tx_height,omitempty"`
+	Code     uint32          `json:"code"`
+	Log      string          `json:"log,omitempty"`
+	// Error is why the round failed, empty if it succeeded.
+	Error string `json:"error,omitempty"`
+}
+
+// matches tells whether the record is of the round, or of the vote period of the height, or
+// its transaction was included at the height. Negative values match nothing.
+func (r AuditRecord) matches(round int64, height int64) bool {
+	if round >= 0 && r.Round == round {
+		return true
+	}
+	if height >= 0 && r.VotePeriod > 0 && (r.Round == height/r.VotePeriod || r.TxHeight == height) {
+		return true
+	}
+	return false
+}
+
+// auditVotes lists the votes of the active denoms with the hashes of their prevotes.
+func auditVotes(votes map[string]terra_types.MsgExchangeRateVote, validator sdk.ValAddress) []AuditVote {
+	result := []AuditVote{}
+	for _, denom := range activeDenoms {
+		vote, ok := votes[denom]
+		if !ok {
+			continue
+		}
+		result = append(result, AuditVote{
+			Denom:        denom,
+			ExchangeRate: vote.ExchangeRate,
+			Salt:         vote.Salt,
+			Hash:         terra_types.GetVoteHash(vote.Salt, vote.ExchangeRate, vote.Denom, validator).String(),
+		})
+	}
+	return result
+}
+
+// AuditSink keeps the audit records of the rounds.
+type AuditSink interface {
+	Record(record AuditRecord) error
+}
+
+// AuditLog appends audit records to a file as JSON lines and rotates it when it grows too large.
+type AuditLog struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mtx  sync.Mutex
+	file *os.File
+	size int64
+}
+
+// OpenAuditLog opens the file of the config for appending, creating it if it does not exist.
+func OpenAuditLog(cfg AuditConfig) (*AuditLog, error) {
+	l := &AuditLog{Path: cfg.Path, MaxSize: cfg.MaxSizeMB * 1024 * 1024, MaxBackups: cfg.MaxBackups}
+	err := l.open()
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *AuditLog) open() error {
+	file, err := os.OpenFile(l.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("fail to open audit log: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("fail to stat audit log: %v", err)
+	}
+	l.file = file
+	l.size = info.Size()
+	return nil
+}
+
+func (l *AuditLog) backupPath(i int) string {
+	if i == 0 {
+		return l.Path
+	}
+	return fmt.Sprintf("%s.%d", l.Path, i)
+}
+
+// rotate moves every file one backup up, dropping the oldest, and starts a new file.
+func (l *AuditLog) rotate() error {
+	err := l.file.Close()
+	if err != nil {
+		return err
+	}
+	if l.MaxBackups <= 0 {
+		err = os.Remove(l.Path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	for i := l.MaxBackups; i >= 1; i-- {
+		err = os.Rename(l.backupPath(i-1), l.backupPath(i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return l.open()
+}
+
+// Record appends the record as a line, rotating the file first if the line would make it larger
+// than MaxSize.
+func (l *AuditLog) Record(record AuditRecord) error {
+	bz, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("fail to marshal audit record: %v", err)
+	}
+	bz = append(bz, '\n')
+
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+
+	if l.MaxSize > 0 && l.size > 0 && l.size+int64(len(bz)) > l.MaxSize {
+		err = l.rotate()
+		if err != nil {
+			return fmt.Errorf("fail to rotate audit log: %v", err)
+		}
+	}
+	n, err := l.file.Write(bz)
+	l.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("fail to write audit log: %v", err)
+	}
+	return l.file.Sync()
+}
+
+// Close closes the file of the audit log.
+func (l *AuditLog) Close() error {
+	l.mtx.Lock()
+	defer l.mtx.Unlock()
+	return l.file.Close()
+}
+
+// auditFiles returns the file of the audit log and its rotated files that exist, oldest first.
+func auditFiles(path string) []string {
+	files := []string{}
+	for i := 1; ; i++ {
+		backup := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(backup); err != nil {
+			break
+		}
+		files = append([]string{backup}, files...)
+	}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	return files
+}
+
+// QueryAuditLog writes the lines of the audit log at path, and of its rotated files, whose records
+// match the round or the height to w, oldest first.
+func QueryAuditLog(path string, round int64, height int64, w io.Writer) error {
+	files := auditFiles(path)
+	if len(files) == 0 {
+		return fmt.Errorf("audit log %s does not exist", path)
+	}
+	for _, name := range files {
+		err := queryAuditFile(name, round, height, w)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queryAuditFile(name string, round int64, height int64, w io.Writer) error {
+	file, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var record AuditRecord
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			return fmt.Errorf("fail to unmarshal line %d of %s: %v", line, name, err)
+		}
+		if record.matches(round, height) {
+			fmt.Fprintf(w, "%s\n", scanner.Bytes())
+		}
+	}
+	return scanner.Err()
+}
+
+// runAuditQuery is the audit command, which prints the records of a round or a height.
+func runAuditQuery(args []string) error {
+	fs := newFlagSet("audit")
+	configPath := configFlag(fs)
+	path := fs.String("path", "", "path to the audit log, overrides the one of the config")
+	round := fs.Int64("round", -1, "print the records of the round")
+	height := fs.Int64("height", -1, "print the records of the vote period of the height, or whose transaction was included at it")
+	fs.Parse(args)
+
+	if *path == "" {
+		*path = loadConfig(*configPath).Audit.Path
+	}
+	if *path == "" {
+		return fmt.Errorf("no audit log, set -path or audit.path of the config")
+	}
+	if *round < 0 && *height < 0 {
+		return fmt.Errorf("set -round or -height")
+	}
+
+	return QueryAuditLog(*path, *round, *height, os.Stdout)
+}
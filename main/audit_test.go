@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// auditRecord is a record of the round, which started at its first block of 10 and whose transaction
+// was included at the first block of the next round.
+func auditRecord(round int64) AuditRecord {
+	return AuditRecord{Round: round, VotePeriod: 10, Height: round * 10, TxHeight: round*10 + 10, TxHash: "ABCD"}
+}
+
+// auditLineSize is the size of the line of a record of a round from 10 to 98, so that every record
+// of the tests takes the same space.
+func auditLineSize(t *testing.T) int64 {
+	bz, err := json.Marshal(auditRecord(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return int64(len(bz) + 1)
+}
+
+func newTestAuditLog(t *testing.T, path string, maxLines int64, maxBackups int) *AuditLog {
+	l := &AuditLog{Path: path, MaxSize: maxLines * auditLineSize(t), MaxBackups: maxBackups}
+	err := l.open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+// auditRounds returns the rounds of the records in the file, or nil if it does not exist.
+func auditRounds(t *testing.T, name string) []int64 {
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	rounds := []int64{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AuditRecord
+		err = json.Unmarshal(scanner.Bytes(), &record)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rounds = append(rounds, record.Round)
+	}
+	return rounds
+}
+
+func TestAuditLogRotates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := newTestAuditLog(t, path, 2, 2)
+	for round := int64(11); round <= 17; round++ {
+		err := l.Record(auditRecord(round))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Two records fill a file exactly, so every third one starts a new file, and the file of rounds
+	// 11 and 12 is dropped for a third backup.
+	for name, want := range map[string][]int64{
+		path:        {17},
+		path + ".1": {15, 16},
+		path + ".2": {13, 14},
+		path + ".3": nil,
+	} {
+		if got := auditRounds(t, name); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s has rounds %v, expect %v", filepath.Base(name), got, want)
+		}
+	}
+}
+
+func TestAuditLogWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := newTestAuditLog(t, path, 2, 0)
+	for round := int64(11); round <= 13; round++ {
+		err := l.Record(auditRecord(round))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := auditRounds(t, path); !reflect.DeepEqual(got, []int64{13}) {
+		t.Errorf("audit log has rounds %v, expect [13]", got)
+	}
+	if got := auditRounds(t, path+".1"); got != nil {
+		t.Errorf("audit log without backups has a backup with rounds %v", got)
+	}
+}
+
+func TestAuditLogChecksSizeBeforeWriting(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+
+	// A record larger than the max size is written to an empty file as it is.
+	large := auditRecord(11)
+	large.Log = strings.Repeat("x", int(3*auditLineSize(t)))
+	l := newTestAuditLog(t, path, 2, 1)
+	err := l.Record(large)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auditRounds(t, path); !reflect.DeepEqual(got, []int64{11}) {
+		t.Errorf("audit log has rounds %v, expect [11]", got)
+	}
+
+	// A reopened log continues with the size of the file, so the next record goes to a new file.
+	l.Close()
+	l = newTestAuditLog(t, path, 2, 1)
+	err = l.Record(auditRecord(12))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := auditRounds(t, path); !reflect.DeepEqual(got, []int64{12}) {
+		t.Errorf("audit log has rounds %v, expect [12]", got)
+	}
+	if got := auditRounds(t, path+".1"); !reflect.DeepEqual(got, []int64{11}) {
+		t.Errorf("backup has rounds %v, expect [11]", got)
+	}
+}
+
+func TestQueryAuditLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	l := newTestAuditLog(t, path, 2, 3)
+	// Round 13 is retried. The log ends up with rounds 11 and 12 in its second backup, 13 twice in
+	// the first backup and 14 in the file.
+	for _, round := range []int64{11, 12, 13, 13, 14} {
+		err := l.Record(auditRecord(round))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	testCases := []struct {
+		name   string
+		round  int64
+		height int64
+		rounds []int64
+	}{
+		{"round", 13, -1, []int64{13, 13}},
+		{"round in the oldest file", 11, -1, []int64{11}},
+		{"height of the vote period", -1, 125, []int64{12}},
+		{"last height of the vote period", -1, 149, []int64{14}},
+		// The transaction of round 14 was included at 150, in a vote period without records.
+		{"tx height", -1, 150, []int64{14}},
+		// 130 is in the vote period of round 13 and the transaction of round 12 was included at it.
+		{"height of the vote period and a tx", -1, 130, []int64{12, 13, 13}},
+		{"round or height", 11, 141, []int64{11, 14}},
+		{"unknown round", 19, -1, []int64{}},
+		{"nothing", -1, -1, []int64{}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			err := QueryAuditLog(path, tc.round, tc.height, out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rounds := []int64{}
+			for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+				if line == "" {
+					continue
+				}
+				var record AuditRecord
+				err = json.Unmarshal([]byte(line), &record)
+				if err != nil {
+					t.Fatal(err)
+				}
+				rounds = append(rounds, record.Round)
+			}
+			if !reflect.DeepEqual(rounds, tc.rounds) {
+				t.Errorf("expect records of rounds %v but got %v", tc.rounds, rounds)
+			}
+		})
+	}
+
+	err := QueryAuditLog(filepath.Join(t.TempDir(), "missing.jsonl"), 11, -1, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("expect a missing audit log to fail but got %v", err)
+	}
+}
+
+func TestQueryAuditLogRejectsInvalidLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	err := os.WriteFile(path, []byte("{\"round\":1}\nnot json\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = QueryAuditLog(path, 1, -1, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "fail to unmarshal line 2 of") {
+		t.Errorf("expect the invalid line to fail but got %v", err)
+	}
+}
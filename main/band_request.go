@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	"github.com/cosmos/cosmos-sdk/crypto/keys"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	auth_types "github.com/cosmos/cosmos-sdk/x/auth/types"
+	"github.com/tendermint/tendermint/libs/bech32"
+)
+
+const (
+	BAND_BECH32_PREFIX = "band"
+
+	RESOLVE_STATUS_OPEN    = uint8(0)
+	RESOLVE_STATUS_SUCCESS = uint8(1)
+)
+
+var (
+	bandCdc = makeBandCodec()
+
+	// Every request is signed by the same Band account, so only one can be in flight at a time.
+	bandRequestMtx sync.Mutex
+)
+
+// openBandKeybase opens the keyring of the Band account in dir.
+var openBandKeybase = func(dir string) (keys.Keybase, error) {
+	return keys.NewKeyring("band", "test", dir, nil)
+}
+
+// MsgRequestData is the BandChain message that asks validators to resolve an oracle script.
+// Sender is kept as a bech32 string because the SDK config is sealed with Terra prefixes.
+type MsgRequestData struct {
+	OracleScriptID uint64 `json:"oracle_script_id,string"`
+	Calldata       []byte `json:"calldata"`
+	AskCount       uint64 `json:"ask_count,string"`
+	MinCount       uint64 `json:"min_count,string"`
+	ClientID       string `json:"client_id"`
+	Sender         string `json:"sender"`
+}
+
+func (msg MsgRequestData) Route() string { return "oracle" }
+func (msg MsgRequestData) Type() string  { return "request" }
+
+func (msg MsgRequestData) ValidateBasic() error {
+	if msg.MinCount == 0 || msg.MinCount > msg.AskCount {
+		return fmt.Errorf("invalid min count %d for ask count %d", msg.MinCount, msg.AskCount)
+	}
+	_, _, err := bech32.DecodeAndConvert(msg.Sender)
+	return err
+}
+
+func (msg MsgRequestData) GetSignBytes() []byte {
+	return sdk.MustSortJSON(bandCdc.MustMarshalJSON(msg))
+}
+
+func (msg MsgRequestData) GetSigners() []sdk.AccAddress {
+	_, bz, err := bech32.DecodeAndConvert(msg.Sender)
+	if err != nil {
+		panic(err)
+	}
+	return []sdk.AccAddress{bz}
+}
+
+func makeBandCodec() *codec.Codec {
+	c := codec.New()
+	sdk.RegisterCodec(c)
+	codec.RegisterCrypto(c)
+	auth_types.RegisterCodec(c)
+	c.RegisterConcrete(MsgRequestData{}, "oracle/Request", nil)
+	return c
+}
+
+type BandAccount struct {
+	Address       string `json:"address"`
+	AccountNumber uint64 `json:"account_number,string"`
+	Sequence      uint64 `json:"sequence,string"`
+}
+
+type BandAccountResponse struct {
+	Height int64 `json:"height,string"`
+	Result struct {
+		Type  string      `json:"type"`
+		Value BandAccount `json:"value"`
+	} `json:"result"`
+}
+
+type BandTxEvent struct {
+	Type       string `json:"type"`
+	Attributes []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"attributes"`
+}
+
+type BandTxResponse struct {
+	Height int64  `json:"height,string"`
+	TxHash string `json:"txhash"`
+	Code   uint32 `json:"code"`
+	RawLog string `json:"raw_log"`
+	Logs   []struct {
+		MsgIndex int           `json:"msg_index"`
+		Events   []BandTxEvent `json:"events"`
+	} `json:"logs"`
+}
+
+// requestID returns the ID of the oracle request created by the transaction.
+func (res BandTxResponse) requestID() (uint64, error) {
+	for _, log := range res.Logs {
+		for _, event := range log.Events {
+			if event.Type != "request" {
+				continue
+			}
+			for _, attr := range event.Attributes {
+				if attr.Key == "id" {
+					return strconv.ParseUint(attr.Value, 10, 64)
+				}
+			}
+		}
+	}
+	return 0, fmt.Errorf("request id not found in tx %s", res.TxHash)
+}
+
+// getJSON gets url and unmarshals the response into v. The request is given up at the deadline.
+func getJSON(url string, deadline time.Time, v interface{}) error {
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d, %s", url, resp.StatusCode, string(body[:]))
+	}
+
+	err = json.Unmarshal(body, v)
+	if err != nil {
+		return fmt.Errorf("fail to unmarshal response of %s, %v, %s", url, err, string(body[:]))
+	}
+	return nil
+}
+
+func getBandAccount(bandURL string, address string, deadline time.Time) (BandAccount, error) {
+	bar := BandAccountResponse{}
+	err := getJSON(fmt.Sprintf("%s/auth/accounts/%s", bandURL, address), deadline, &bar)
+	if err != nil {
+		return BandAccount{}, err
+	}
+	return bar.Result.Value, nil
+}
+
+// submitBandRequest signs a MsgRequestData for the feed with the configured Band account,
+// broadcasts it in block mode and returns the ID of the created request. The broadcast is given up
+// at the deadline.
+func submitBandRequest(cfg BandRequestConfig, feed *Feed, deadline time.Time) (uint64, error) {
+	bandRequestMtx.Lock()
+	defer bandRequestMtx.Unlock()
+
+	keybase, err := openBandKeybase(cfg.KeyringDir)
+	if err != nil {
+		return 0, fmt.Errorf("fail to create band keybase from dir: %v", err)
+	}
+
+	info, err := keybase.Get(cfg.KeyName)
+	if err != nil {
+		return 0, err
+	}
+
+	sender, err := bech32.ConvertAndEncode(BAND_BECH32_PREFIX, info.GetAddress())
+	if err != nil {
+		return 0, err
+	}
+
+	acc, err := getBandAccount(feed.Config.BandURL, sender, deadline)
+	if err != nil {
+		return 0, err
+	}
+
+	fees, err := sdk.ParseCoins(cfg.Fees)
+	if err != nil {
+		return 0, err
+	}
+
+	msgs := []sdk.Msg{MsgRequestData{
+		OracleScriptID: feed.Config.OracleScriptID,
+		Calldata:       feed.Calldata,
+		AskCount:       feed.Config.AskCount,
+		MinCount:       feed.Config.MinCount,
+		ClientID:       cfg.ClientID,
+		Sender:         sender,
+	}}
+	for _, msg := range msgs {
+		err = msg.ValidateBasic()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	fee := auth_types.NewStdFee(cfg.Gas, fees)
+	signBytes := auth_types.StdSignBytes(cfg.ChainID, acc.AccountNumber, acc.Sequence, fee, msgs, "")
+	sig, pubKey, err := keybase.Sign(cfg.KeyName, cfg.KeyPassword, signBytes)
+	if err != nil {
+		return 0, err
+	}
+
+	tx := auth_types.NewStdTx(msgs, fee, []auth_types.StdSignature{{PubKey: pubKey, Signature: sig}}, "")
+	bz, err := bandCdc.MarshalJSON(struct {
+		Tx   auth_types.StdTx `json:"tx"`
+		Mode string           `json:"mode"`
+	}{tx, "block"})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("%s/txs", feed.Config.BandURL), bytes.NewReader(bz))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return 0, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("band tx broadcast responded with status %d, %s", resp.StatusCode, string(body[:]))
+	}
+
+	res := BandTxResponse{}
+	err = json.Unmarshal(body, &res)
+	if err != nil {
+		return 0, fmt.Errorf("fail to unmarshal band tx response, %v, %s", err, string(body[:]))
+	}
+	if res.Code != 0 {
+		return 0, fmt.Errorf("band tx %s failed with code %d, %s", res.TxHash, res.Code, res.RawLog)
+	}
+
+	return res.requestID()
+}
+
+// waitBandRequest polls the request until it is resolved or the deadline has passed.
+func waitBandRequest(cfg BandRequestConfig, feed *Feed, id uint64, deadline time.Time) (BandResult, error) {
+	for {
+		br := BandResponse{}
+		err := getJSON(fmt.Sprintf("%s/oracle/requests/%d", feed.Config.BandURL, id), deadline, &br)
+		if err != nil {
+			return BandResult{}, err
+		}
+
+		status := br.Result.Result.ResponsePacketData.ResolveStatus
+		if status == RESOLVE_STATUS_SUCCESS {
+			return br.Result, nil
+		}
+		if status != RESOLVE_STATUS_OPEN {
+			return BandResult{}, fmt.Errorf("request %d was resolved with status %d", id, status)
+		}
+
+		if time.Now().Add(cfg.PollInterval.Duration).After(deadline) {
+			return BandResult{}, fmt.Errorf("request %d was not resolved in time", id)
+		}
+		time.Sleep(cfg.PollInterval.Duration)
+	}
+}
+
+// requestBandResult submits a fresh request for the feed and waits for its result. The request must be
+// resolved within ResolveTimeout of its submission, and everything is given up at the deadline.
+func requestBandResult(cfg BandRequestConfig, feed *Feed, deadline time.Time) (BandResult, error) {
+	id, err := submitBandRequest(cfg, feed, deadline)
+	if err != nil {
+		return BandResult{}, err
+	}
+	logger.Info("band_request_submitted", "feed", feed.Name, "request_id", id)
+
+	resolveBy := time.Now().Add(cfg.ResolveTimeout.Duration)
+	if resolveBy.After(deadline) {
+		resolveBy = deadline
+	}
+	return waitBandRequest(cfg, feed, id, resolveBy)
+}
+
+// searchBandResult looks up the latest resolved request that matches the feed.
+func searchBandResult(feed *Feed, deadline time.Time) (BandResult, error) {
+	br := BandResponse{}
+	err := getJSON(feed.RequestSearchURL(), deadline, &br)
+	if err != nil {
+		return BandResult{}, err
+	}
+	return br.Result, nil
+}
+
+// getBandResult returns the result of the feed. If Band requests are enabled it asks for fresh data
+// and falls back to searching for an existing result when the request is not resolved in time. The
+// request is given up BAND_SEARCH_TIME_OUT before the deadline to leave time for the search.
+func getBandResult(feed *Feed, deadline time.Time) (BandResult, error) {
+	if BAND_REQUEST_CONFIG.Enabled {
+		result, err := requestBandResult(BAND_REQUEST_CONFIG, feed, deadline.Add(-BAND_SEARCH_TIME_OUT))
+		if err == nil {
+			return result, nil
+		}
+		logger.Warn("band_request_failed", "feed", feed.Name, "error", err)
+	}
+	return searchBandResult(feed, deadline)
+}
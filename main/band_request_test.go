@@ -0,0 +1,208 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/bandprotocol/band-terra-oracle/bandstub"
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+const (
+	STUB_LUNA_SCHEMA = "{symbol:string,multiplier:u64}/{crypto_compare_usd:i64,coin_gecko_usd:i64,huobipro_usd:i64,bittrex_usd:i64,bithumb_krw:i64,coinone_krw:i64,coinmarketcap_usd:i64}"
+	STUB_FX_SCHEMA   = "{symbols:[string],multiplier:u64}/[u64]"
+)
+
+// setupBandStub serves a bandstub with the LUNA and fx oracle scripts of the default config, and sets
+// up the feeds against it with a Band account in a test keyring.
+func setupBandStub(t *testing.T) (*bandstub.Server, Config) {
+	stub := bandstub.NewServer()
+	// LUNA is 1 USD or 1000 KRW on every source.
+	stub.SetOracleScript(13, STUB_LUNA_SCHEMA, obi.MustEncode(
+		int64(1000000), int64(1000000), int64(1000000), int64(1000000), int64(1000000000), int64(1000000000), int64(1000000),
+	))
+	// KRW, MNT and XDR in USD.
+	stub.SetOracleScript(9, STUB_FX_SCHEMA, obi.MustEncode([]uint64{1000, 400, 1250000}))
+	srv := httptest.NewServer(stub)
+	t.Cleanup(srv.Close)
+
+	kb := keys.NewInMemory()
+	_, _, err := kb.CreateMnemonic("feeder", keys.English, "12345678", keys.Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := openBandKeybase
+	openBandKeybase = func(dir string) (keys.Keybase, error) { return kb, nil }
+	t.Cleanup(func() { openBandKeybase = open })
+
+	cfg := DefaultConfig()
+	cfg.LunaPrice.BandURL = srv.URL
+	cfg.FxPrice.BandURL = srv.URL
+	cfg.BandRequest.Enabled = true
+	cfg.BandRequest.KeyringDir = t.TempDir()
+	cfg.BandRequest.KeyPassword = "12345678"
+	cfg.BandRequest.ResolveTimeout = Duration{2 * time.Second}
+	cfg.BandRequest.PollInterval = Duration{10 * time.Millisecond}
+	err = setupFeeds(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { BAND_REQUEST_CONFIG = BandRequestConfig{} })
+	return stub, cfg
+}
+
+func TestBandRequestIsPolledUntilResolved(t *testing.T) {
+	stub, cfg := setupBandStub(t)
+	stub.ResolveDelay = 50 * time.Millisecond
+
+	result, err := getBandResult(LUNA_PRICE_FEED, time.Now().Add(GET_PRICE_TIME_OUT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Result.ResponsePacketData.ClientID != cfg.BandRequest.ClientID || result.Result.ResponsePacketData.RequestID != 1 {
+		t.Errorf("expect the result of request 1 of %s but got %+v", cfg.BandRequest.ClientID, result.Result.ResponsePacketData)
+	}
+	if stub.Requests() != 1 {
+		t.Errorf("expect 1 request but got %d", stub.Requests())
+	}
+
+	// The next request is signed with the next sequence of the account.
+	_, err = getBandResult(FX_PRICE_FEED, time.Now().Add(GET_PRICE_TIME_OUT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stub.Requests() != 2 {
+		t.Errorf("expect 2 requests but got %d", stub.Requests())
+	}
+}
+
+func TestBandRequestFallsBackToSearch(t *testing.T) {
+	stub, _ := setupBandStub(t)
+	stub.ResolveDelay = -1
+	BAND_REQUEST_CONFIG.ResolveTimeout = Duration{100 * time.Millisecond}
+
+	start := time.Now()
+	result, err := getBandResult(LUNA_PRICE_FEED, time.Now().Add(GET_PRICE_TIME_OUT))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Result.ResponsePacketData.ClientID != "search" {
+		t.Errorf("expect the result of request_search but got %+v", result.Result.ResponsePacketData)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expect to give up on the request after 100ms but took %s", elapsed)
+	}
+}
+
+func TestHungBandRequestFallsBackToSearch(t *testing.T) {
+	stub, cfg := setupBandStub(t)
+	// Broadcasts hang until the client gives up, while the rest of the LCD answers.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/txs" {
+			// The server only notices the client going away once the body is read.
+			ioutil.ReadAll(r.Body)
+			<-r.Context().Done()
+			return
+		}
+		stub.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+	feed := &Feed{Name: "hung", Config: cfg.LunaPrice, Calldata: LUNA_PRICE_FEED.Calldata}
+	feed.Config.BandURL = srv.URL
+
+	start := time.Now()
+	result, err := getBandResult(feed, start.Add(BAND_SEARCH_TIME_OUT+200*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Result.ResponsePacketData.ClientID != "search" {
+		t.Errorf("expect the result of request_search but got %+v", result.Result.ResponsePacketData)
+	}
+	if elapsed := time.Since(start); elapsed > BAND_SEARCH_TIME_OUT {
+		t.Errorf("expect to give up on the broadcast after 200ms but took %s", elapsed)
+	}
+	if stub.Requests() != 0 {
+		t.Errorf("expect no requests but got %d", stub.Requests())
+	}
+}
+
+func TestSubmitBandRequestFails(t *testing.T) {
+	stub, cfg := setupBandStub(t)
+
+	stub.TxCode = 5
+	_, err := submitBandRequest(cfg.BandRequest, LUNA_PRICE_FEED, time.Now().Add(GET_PRICE_TIME_OUT))
+	if err == nil || !strings.Contains(err.Error(), "failed with code 5") {
+		t.Errorf("expect the tx to fail with code 5 but got %v", err)
+	}
+
+	// The stub rejects requests to unknown oracle scripts with 400 Bad Request.
+	stub.TxCode = 0
+	feed := &Feed{Name: "unknown", Config: LUNA_PRICE_FEED.Config, Calldata: LUNA_PRICE_FEED.Calldata}
+	feed.Config.OracleScriptID = 99
+	_, err = submitBandRequest(cfg.BandRequest, feed, time.Now().Add(GET_PRICE_TIME_OUT))
+	if err == nil || !strings.Contains(err.Error(), "responded with status 400") {
+		t.Errorf("expect the broadcast to fail with status 400 but got %v", err)
+	}
+	if stub.Requests() != 0 {
+		t.Errorf("expect no requests but got %d", stub.Requests())
+	}
+}
+
+func TestGetLUNAPricesFromBandStub(t *testing.T) {
+	setupBandStub(t)
+
+	rates, band, err := getLUNAPrices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"ukrw": "1000", "uusd": "1", "umnt": "2500", "usdr": "0.8"}
+	for denom, rate := range expect {
+		if !rates[denom].Equal(sdk.MustNewDecFromStr(rate)) {
+			t.Errorf("expect %s of %s but got %s", rate, denom, rates[denom])
+		}
+	}
+	if !band.Fx["MNT"].Equal(sdk.MustNewDecFromStr("0.0004")) {
+		t.Errorf("expect MNT at 0.0004 USD but got %s", band.Fx["MNT"])
+	}
+	if band.LunaResult == nil || band.FxResult == nil {
+		t.Errorf("expect both Band results to be recorded")
+	}
+}
+
+func TestGetLUNAPricesTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	timeout := GET_PRICE_TIME_OUT
+	defer func() { GET_PRICE_TIME_OUT = timeout }()
+	GET_PRICE_TIME_OUT = 100 * time.Millisecond
+
+	cfg := DefaultConfig()
+	cfg.LunaPrice.BandURL = srv.URL
+	cfg.FxPrice.BandURL = srv.URL
+	LUNA_PRICE_FEED, _ = NewFeed("luna_price", cfg.LunaPrice, &LUNA_PRICE_CALLDATA, LunaPrice{})
+	FX_PRICE_FEED, _ = NewFeed("fx_price", cfg.FxPrice, &FX_PRICE_CALLDATA, FxPriceUSD{})
+	LUNA_PRICE_FEED.verified = true
+	FX_PRICE_FEED.verified = true
+
+	start := time.Now()
+	_, _, err := getLUNAPrices()
+	// Either the round or the request to Band times out first.
+	if err == nil || !(strings.Contains(err.Error(), "timeout") || strings.Contains(err.Error(), "deadline exceeded")) {
+		t.Errorf("expect a timeout but got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expect to time out after 100ms but took %s", elapsed)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// command is a subcommand of the feeder binary.
+type command struct {
+	name  string
+	usage string
+	run   func(args []string) error
+}
+
+func commands() []command {
+	return []command{
+		{"start", "run the feeder until it is stopped, which is also what no command does", runStart},
+		{"prices", "fetch the prices from the fallback chain and print them", runPrices},
+		{"params", "print the params of the oracle module", runParams},
+		{"prevotes", "print the prevotes of the validator that are on chain", runPrevotes},
+		{"vote-once", "prevote in the next vote period and reveal the votes in the one after", runVoteOnce},
+		{"config", "validate the config file with config validate", runConfig},
+		{"audit", "print the records of a round or a height from the audit log", runAuditQuery},
+		{"replay", "replay recorded quotes through the aggregation and compare with on-chain rates", runReplay},
+	}
+}
+
+func printUsage() {
+	fmt.Fprintf(os.Stderr, "Usage: %s [command] [flags]\n\nCommands:\n", os.Args[0])
+	for _, c := range commands() {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", c.name, c.usage)
+	}
+	fmt.Fprintf(os.Stderr, "\nRun %s [command] -h for the flags of a command.\n", os.Args[0])
+}
+
+// runCommand runs the command named by the first argument, or start if the arguments begin with
+// a flag, and exits if it fails.
+func runCommand(args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		args = append([]string{"start"}, args...)
+	}
+	if args[0] == "help" {
+		printUsage()
+		return
+	}
+	for _, c := range commands() {
+		if c.name != args[0] {
+			continue
+		}
+		err := c.run(args[1:])
+		if err != nil {
+			logger.Error("command_failed", "command", c.name, "error", err)
+			os.Exit(1)
+		}
+		return
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	printUsage()
+	os.Exit(2)
+}
+
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ExitOnError)
+}
+
+func configFlag(fs *flag.FlagSet) *string {
+	return fs.String("config", "", "path to the JSON config file, the default config is used if empty")
+}
+
+// loadConfig loads the config and sets up the logger from it, exiting if either fails.
+func loadConfig(path string) Config {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		fatal("config_load_failed", err)
+	}
+	err = setupLogger(cfg.Log)
+	if err != nil {
+		fatal("config_invalid", err)
+	}
+	return cfg
+}
+
+// setupFeeder sets up the Band feeds of the config and returns the feeder, exiting if the feeds
+// cannot be set up.
+func setupFeeder(cfg Config) Feeder {
+	err := setupFeeds(cfg)
+	if err != nil {
+		fatal("feed_setup_failed", err)
+	}
+	return NewFeeder()
+}
+
+// setupEngine returns the round engine of the feeder with the submit timing and the audit log of
+// the config, exiting if either cannot be used. The params of the feeder must be loaded.
+func setupEngine(cfg Config, feeder *Feeder) *RoundEngine {
+	err := cfg.SubmitTiming.Validate(feeder.Params.VotePeriod)
+	if err != nil {
+		fatal("config_invalid", fmt.Errorf("invalid submit timing: %v", err))
+	}
+
+	engine := NewRoundEngine(feeder, feeder, feeder, systemClock{}, feeder.validator, feeder.Params)
+	engine.Timing = cfg.SubmitTiming
+	if cfg.Audit.Path != "" {
+		auditLog, err := OpenAuditLog(cfg.Audit)
+		if err != nil {
+			fatal("audit_open_failed", err)
+		}
+		engine.Audit = auditLog
+	}
+	return engine
+}
+
+func printJSON(v interface{}) error {
+	bz, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(bz))
+	return nil
+}
+
+// runPrices is the prices command.
+func runPrices(args []string) error {
+	fs := newFlagSet("prices")
+	configPath := configFlag(fs)
+	band := fs.Bool("band", false, "also print the raw Band results")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	feeder := setupFeeder(cfg)
+
+	_, err := feeder.Prices()
+	fetch := feeder.LastFetch()
+	if !*band {
+		fetch.Band.LunaResult = nil
+		fetch.Band.FxResult = nil
+	}
+	perr := printJSON(fetch)
+	if err != nil {
+		return err
+	}
+	return perr
+}
+
+// runParams is the params command.
+func runParams(args []string) error {
+	fs := newFlagSet("params")
+	configPath := configFlag(fs)
+	fs.Parse(args)
+
+	loadConfig(*configPath)
+	feeder := NewFeeder()
+
+	err := feeder.fetchParams()
+	if err != nil {
+		return err
+	}
+	return printJSON(feeder.Params)
+}
+
+// runPrevotes is the prevotes command.
+func runPrevotes(args []string) error {
+	fs := newFlagSet("prevotes")
+	configPath := configFlag(fs)
+	validator := fs.String("validator", "", "validator to print the prevotes of, the feeder's validator if empty")
+	fs.Parse(args)
+
+	loadConfig(*configPath)
+	feeder := NewFeeder()
+
+	val := feeder.validator
+	if *validator != "" {
+		var err error
+		val, err = sdk.ValAddressFromBech32(*validator)
+		if err != nil {
+			return fmt.Errorf("invalid validator %s: %v", *validator, err)
+		}
+	}
+
+	prevotes, err := feeder.Prevotes(val)
+	if err != nil {
+		return err
+	}
+	return printJSON(prevotes)
+}
+
+// runVoteOnce is the vote-once command. It runs rounds like the start command until one round
+// prevoted and, unless -prevote-only, the next one revealed the votes, and prints the
+// transaction of each round. The votes of earlier rounds are not known, so the first round only
+// prevotes. The round that reveals does not prevote new votes.
+func runVoteOnce(args []string) error {
+	fs := newFlagSet("vote-once")
+	configPath := configFlag(fs)
+	prevoteOnly := fs.Bool("prevote-only", false, "stop after the round that prevotes")
+	timeout := fs.Duration("timeout", 5*time.Minute, "how long to wait for the rounds to be confirmed")
+	fs.Parse(args)
+
+	cfg := loadConfig(*configPath)
+	feeder := setupFeeder(cfg)
+
+	err := feeder.fetchParams()
+	if err != nil {
+		return err
+	}
+	engine := setupEngine(cfg, &feeder)
+
+	rounds := 2
+	if *prevoteOnly {
+		rounds = 1
+	}
+	deadline := time.Now().Add(*timeout)
+	for confirmed := 0; confirmed < rounds; {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("%d of %d rounds were confirmed within %s", confirmed, rounds, *timeout)
+		}
+
+		status, err := feeder.terraClient.Status()
+		if err != nil {
+			return err
+		}
+		feeder.LatestBlockHeight = status.SyncInfo.LatestBlockHeight
+
+		last := engine.LastPrevoteRound
+		err = engine.Step(feeder.LatestBlockHeight)
+		if err != nil {
+			return err
+		}
+		if engine.LastPrevoteRound != last {
+			confirmed++
+			// The round after the prevotes only reveals them, leaving no prevotes behind.
+			engine.RevealOnly = true
+			snapshot := engine.Snapshot()
+			err = printJSON(TxStatus{
+				Round:  snapshot.LastTxRound,
+				Hash:   snapshot.LastTx.TxHash,
+				Code:   snapshot.LastTx.Code,
+				Height: snapshot.LastTx.Height,
+			})
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		time.Sleep(1 * time.Second)
+	}
+	return nil
+}
+
+// runConfig is the config command, whose only subcommand is validate.
+func runConfig(args []string) error {
+	if len(args) == 0 || args[0] != "validate" {
+		return fmt.Errorf("unknown config command, expect validate")
+	}
+	return runConfigValidate(args[1:])
+}
+
+// runConfigValidate checks that the config can be loaded, its feeds match their oracle scripts and
+// its submit timing fits the vote period of the chain. Checks that need Band or the Terra node are
+// skipped with a warning when they cannot be reached.
+func runConfigValidate(args []string) error {
+	fs := newFlagSet("config validate")
+	configPath := configFlag(fs)
+	fs.Parse(args)
+
+	cfg, err := LoadConfig(*configPath)
+	if err != nil {
+		return err
+	}
+	_, err = newLogger(cfg.Log, ioutil.Discard)
+	if err != nil {
+		return err
+	}
+	err = setupFeeds(cfg)
+	if err != nil {
+		return err
+	}
+
+	feeder := NewFeeder()
+	err = feeder.fetchParams()
+	if err != nil {
+		logger.Warn("submit_timing_unchecked", "error", err)
+	} else {
+		err = cfg.SubmitTiming.Validate(feeder.Params.VotePeriod)
+		if err != nil {
+			return fmt.Errorf("invalid submit timing: %v", err)
+		}
+	}
+
+	fmt.Println("config is valid")
+	return nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"time"
+)
+
+// Duration is a time.Duration that is written as a string such as "10s" in the config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(bz []byte) error {
+	var s string
+	err := json.Unmarshal(bz, &s)
+	if err != nil {
+		return err
+	}
+	d.Duration, err = time.ParseDuration(s)
+	return err
+}
+
+// FeedConfig describes how to ask Band for the result of an oracle script.
+type FeedConfig struct {
+	BandURL        string          `json:"band_url"`
+	OracleScriptID uint64          `json:"oracle_script_id"`
+	Calldata       json.RawMessage `json:"calldata"`
+	MinCount       uint64          `json:"min_count"`
+	AskCount       uint64          `json:"ask_count"`
+	ResultSchema   string          `json:"result_schema"`
+	Verify         VerifyConfig    `json:"verify"`
+}
+
+// BandRequestConfig describes the Band account used to submit fresh oracle requests.
+type BandRequestConfig struct {
+	Enabled        bool     `json:"enabled"`
+	ChainID        string   `json:"chain_id"`
+	KeyringDir     string   `json:"keyring_dir"`
+	KeyName        string   `json:"key_name"`
+	KeyPassword    string   `json:"key_password"`
+	ClientID       string   `json:"client_id"`
+	Gas            uint64   `json:"gas"`
+	Fees           string   `json:"fees"`
+	ResolveTimeout Duration `json:"resolve_timeout"`
+	PollInterval   Duration `json:"poll_interval"`
+}
+
+type Config struct {
+	LunaPrice    FeedConfig        `json:"luna_price"`
+	FxPrice      FeedConfig        `json:"fx_price"`
+	BandRequest  BandRequestConfig `json:"band_request"`
+	SubmitTiming SubmitTiming      `json:"submit_timing"`
+	Log          LogConfig         `json:"log"`
+	Status       StatusConfig      `json:"status"`
+	Alert        AlertConfig       `json:"alert"`
+	Audit        AuditConfig       `json:"audit"`
+}
+
+func DefaultConfig() Config {
+	return Config{
+		LunaPrice: FeedConfig{
+			BandURL:        "http://poa-api.bandchain.org",
+			OracleScriptID: 13,
+			Calldata:       json.RawMessage(`{"symbol":"LUNA","multiplier":1000000}`),
+			MinCount:       3,
+			AskCount:       4,
+			ResultSchema:   "{crypto_compare_usd:i64,coin_gecko_usd:i64,huobipro_usd:i64,bittrex_usd:i64,bithumb_krw:i64,coinone_krw:i64,coinmarketcap_usd:i64}",
+			Verify:         VerifyConfig{Tolerance: 0.1, MinReporters: 3},
+		},
+		FxPrice: FeedConfig{
+			BandURL:        "http://poa-api.bandchain.org",
+			OracleScriptID: 9,
+			Calldata:       json.RawMessage(`{"symbols":["KRW","MNT","XDR"],"multiplier":1000000}`),
+			MinCount:       3,
+			AskCount:       4,
+			ResultSchema:   "[u64]",
+			Verify:         VerifyConfig{Tolerance: 0.1, MinReporters: 3},
+		},
+		BandRequest: BandRequestConfig{
+			Enabled:        false,
+			ChainID:        "band-guanyu-poa",
+			KeyName:        "feeder",
+			ClientID:       "band-terra-oracle",
+			Gas:            1000000,
+			Fees:           "",
+			ResolveTimeout: Duration{15 * time.Second},
+			PollInterval:   Duration{1 * time.Second},
+		},
+		SubmitTiming: DefaultSubmitTiming(),
+		Log:          DefaultLogConfig(),
+		Status:       DefaultStatusConfig(),
+		Alert:        DefaultAlertConfig(),
+		Audit:        DefaultAuditConfig(),
+	}
+}
+
+// LoadConfig reads the config from a JSON file. Fields that are not in the file keep their default values.
+// An empty path gives the default config.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	bz, err := ioutil.ReadFile(path)
+	if err != nil {
+		return Config{}, err
+	}
+
+	err = json.Unmarshal(bz, &cfg)
+	if err != nil {
+		return Config{}, fmt.Errorf("fail to unmarshal config %s, %v", path, err)
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+const (
+	BAND_PRICE_SOURCE  = "band"
+	CACHE_PRICE_SOURCE = "cache"
+)
+
+// DirectPriceProvider fetches LUNA prices straight from an exchange or an aggregator.
+// It is used when Band fails to provide the price of some denoms.
+type DirectPriceProvider struct {
+	Name  string
+	Fetch func() (map[string]sdk.Dec, error)
+}
+
+// SourcePrices is what a price source returned when the prices were fetched from it.
+type SourcePrices struct {
+	Prices map[string]sdk.Dec `json:"prices,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+// PriceFetch is what the feeder saw when it resolved the prices by going down the fallback chain.
+type PriceFetch struct {
+	Band BandPrices `json:"band"`
+	// Sources are the prices of every source that was asked, Band included.
+	Sources map[string]SourcePrices `json:"sources"`
+	// Prices are the resolved prices, and Tiers the source each of them was taken from.
+	Prices map[string]sdk.Dec `json:"prices"`
+	Tiers  map[string]string  `json:"tiers"`
+}
+
+// Fallback constants
+var (
+	PRICE_CACHE_MAX_AGE    = 5 * time.Minute
+	COINGECKO_END_POINT    = "https://api.coingecko.com/api/v3/simple/price?ids=terra-luna&vs_currencies=krw,usd,mnt,xdr"
+	COINGECKO_CURRENCIES   = map[string]string{"ukrw": "krw", "uusd": "usd", "umnt": "mnt", "usdr": "xdr"}
+	DIRECT_PRICE_PROVIDERS = []DirectPriceProvider{
+		{Name: "coingecko", Fetch: getLUNAPricesFromCoinGecko},
+	}
+)
+
+func decFromJSONNumber(n json.Number) (sdk.Dec, error) {
+	dec, err := sdk.NewDecFromStr(n.String())
+	if err == nil {
+		return dec, nil
+	}
+	// Very small or very large numbers come in exponent notation which sdk.Dec cannot parse.
+	f, ferr := n.Float64()
+	if ferr != nil {
+		return sdk.Dec{}, ferr
+	}
+	return sdk.NewDecFromStr(strconv.FormatFloat(f, 'f', sdk.Precision, 64))
+}
+
+func getLUNAPricesFromCoinGecko() (map[string]sdk.Dec, error) {
+	httpClient := http.Client{Timeout: GET_PRICE_TIME_OUT}
+	resp, err := httpClient.Get(COINGECKO_END_POINT)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("coingecko responded with status %d, %s", resp.StatusCode, string(body[:]))
+	}
+
+	var cg map[string]map[string]json.Number
+	err = json.Unmarshal(body, &cg)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unmarshal luna price from coingecko, %v, %s", err, string(body[:]))
+	}
+
+	result := map[string]sdk.Dec{}
+	for denom, currency := range COINGECKO_CURRENCIES {
+		n, ok := cg["terra-luna"][currency]
+		if !ok {
+			continue
+		}
+		price, err := decFromJSONNumber(n)
+		if err != nil {
+			return nil, fmt.Errorf("fail to parse %s price from coingecko, %v", currency, err)
+		}
+		if price.IsPositive() {
+			result[denom] = price
+		}
+	}
+
+	return result, nil
+}
+
+// getPricesWithFallback resolves the price of every active denom by going down the fallback chain:
+// Band first, then each direct price provider in order, and finally the freshest cached price
+// that is not older than PRICE_CACHE_MAX_AGE. It only fails if some denom cannot be resolved by any tier.
+func (f *Feeder) getPricesWithFallback() (map[string]sdk.Dec, error) {
+	now := time.Now()
+	result := map[string]sdk.Dec{}
+	tiers := map[string]string{}
+	fetch := PriceFetch{Sources: map[string]SourcePrices{}, Prices: result, Tiers: tiers}
+	defer func() { f.lastFetch = fetch }()
+	// A source that is not queried this time, such as a provider skipped because Band resolved
+	// every denom, keeps no error from an earlier fetch.
+	f.sourceErrors = map[string]error{}
+
+	record := func(source string, prices map[string]sdk.Dec, err error) {
+		f.sourceErrors[source] = err
+		if err != nil {
+			fetch.Sources[source] = SourcePrices{Error: err.Error()}
+		} else {
+			fetch.Sources[source] = SourcePrices{Prices: prices}
+		}
+	}
+	collect := func(source string, prices map[string]sdk.Dec) {
+		for _, denom := range activeDenoms {
+			price, ok := prices[denom]
+			if !ok {
+				continue
+			}
+			f.priceCache.Set(source, denom, price, now)
+			if _, resolved := result[denom]; !resolved {
+				result[denom] = price
+				tiers[denom] = source
+			}
+		}
+	}
+
+	bandPrices, band, err := f.fetchBand()
+	fetch.Band = band
+	record(BAND_PRICE_SOURCE, bandPrices, err)
+	if err != nil {
+		logger.Warn("price_source_failed", "source", BAND_PRICE_SOURCE, "error", err)
+	} else {
+		collect(BAND_PRICE_SOURCE, bandPrices)
+	}
+
+	for _, provider := range DIRECT_PRICE_PROVIDERS {
+		if len(result) == len(activeDenoms) {
+			break
+		}
+		prices, err := provider.Fetch()
+		record(provider.Name, prices, err)
+		if err != nil {
+			logger.Warn("price_source_failed", "source", provider.Name, "error", err)
+			continue
+		}
+		collect(provider.Name, prices)
+	}
+
+	for _, denom := range activeDenoms {
+		if _, resolved := result[denom]; resolved {
+			continue
+		}
+		cp, ok := f.priceCache.Freshest(denom, PRICE_CACHE_MAX_AGE, now)
+		if !ok {
+			continue
+		}
+		result[denom] = cp.Value
+		tiers[denom] = fmt.Sprintf("%s(%s, %s old)", CACHE_PRICE_SOURCE, cp.Source, now.Sub(cp.UpdatedAt).Round(time.Second))
+	}
+
+	for _, denom := range activeDenoms {
+		if _, resolved := result[denom]; !resolved {
+			return nil, fmt.Errorf("fail to get %s price from every tier", denom)
+		}
+		logger.Info("price_resolved", "denom", denom, "rate", result[denom], "source", tiers[denom])
+	}
+
+	return result, nil
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+func decs(prices map[string]string) map[string]sdk.Dec {
+	res := map[string]sdk.Dec{}
+	for denom, price := range prices {
+		res[denom] = sdk.MustNewDecFromStr(price)
+	}
+	return res
+}
+
+type stubProvider struct {
+	prices map[string]sdk.Dec
+	err    error
+	calls  int
+}
+
+func (p *stubProvider) provider(name string) DirectPriceProvider {
+	return DirectPriceProvider{Name: name, Fetch: func() (map[string]sdk.Dec, error) {
+		p.calls++
+		return p.prices, p.err
+	}}
+}
+
+func TestGetPricesWithFallback(t *testing.T) {
+	all := decs(map[string]string{"ukrw": "1000", "uusd": "0.8", "umnt": "2300", "usdr": "0.6"})
+	errDown := errors.New("down")
+
+	testCases := []struct {
+		name string
+		band map[string]sdk.Dec
+		// bandErr fails the Band tier.
+		bandErr   error
+		primary   stubProvider
+		secondary stubProvider
+		// cached are prices cached by source and denom, and cacheAge how old they are.
+		cached   map[string]map[string]sdk.Dec
+		cacheAge time.Duration
+
+		expectTiers map[string]string
+		// expectCalls are the calls of the primary and secondary providers.
+		expectCalls [2]int
+		expectErr   string
+	}{
+		{
+			name:        "band resolves every denom",
+			band:        all,
+			expectTiers: map[string]string{"ukrw": "band", "uusd": "band", "umnt": "band", "usdr": "band"},
+			expectCalls: [2]int{0, 0},
+		},
+		{
+			name:        "primary provider replaces band",
+			bandErr:     errDown,
+			primary:     stubProvider{prices: all},
+			expectTiers: map[string]string{"ukrw": "primary", "uusd": "primary", "umnt": "primary", "usdr": "primary"},
+			expectCalls: [2]int{1, 0},
+		},
+		{
+			name:        "providers fill in each other's denoms",
+			bandErr:     errDown,
+			primary:     stubProvider{prices: decs(map[string]string{"ukrw": "1000", "uusd": "0.8"})},
+			secondary:   stubProvider{prices: decs(map[string]string{"uusd": "0.9", "umnt": "2300", "usdr": "0.6"})},
+			expectTiers: map[string]string{"ukrw": "primary", "uusd": "primary", "umnt": "secondary", "usdr": "secondary"},
+			expectCalls: [2]int{1, 1},
+		},
+		{
+			name:        "failed provider is skipped",
+			bandErr:     errDown,
+			primary:     stubProvider{err: errDown},
+			secondary:   stubProvider{prices: all},
+			expectTiers: map[string]string{"ukrw": "secondary", "uusd": "secondary", "umnt": "secondary", "usdr": "secondary"},
+			expectCalls: [2]int{1, 1},
+		},
+		{
+			name:      "fresh cache fills in the rest",
+			bandErr:   errDown,
+			primary:   stubProvider{prices: decs(map[string]string{"ukrw": "1000", "uusd": "0.8"})},
+			secondary: stubProvider{err: errDown},
+			cached:    map[string]map[string]sdk.Dec{"band": decs(map[string]string{"umnt": "2200", "usdr": "0.5"})},
+			cacheAge:  PRICE_CACHE_MAX_AGE - time.Minute,
+			expectTiers: map[string]string{
+				"ukrw": "primary", "uusd": "primary",
+				"umnt": "cache(band, 4m0s old)", "usdr": "cache(band, 4m0s old)",
+			},
+			expectCalls: [2]int{1, 1},
+		},
+		{
+			name:        "expired cache is not used",
+			bandErr:     errDown,
+			primary:     stubProvider{prices: decs(map[string]string{"ukrw": "1000", "uusd": "0.8", "umnt": "2300"})},
+			secondary:   stubProvider{err: errDown},
+			cached:      map[string]map[string]sdk.Dec{"band": decs(map[string]string{"usdr": "0.5"})},
+			cacheAge:    PRICE_CACHE_MAX_AGE + time.Minute,
+			expectCalls: [2]int{1, 1},
+			expectErr:   "fail to get usdr price from every tier",
+		},
+	}
+
+	providers := DIRECT_PRICE_PROVIDERS
+	defer func() { DIRECT_PRICE_PROVIDERS = providers }()
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			DIRECT_PRICE_PROVIDERS = []DirectPriceProvider{tc.primary.provider("primary"), tc.secondary.provider("secondary")}
+			feeder := NewFeederWithClient(nil, nil)
+			feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) {
+				return tc.band, BandPrices{Rates: tc.band}, tc.bandErr
+			}
+			for source, prices := range tc.cached {
+				for denom, price := range prices {
+					feeder.priceCache.Set(source, denom, price, time.Now().Add(-tc.cacheAge))
+				}
+			}
+
+			prices, err := feeder.Prices()
+			calls := [2]int{tc.primary.calls, tc.secondary.calls}
+			if calls != tc.expectCalls {
+				t.Errorf("expect provider calls %v but got %v", tc.expectCalls, calls)
+			}
+			if tc.expectErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tc.expectErr) {
+					t.Fatalf("expect error %q but got %v", tc.expectErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fetch := feeder.LastFetch()
+			for _, denom := range activeDenoms {
+				if tc.expectTiers[denom] != fetch.Tiers[denom] {
+					t.Errorf("expect %s from %s but got it from %s", denom, tc.expectTiers[denom], fetch.Tiers[denom])
+				}
+				if !prices[denom].Equal(fetch.Prices[denom]) {
+					t.Errorf("expect fetch to record %s of %s but got %s", prices[denom], denom, fetch.Prices[denom])
+				}
+			}
+			if (tc.bandErr != nil) != (feeder.PriceSourceErrors()[BAND_PRICE_SOURCE] != nil) {
+				t.Errorf("expect band error %v but got %v", tc.bandErr, feeder.PriceSourceErrors()[BAND_PRICE_SOURCE])
+			}
+		})
+	}
+}
+
+func TestGetPricesWithFallbackCachesResolvedPrices(t *testing.T) {
+	providers := DIRECT_PRICE_PROVIDERS
+	defer func() { DIRECT_PRICE_PROVIDERS = providers }()
+	DIRECT_PRICE_PROVIDERS = nil
+
+	all := decs(map[string]string{"ukrw": "1000", "uusd": "0.8", "umnt": "2300", "usdr": "0.6"})
+	feeder := NewFeederWithClient(nil, nil)
+	feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) { return all, BandPrices{}, nil }
+	_, err := feeder.Prices()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Band goes down, and the prices it returned last time are used while they are fresh.
+	feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) { return nil, BandPrices{}, errors.New("down") }
+	prices, err := feeder.Prices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, denom := range activeDenoms {
+		if !prices[denom].Equal(all[denom]) {
+			t.Errorf("expect cached %s of %s but got %s", all[denom], denom, prices[denom])
+		}
+		if !strings.HasPrefix(feeder.LastFetch().Tiers[denom], "cache(band, ") {
+			t.Errorf("expect %s from the cache but got it from %s", denom, feeder.LastFetch().Tiers[denom])
+		}
+	}
+}
+
+func TestPriceSourceErrorsOnlyOfQueriedSources(t *testing.T) {
+	providers := DIRECT_PRICE_PROVIDERS
+	defer func() { DIRECT_PRICE_PROVIDERS = providers }()
+	all := decs(map[string]string{"ukrw": "1000", "uusd": "0.8", "umnt": "2300", "usdr": "0.6"})
+	primary := stubProvider{prices: all}
+	DIRECT_PRICE_PROVIDERS = []DirectPriceProvider{primary.provider("primary")}
+
+	feeder := NewFeederWithClient(nil, nil)
+	feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) { return nil, BandPrices{}, errors.New("down") }
+	_, err := feeder.Prices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	primary.err = errors.New("down")
+	_, err = feeder.Prices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := feeder.PriceSourceErrors(); errs[BAND_PRICE_SOURCE] == nil || errs["primary"] == nil {
+		t.Fatalf("expect band and primary errors but got %v", errs)
+	}
+
+	// Band recovers, so the primary provider is not queried and its error is dropped.
+	feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) { return all, BandPrices{}, nil }
+	_, err = feeder.Prices()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := feeder.PriceSourceErrors()
+	if _, ok := errs["primary"]; ok || len(errs) != 1 || errs[BAND_PRICE_SOURCE] != nil {
+		t.Errorf("expect only band without an error but got %v", errs)
+	}
+}
+
+func TestPriceCacheFreshest(t *testing.T) {
+	now := time.Now()
+	cache := NewPriceCache()
+	cache.Set("band", "uusd", sdk.MustNewDecFromStr("0.8"), now.Add(-2*time.Minute))
+	cache.Set("coingecko", "uusd", sdk.MustNewDecFromStr("0.9"), now.Add(-1*time.Minute))
+	cache.Set("band", "ukrw", sdk.MustNewDecFromStr("1000"), now.Add(-6*time.Minute))
+
+	cp, ok := cache.Freshest("uusd", 5*time.Minute, now)
+	if !ok || cp.Source != "coingecko" || !cp.Value.Equal(sdk.MustNewDecFromStr("0.9")) {
+		t.Errorf("expect the coingecko price but got %+v, %v", cp, ok)
+	}
+	_, ok = cache.Freshest("ukrw", 5*time.Minute, now)
+	if ok {
+		t.Errorf("expect the ukrw price to be expired")
+	}
+	_, ok = cache.Freshest("ukrw", 6*time.Minute, now)
+	if !ok {
+		t.Errorf("expect the ukrw price to be exactly max age old and fresh")
+	}
+}
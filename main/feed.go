@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// Band feeds, set up from the config at startup
+var (
+	LUNA_PRICE_FEED     *Feed
+	FX_PRICE_FEED       *Feed
+	LUNA_PRICE_CALLDATA LunaPriceCallData
+	FX_PRICE_CALLDATA   FxPriceCallData
+	BAND_REQUEST_CONFIG BandRequestConfig
+)
+
+// Feed is a FeedConfig whose calldata has been OBI encoded.
+type Feed struct {
+	Name     string
+	Config   FeedConfig
+	Calldata []byte
+
+	mtx      sync.Mutex
+	verified bool
+}
+
+// NewFeed parses the calldata of the config into the struct pointed to by calldata, encodes it with OBI
+// and checks that the result type can be decoded from the configured result schema.
+func NewFeed(name string, cfg FeedConfig, calldata interface{}, result interface{}) (*Feed, error) {
+	err := json.Unmarshal(cfg.Calldata, calldata)
+	if err != nil {
+		return nil, fmt.Errorf("fail to unmarshal calldata of %s feed, %v", name, err)
+	}
+
+	bz, err := obi.Encode(reflect.ValueOf(calldata).Elem().Interface())
+	if err != nil {
+		return nil, fmt.Errorf("fail to encode calldata of %s feed, %v", name, err)
+	}
+
+	configSchema, err := obi.ParseSchema(cfg.ResultSchema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid result schema of %s feed, %v", name, err)
+	}
+	cfg.ResultSchema = configSchema.String()
+	err = obi.CheckSchema(result, cfg.ResultSchema)
+	if err != nil {
+		return nil, fmt.Errorf("result schema of %s feed does not match %T, %v", name, result, err)
+	}
+
+	return &Feed{Name: name, Config: cfg, Calldata: bz}, nil
+}
+
+func (feed *Feed) RequestSearchURL() string {
+	return fmt.Sprintf(
+		"%s/oracle/request_search?oid=%d&calldata=%x&min_count=%d&ask_count=%d",
+		feed.Config.BandURL, feed.Config.OracleScriptID, feed.Calldata, feed.Config.MinCount, feed.Config.AskCount,
+	)
+}
+
+// checkSchema compares the calldata and the result schema of the feed with the schema declared by its
+// oracle script. The calldata is re-encoded in the field order of the oracle script's input schema.
+func (feed *Feed) checkSchema(schema string, calldata interface{}) error {
+	input, output, err := splitSchema(schema)
+	if err != nil {
+		return err
+	}
+
+	err = obi.CheckSchema(calldata, input)
+	if err != nil {
+		return fmt.Errorf("calldata of %s feed does not match oracle script %d, %v", feed.Name, feed.Config.OracleScriptID, err)
+	}
+	feed.Calldata, err = obi.EncodeWithSchema(input, calldata)
+	if err != nil {
+		return err
+	}
+	if output != feed.Config.ResultSchema {
+		return fmt.Errorf("result schema of oracle script %d is %s but %s feed expects %s", feed.Config.OracleScriptID, output, feed.Name, feed.Config.ResultSchema)
+	}
+	return nil
+}
+
+// VerifySchema checks the feed against the schema declared by its oracle script, so that
+// a mismatch cannot silently mix the fields up. A successful check is remembered so that
+// the oracle script is only fetched once.
+func (feed *Feed) VerifySchema(calldata interface{}) error {
+	feed.mtx.Lock()
+	defer feed.mtx.Unlock()
+
+	if feed.verified {
+		return nil
+	}
+
+	os, err := getOracleScript(feed.Config.BandURL, feed.Config.OracleScriptID)
+	if err != nil {
+		return err
+	}
+
+	err = feed.checkSchema(os.Schema, calldata)
+	if err != nil {
+		return err
+	}
+
+	feed.verified = true
+	return nil
+}
+
+// checkFxSymbols checks that the fx_price feed asks for every symbol of FX_DENOM_SYMBOLS, so that
+// the prices it returns can be told apart by symbol.
+func checkFxSymbols(symbols []string) error {
+	seen := map[string]bool{}
+	for _, symbol := range symbols {
+		if seen[symbol] {
+			return fmt.Errorf("fx_price feed asks for %s more than once", symbol)
+		}
+		seen[symbol] = true
+	}
+	for _, denom := range activeDenoms {
+		symbol, ok := FX_DENOM_SYMBOLS[denom]
+		if ok && !seen[symbol] {
+			return fmt.Errorf("fx_price feed must ask for %s to vote for %s", symbol, denom)
+		}
+	}
+	return nil
+}
+
+// setupFeeds builds the Band feeds from the config and checks them against their oracle scripts.
+// If Band cannot be reached, the check is postponed until the feed is first used.
+func setupFeeds(cfg Config) error {
+	if cfg.BandRequest.Enabled {
+		if cfg.BandRequest.ChainID == "" || cfg.BandRequest.KeyringDir == "" || cfg.BandRequest.KeyName == "" {
+			return fmt.Errorf("band_request needs chain_id, keyring_dir and key_name when enabled")
+		}
+		if cfg.BandRequest.ResolveTimeout.Duration >= GET_PRICE_TIME_OUT-BAND_SEARCH_TIME_OUT {
+			return fmt.Errorf("band_request resolve_timeout must be shorter than %s to leave %s for request_search", GET_PRICE_TIME_OUT-BAND_SEARCH_TIME_OUT, BAND_SEARCH_TIME_OUT)
+		}
+	}
+	BAND_REQUEST_CONFIG = cfg.BandRequest
+
+	var err error
+	LUNA_PRICE_FEED, err = NewFeed("luna_price", cfg.LunaPrice, &LUNA_PRICE_CALLDATA, LunaPrice{})
+	if err != nil {
+		return err
+	}
+	FX_PRICE_FEED, err = NewFeed("fx_price", cfg.FxPrice, &FX_PRICE_CALLDATA, FxPriceUSD{})
+	if err != nil {
+		return err
+	}
+
+	if LUNA_PRICE_CALLDATA.Multiplier == 0 || LUNA_PRICE_CALLDATA.Multiplier != FX_PRICE_CALLDATA.Multiplier {
+		return fmt.Errorf("luna_price and fx_price feeds must use the same non-zero multiplier")
+	}
+	err = checkFxSymbols(FX_PRICE_CALLDATA.Symbols)
+	if err != nil {
+		return err
+	}
+
+	for _, each := range []struct {
+		feed     *Feed
+		calldata interface{}
+	}{
+		{LUNA_PRICE_FEED, LUNA_PRICE_CALLDATA},
+		{FX_PRICE_FEED, FX_PRICE_CALLDATA},
+	} {
+		os, err := getOracleScript(each.feed.Config.BandURL, each.feed.Config.OracleScriptID)
+		if err != nil {
+			logger.Warn("oracle_script_unavailable", "feed", each.feed.Name, "error", err)
+			continue
+		}
+		err = each.feed.checkSchema(os.Schema, each.calldata)
+		if err != nil {
+			return err
+		}
+		each.feed.verified = true
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	LOG_FORMAT_JSON   = "json"
+	LOG_FORMAT_LOGFMT = "logfmt"
+)
+
+// LogConfig describes the format and verbosity of the feeder logs.
+type LogConfig struct {
+	// Format is json or logfmt.
+	Format string `json:"format"`
+	// Level is debug, info, warn or error. Debug adds a line for every block the feeder sees.
+	Level string `json:"level"`
+}
+
+func DefaultLogConfig() LogConfig {
+	return LogConfig{Format: LOG_FORMAT_JSON, Level: "info"}
+}
+
+// logger is where the feeder writes its events. Every event has a snake_case name as its message,
+// and the values it is about as fields, e.g. round, height, denom, source, tx_hash and error.
+var logger = slog.New(slog.NewJSONHandler(os.Stderr, nil))
+
+// newLogger returns a logger that writes to w as described by the config.
+func newLogger(cfg LogConfig, w io.Writer) (*slog.Logger, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(cfg.Level))
+	if err != nil {
+		return nil, fmt.Errorf("invalid log level %q, expect debug, info, warn or error", cfg.Level)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", LOG_FORMAT_JSON:
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	case LOG_FORMAT_LOGFMT:
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("invalid log format %q, expect %s or %s", cfg.Format, LOG_FORMAT_JSON, LOG_FORMAT_LOGFMT)
+	}
+}
+
+// setupLogger replaces the logger of the feeder with one described by the config.
+func setupLogger(cfg LogConfig) error {
+	l, err := newLogger(cfg, os.Stderr)
+	if err != nil {
+		return err
+	}
+	logger = l
+	return nil
+}
+
+// fatal logs the event with the error and exits.
+func fatal(event string, err error) {
+	logger.Error(event, "error", err)
+	os.Exit(1)
+}
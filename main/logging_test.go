@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(LogConfig{Format: "JSON", Level: "warn"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("round_started", "round", 7)
+	l.Warn("band_request_failed", "round", 7, "feed", "luna_price")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expect only the warning to be logged at warn level but got %q", buf.String())
+	}
+	event := map[string]interface{}{}
+	err = json.Unmarshal([]byte(lines[0]), &event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event["level"] != "WARN" || event["msg"] != "band_request_failed" || event["round"] != 7.0 || event["feed"] != "luna_price" {
+		t.Errorf("expect the warning with its fields but got %v", event)
+	}
+}
+
+func TestNewLoggerLogfmt(t *testing.T) {
+	var buf bytes.Buffer
+	l, err := newLogger(LogConfig{Format: LOG_FORMAT_LOGFMT, Level: "debug"}, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("block", "height", 105)
+	if out := buf.String(); !strings.Contains(out, "level=DEBUG msg=block height=105") {
+		t.Errorf("expect a logfmt debug line but got %q", out)
+	}
+}
+
+func TestNewLoggerLevels(t *testing.T) {
+	for _, tc := range []struct {
+		level  string
+		logged []string
+	}{
+		{"debug", []string{"debug", "info", "warn", "error"}},
+		{"INFO", []string{"info", "warn", "error"}},
+		{"warn", []string{"warn", "error"}},
+		{"error", []string{"error"}},
+	} {
+		var buf bytes.Buffer
+		l, err := newLogger(LogConfig{Format: LOG_FORMAT_LOGFMT, Level: tc.level}, &buf)
+		if err != nil {
+			t.Fatalf("level %q returned %v", tc.level, err)
+		}
+		l.Debug("debug")
+		l.Info("info")
+		l.Warn("warn")
+		l.Error("error")
+
+		logged := []string{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			logged = append(logged, strings.TrimPrefix(line[strings.Index(line, "msg="):], "msg="))
+		}
+		if strings.Join(logged, ",") != strings.Join(tc.logged, ",") {
+			t.Errorf("level %q logged %v, expect %v", tc.level, logged, tc.logged)
+		}
+	}
+}
+
+func TestNewLoggerRejectsInvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		cfg LogConfig
+		err string
+	}{
+		{LogConfig{Format: LOG_FORMAT_JSON, Level: "verbose"}, `invalid log level "verbose"`},
+		{LogConfig{Format: LOG_FORMAT_JSON, Level: ""}, `invalid log level ""`},
+		{LogConfig{Format: "xml", Level: "info"}, `invalid log format "xml"`},
+	} {
+		_, err := newLogger(tc.cfg, &bytes.Buffer{})
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("expect %+v to fail with %q but got %v", tc.cfg, tc.err, err)
+		}
+	}
+}
+
+func TestSetupLogger(t *testing.T) {
+	l := logger
+	defer func() { logger = l }()
+
+	err := setupLogger(LogConfig{Format: LOG_FORMAT_LOGFMT, Level: "verbose"})
+	if err == nil {
+		t.Fatal("expect an invalid level to be rejected")
+	}
+	if logger != l {
+		t.Errorf("expect the logger to be kept after an invalid config")
+	}
+
+	err = setupLogger(DefaultLogConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logger == l {
+		t.Errorf("expect the logger to be replaced")
+	}
+}
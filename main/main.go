@@ -2,18 +2,15 @@ package main
 
 import (
 	"crypto/rand"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
-	"log"
-	"net/http"
-	"runtime"
+	"os"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/cosmos/cosmos-sdk/client/context"
 	"github.com/cosmos/cosmos-sdk/crypto/keys"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
 	client "github.com/tendermint/tendermint/rpc/client/http"
 	"github.com/terra-project/core/app"
 
@@ -39,23 +36,26 @@ var (
 
 // Band constants
 var (
-	GET_PRICE_TIME_OUT   = 20 * time.Second
-	MULTIPLIER           = int64(1000000)
-	LUNA_PRICE_CALLDATA  = LunaPriceCallData{Symbol: "LUNA", Multiplier: MULTIPLIER}
-	FX_PRICE_CALLDATA    = FxPriceCallData{Symbols: []string{"KRW", "MNT", "XDR"}, Multiplier: MULTIPLIER}
-	LUNA_PRICE_END_POINT = fmt.Sprintf("http://poa-api.bandchain.org/oracle/request_search?oid=13&calldata=%x&min_count=3&ask_count=4", LUNA_PRICE_CALLDATA.toBytes())
-	FX_PRICE_END_POINT   = fmt.Sprintf("http://poa-api.bandchain.org/oracle/request_search?oid=9&calldata=%x&min_count=3&ask_count=4", FX_PRICE_CALLDATA.toBytes())
+	GET_PRICE_TIME_OUT     = 20 * time.Second
+	MIN_VALID_LUNA_SOURCES = 3
+	// BAND_SEARCH_TIME_OUT is the part of GET_PRICE_TIME_OUT left for request_search after a Band request.
+	BAND_SEARCH_TIME_OUT = 3 * time.Second
 )
 
 // General constants
 var (
 	cdc          = app.MakeCodec()
 	activeDenoms = []string{"ukrw", "uusd", "umnt", "usdr"}
+	// FX_DENOM_SYMBOLS are the fx_price symbols whose USD prices convert LUNA prices into the denoms.
+	// KRW also converts the prices of the KRW sources into USD.
+	FX_DENOM_SYMBOLS = map[string]string{"ukrw": "KRW", "umnt": "MNT", "usdr": "XDR"}
 )
 
+//go:generate go run ../cmd/obigen -type LunaPriceCallData,FxPriceCallData,LunaPrice
+
 type LunaPriceCallData struct {
-	Symbol     string
-	Multiplier int64
+	Symbol     string `json:"symbol" obi:"symbol"`
+	Multiplier uint64 `json:"multiplier" obi:"multiplier"`
 }
 
 type BandResponse struct {
@@ -121,45 +121,65 @@ type BandResult struct {
 }
 
 type LunaPrice struct {
-	CryptoCompareUSD int64
-	CoinGeckoUSD     int64
-	HuobiproUSD      int64
-	BittrexUSD       int64
-	BithumbKRW       int64
-	CoinoneKRW       int64
-	CoinmarketcapUSD int64
+	CryptoCompareUSD LunaPriceDec `obi:"crypto_compare_usd"`
+	CoinGeckoUSD     LunaPriceDec `obi:"coin_gecko_usd"`
+	HuobiproUSD      LunaPriceDec `obi:"huobipro_usd"`
+	BittrexUSD       LunaPriceDec `obi:"bittrex_usd"`
+	BithumbKRW       LunaPriceDec `obi:"bithumb_krw"`
+	CoinoneKRW       LunaPriceDec `obi:"coinone_krw"`
+	CoinmarketcapUSD LunaPriceDec `obi:"coinmarketcap_usd"`
+}
+
+type LunaSourcePrice struct {
+	Source   string  `json:"source"`
+	Currency string  `json:"currency"`
+	Price    sdk.Dec `json:"price"`
+}
+
+// Sources lists the price reported by every source in the LunaPrice result.
+func (lp LunaPrice) Sources() []LunaSourcePrice {
+	return []LunaSourcePrice{
+		{Source: "bithumb", Currency: "KRW", Price: lp.BithumbKRW.Dec},
+		{Source: "coinone", Currency: "KRW", Price: lp.CoinoneKRW.Dec},
+		{Source: "bittrex", Currency: "USD", Price: lp.BittrexUSD.Dec},
+		{Source: "coingecko", Currency: "USD", Price: lp.CoinGeckoUSD.Dec},
+		{Source: "cryptocompare", Currency: "USD", Price: lp.CryptoCompareUSD.Dec},
+		{Source: "huobipro", Currency: "USD", Price: lp.HuobiproUSD.Dec},
+		{Source: "coinmarketcap", Currency: "USD", Price: lp.CoinmarketcapUSD.Dec},
+	}
 }
 
-type FxPriceUSD []uint64
+type FxPriceUSD []FxPriceDec
+
+// BandPrices is what Band returned when the LUNA prices were fetched from it.
+type BandPrices struct {
+	// LunaResult and FxResult are the results of the requests of the feeds.
+	LunaResult *BandResult `json:"luna_result,omitempty"`
+	FxResult   *BandResult `json:"fx_result,omitempty"`
+	// Luna and Fx are the prices decoded from the results, Fx by symbol.
+	Luna []LunaSourcePrice  `json:"luna,omitempty"`
+	Fx   map[string]sdk.Dec `json:"fx,omitempty"`
+	// Rates are the LUNA prices of the denoms aggregated from Luna and Fx.
+	Rates map[string]sdk.Dec `json:"rates,omitempty"`
+}
 
 type Feeder struct {
-	terraClient       *client.HTTP
+	terraClient       rpcclient.Client
 	Params            terra_types.Params
 	validator         sdk.ValAddress
-	LastPrevoteRound  int64
 	LatestBlockHeight int64
-	votes             map[string]terra_types.MsgExchangeRateVote
-}
-
-func (cd *LunaPriceCallData) toBytes() []byte {
-	b, err := obi.Encode(*cd)
-	if err != nil {
-		panic(err)
-	}
-	return b
+	priceCache        *PriceCache
+	// fetchBand fetches the prices of the Band tier of the fallback chain.
+	fetchBand func() (map[string]sdk.Dec, BandPrices, error)
+	// sourceErrors are the errors of every price source queried in the last fetch, nil if it succeeded.
+	sourceErrors map[string]error
+	// lastFetch is what the feeder saw when it last resolved the prices.
+	lastFetch PriceFetch
 }
 
 type FxPriceCallData struct {
-	Symbols    []string
-	Multiplier int64
-}
-
-func (cd *FxPriceCallData) toBytes() []byte {
-	b, err := obi.Encode(*cd)
-	if err != nil {
-		panic(err)
-	}
-	return b
+	Symbols    []string `json:"symbols" obi:"symbols"`
+	Multiplier uint64   `json:"multiplier" obi:"multiplier"`
 }
 
 // GenerateRandomBytes returns securely generated random bytes.
@@ -193,20 +213,6 @@ func generateRandomString(n int) (string, error) {
 	return string(bytes), nil
 }
 
-func logError(err error) {
-	pc, fn, line, _ := runtime.Caller(1)
-	log.Printf("‼️ %s[%s:%d] %v", runtime.FuncForPC(pc).Name(), fn, line, err)
-}
-
-func printStatus(head string, status string, res *sdk.TxResponse) {
-	tail := "✧･ﾟ✨:* success *:✨･ﾟ✧"
-	if res.Code != 0 {
-		head = "🚫"
-		tail = "fail ⁉️"
-	}
-	fmt.Printf("%s %s : %s : %s \n", head, status, res.TxHash, tail)
-}
-
 func decsPretty(decs []sdk.Dec) string {
 	tmp := []string{}
 	for _, dec := range decs {
@@ -220,108 +226,69 @@ func decsPretty(decs []sdk.Dec) string {
 	return fmt.Sprintf("%v", tmp)
 }
 
-func (f *Feeder) fetchParams() {
+// fetchParams queries the params of the oracle module into Params.
+func (f *Feeder) fetchParams() error {
 	res, err := f.terraClient.ABCIQuery(fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryParameters), nil)
 	if err != nil {
-		logError(err)
-		return
+		return fmt.Errorf("fail to query params: %v", err)
 	}
-
-	err = cdc.UnmarshalJSON(res.Response.GetValue(), &f.Params)
-	if err != nil {
-		logError(fmt.Errorf("Fail to unmarshal Params json: %v", err))
-		return
+	if !res.Response.IsOK() {
+		return fmt.Errorf("fail to query params: %s", res.Response.Log)
 	}
-}
 
-func (f *Feeder) commitNewVotes(prices map[string]sdk.Dec) {
-	// Salt legnth should be 1~4
-	// We use 4 here
-	salt, err := generateRandomString(4)
+	err = cdc.UnmarshalJSON(res.Response.GetValue(), &f.Params)
 	if err != nil {
-		fmt.Println(err.Error(), 205)
-		return
-	}
-
-	for denom, value := range prices {
-		f.votes[denom] = terra_types.NewMsgExchangeRateVote(
-			value,
-			salt,
-			denom,
-			sdk.AccAddress(f.validator),
-			f.validator,
-		)
-	}
-}
-
-func (f *Feeder) MsgPrevotesFromCurrentCommitVotes() ([]terra_types.MsgExchangeRatePrevote, error) {
-	msgs := []terra_types.MsgExchangeRatePrevote{}
-
-	for _, denom := range activeDenoms {
-		vote, ok := f.votes[denom]
-		if !ok {
-			return nil, fmt.Errorf(
-				fmt.Sprintf("MsgPrevotesFromCurrentCommitVotes: vote for %s not found in %v", denom, f.votes),
-			)
-		}
-
-		voteHash := terra_types.GetVoteHash(vote.Salt, vote.ExchangeRate, vote.Denom, f.validator)
-		msg := terra_types.NewMsgExchangeRatePrevote(
-			voteHash,
-			denom,
-			sdk.AccAddress(f.validator),
-			f.validator,
-		)
-		msgs = append(msgs, msg)
+		return fmt.Errorf("fail to unmarshal params json: %v", err)
 	}
-
-	return msgs, nil
+	return nil
 }
 
-func (f *Feeder) getPrevote() (terra_types.ExchangeRatePrevotes, error) {
+// Prevotes returns the prevotes of the validator.
+func (f *Feeder) Prevotes(validator sdk.ValAddress) (terra_types.ExchangeRatePrevotes, error) {
 	erps := terra_types.ExchangeRatePrevotes{}
-	params := terra_types.NewQueryPrevotesParams(f.validator, "")
+	params := terra_types.NewQueryPrevotesParams(validator, "")
 
 	bz, err := cdc.MarshalJSON(params)
 	if err != nil {
-		logError(fmt.Errorf("Fail to marshal prevote params: %v", err))
-		return erps, err
+		return erps, fmt.Errorf("fail to marshal prevote params: %v", err)
 	}
 
 	res, err := f.terraClient.ABCIQuery(fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryPrevotes), bz)
+	if err != nil {
+		return erps, fmt.Errorf("fail to query prevotes: %v", err)
+	}
+	if !res.Response.IsOK() {
+		return erps, fmt.Errorf("fail to query prevotes: %s", res.Response.Log)
+	}
 
 	err = cdc.UnmarshalJSON(res.Response.GetValue(), &erps)
 	if err != nil {
-		logError(fmt.Errorf("Fail to unmarshal Params json: %v", err))
-		return erps, err
+		return erps, fmt.Errorf("fail to unmarshal prevotes json: %v", err)
 	}
 
 	return erps, nil
 }
 
-func (f *Feeder) allVotesAndPrevotesAreCorrespond(prevotes terra_types.ExchangeRatePrevotes) bool {
-	for _, pv := range prevotes {
-		vote, ok := f.votes[pv.Denom]
-		if !ok {
-			return false
-		}
-		if vote.Denom != pv.Denom {
-			return false
-		}
-		voteHash := terra_types.GetVoteHash(vote.Salt, vote.ExchangeRate, vote.Denom, f.validator)
+// openTerraKeybase opens the keyring of the Terra key in dir.
+var openTerraKeybase = func(dir string) (keys.Keybase, error) {
+	return keys.NewKeyring("terra", "test", dir, nil)
+}
 
-		if voteHash.Equal(pv.Hash) {
-			return false
-		}
-	}
-	return true
+func (f *Feeder) cliContext() context.CLIContext {
+	return context.NewCLIContext().
+		WithCodec(cdc).
+		WithNodeURI(TERRA_NODE_URI).
+		WithClient(f.terraClient).
+		WithTrustNode(true).
+		WithFromAddress(sdk.AccAddress(f.validator)).
+		WithBroadcastMode("block")
 }
 
-func (f *Feeder) broadcast(msgs []sdk.Msg) (*sdk.TxResponse, error) {
-	keybase, err := keys.NewKeyring("terra", "test", TERRA_KEYBASE_DIR, nil)
+// Sign builds a transaction of the messages and signs it with the Terra key.
+func (f *Feeder) Sign(msgs []sdk.Msg) ([]byte, error) {
+	keybase, err := openTerraKeybase(TERRA_KEYBASE_DIR)
 	if err != nil {
-		logError(fmt.Errorf("Fail to create keybase from dir: %v", err))
-		return nil, err
+		return nil, fmt.Errorf("fail to create keybase from dir: %v", err)
 	}
 
 	txBldr := auth_types.NewTxBuilder(
@@ -331,18 +298,9 @@ func (f *Feeder) broadcast(msgs []sdk.Msg) (*sdk.TxResponse, error) {
 		sdk.NewDecCoins(sdk.NewDecCoin("uluna", sdk.NewInt(0))),
 	).WithKeybase(keybase)
 
-	cliCtx := context.NewCLIContext().
-		WithCodec(cdc).
-		WithClient(f.terraClient).
-		WithNodeURI(TERRA_NODE_URI).
-		WithTrustNode(true).
-		WithFromAddress(sdk.AccAddress(f.validator)).
-		WithBroadcastMode("block")
-
-	ptxBldr, err := utils.PrepareTxBuilder(txBldr, cliCtx)
+	ptxBldr, err := utils.PrepareTxBuilder(txBldr, f.cliContext())
 	if err != nil {
-		fmt.Println("Fail to prepare tx builder :", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("fail to prepare tx builder: %v", err)
 	}
 
 	txBytes, err := ptxBldr.WithChainID(TERRA_CHAIN_ID).BuildAndSign(
@@ -351,33 +309,79 @@ func (f *Feeder) broadcast(msgs []sdk.Msg) (*sdk.TxResponse, error) {
 		msgs,
 	)
 	if err != nil {
-		fmt.Println("Fail to build and sign the transaction :", err.Error())
-		return nil, err
+		return nil, fmt.Errorf("fail to build and sign the transaction: %v", err)
 	}
 
-	res, err := cliCtx.BroadcastTx(txBytes)
+	return txBytes, nil
+}
+
+// BroadcastTx broadcasts the transaction and waits for it to be included in a block.
+func (f *Feeder) BroadcastTx(txBytes []byte) (sdk.TxResponse, error) {
+	res, err := f.cliContext().BroadcastTx(txBytes)
 	if err != nil {
-		fmt.Println("Fail to broadcast to a Tendermint node :", err.Error())
-		return nil, err
+		return sdk.TxResponse{}, fmt.Errorf("fail to broadcast to a Tendermint node: %v", err)
+	}
+
+	return res, nil
+}
+
+func (f *Feeder) QueryTx(hash string) (sdk.TxResponse, error) {
+	return utils.QueryTx(f.cliContext(), hash)
+}
+
+// KeyAvailable checks that the Terra key can be loaded from the keyring.
+func (f *Feeder) KeyAvailable() error {
+	keybase, err := openTerraKeybase(TERRA_KEYBASE_DIR)
+	if err != nil {
+		return fmt.Errorf("fail to create keybase from dir: %v", err)
+	}
+	_, err = keybase.Get(TERRA_KEYNAME)
+	if err != nil {
+		return fmt.Errorf("fail to get key %s: %v", TERRA_KEYNAME, err)
+	}
+	return nil
+}
+
+// PriceSourceErrors returns the error of every price source queried in the last fetch, nil if it succeeded.
+func (f *Feeder) PriceSourceErrors() map[string]error {
+	errs := map[string]error{}
+	for source, err := range f.sourceErrors {
+		errs[source] = err
 	}
+	return errs
+}
+
+// LastFetch returns what the feeder saw when it last resolved the prices.
+func (f *Feeder) LastFetch() PriceFetch {
+	return f.lastFetch
+}
 
-	return &res, nil
+// Prices returns the price of every active denom from the fallback chain.
+func (f *Feeder) Prices() (map[string]sdk.Dec, error) {
+	return f.getPricesWithFallback()
 }
 
 func NewFeeder() Feeder {
 	valAddress, err := sdk.ValAddressFromBech32(VALIDATOR_ADDRESS)
 	if err != nil {
-		fmt.Println("Fail to parse validator address", err.Error())
-		panic(err)
+		fatal("validator_address_invalid", err)
 	}
-	feeder := Feeder{}
-	feeder.terraClient, err = client.New(TERRA_NODE_URI, "/websocket")
+	terraClient, err := client.New(TERRA_NODE_URI, "/websocket")
 	if err != nil {
-		fmt.Println("Fail to create http client", err.Error())
-		panic(err)
+		fatal("terra_client_failed", err)
 	}
+	return NewFeederWithClient(terraClient, valAddress)
+}
+
+// NewFeederWithClient returns a feeder of the validator that talks to Terra through the given
+// client, such as a terramock.Node.
+func NewFeederWithClient(terraClient rpcclient.Client, valAddress sdk.ValAddress) Feeder {
+	feeder := Feeder{}
+	feeder.terraClient = terraClient
 	feeder.validator = valAddress
-	feeder.votes = map[string]terra_types.MsgExchangeRateVote{}
+	feeder.priceCache = NewPriceCache()
+	feeder.fetchBand = getLUNAPrices
+	feeder.sourceErrors = map[string]error{}
 	return feeder
 }
 
@@ -389,52 +393,58 @@ func InitSDKConfig() {
 	config.Seal()
 }
 
-func getLUNAPriceFromDataSources() (LunaPrice, error) {
-	resp, err := http.Get(LUNA_PRICE_END_POINT)
+// getLUNAPriceFromDataSources returns the LUNA prices of the Band result, along with the result
+// once it was fetched.
+func getLUNAPriceFromDataSources(deadline time.Time) (LunaPrice, *BandResult, error) {
+	err := LUNA_PRICE_FEED.VerifySchema(LUNA_PRICE_CALLDATA)
 	if err != nil {
-		return LunaPrice{}, err
+		return LunaPrice{}, nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	result, err := getBandResult(LUNA_PRICE_FEED, deadline)
 	if err != nil {
-		return LunaPrice{}, err
+		return LunaPrice{}, nil, fmt.Errorf("fail to get luna price from ds, %v", err)
 	}
 
-	br := BandResponse{}
-	err = json.Unmarshal(body, &br)
+	var lp LunaPrice
+	err = obi.DecodeWithSchema(LUNA_PRICE_FEED.Config.ResultSchema, result.Result.ResponsePacketData.Result, &lp)
 	if err != nil {
-		return LunaPrice{}, fmt.Errorf("fail to unmarshal luna price from ds, %v, %s", err, string(body[:]))
+		return LunaPrice{}, &result, fmt.Errorf("fail to decode luna price, %v", err)
 	}
 
-	var lp LunaPrice
-	obi.Decode(br.Result.Result.ResponsePacketData.Result, &lp)
+	err = LUNA_PRICE_FEED.checkReports(result, LUNA_PRICE_CALLDATA.Multiplier)
+	if err != nil {
+		return LunaPrice{}, &result, err
+	}
 
-	return lp, nil
+	return lp, &result, nil
 }
 
-func getStandardCurrencyPrices() (FxPriceUSD, error) {
-	resp, err := http.Get(FX_PRICE_END_POINT)
+// getStandardCurrencyPrices returns the fx prices of the Band result, along with the result once
+// it was fetched.
+func getStandardCurrencyPrices(deadline time.Time) (FxPriceUSD, *BandResult, error) {
+	err := FX_PRICE_FEED.VerifySchema(FX_PRICE_CALLDATA)
 	if err != nil {
-		return FxPriceUSD{}, err
+		return FxPriceUSD{}, nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	result, err := getBandResult(FX_PRICE_FEED, deadline)
 	if err != nil {
-		return FxPriceUSD{}, err
+		return FxPriceUSD{}, nil, fmt.Errorf("fail to get fx price from ds, %v", err)
 	}
 
-	br := BandResponse{}
-	err = json.Unmarshal(body, &br)
+	var fpu FxPriceUSD
+	err = obi.DecodeWithSchema(FX_PRICE_FEED.Config.ResultSchema, result.Result.ResponsePacketData.Result, &fpu)
 	if err != nil {
-		return FxPriceUSD{}, fmt.Errorf("fail to unmarshal fx price from ds, %v, %s", err, string(body[:]))
+		return FxPriceUSD{}, &result, fmt.Errorf("fail to decode fx price, %v", err)
 	}
 
-	var fpu FxPriceUSD
-	obi.Decode(br.Result.Result.ResponsePacketData.Result, &fpu)
+	err = FX_PRICE_FEED.checkReports(result, FX_PRICE_CALLDATA.Multiplier)
+	if err != nil {
+		return FxPriceUSD{}, &result, err
+	}
 
-	return fpu, nil
+	return fpu, &result, nil
 }
 
 func medianDec(decs []sdk.Dec) sdk.Dec {
@@ -444,40 +454,53 @@ func medianDec(decs []sdk.Dec) sdk.Dec {
 	return decs[len(decs)/2]
 }
 
-func getLUNAPrices() (map[string]sdk.Dec, error) {
+// getLUNAPrices returns the LUNA price of every active denom from Band, along with what Band
+// returned, which is filled in as far as the prices got.
+func getLUNAPrices() (map[string]sdk.Dec, BandPrices, error) {
 	type priceWithErr struct {
-		Val interface{}
-		Err error
+		Val    interface{}
+		Result *BandResult
+		Err    error
 	}
 
+	deadline := time.Now().Add(GET_PRICE_TIME_OUT)
 	ch := make(chan priceWithErr, 2)
 
 	go func() {
-		lp, err := getLUNAPriceFromDataSources()
-		ch <- priceWithErr{Val: lp, Err: err}
+		lp, result, err := getLUNAPriceFromDataSources(deadline)
+		ch <- priceWithErr{Val: lp, Result: result, Err: err}
 	}()
 	go func() {
-		fpu, err := getStandardCurrencyPrices()
-		ch <- priceWithErr{Val: fpu, Err: err}
+		fpu, result, err := getStandardCurrencyPrices(deadline)
+		ch <- priceWithErr{Val: fpu, Result: result, Err: err}
 	}()
 
+	band := BandPrices{}
+
 	priceWithErrList := []priceWithErr{}
-	start := time.Now()
+	timeout := time.After(time.Until(deadline))
 	for len(priceWithErrList) < 2 {
-		x, ok := <-ch
-		if ok {
+		select {
+		case x := <-ch:
 			priceWithErrList = append(priceWithErrList, x)
-		}
-		if time.Since(start) >= GET_PRICE_TIME_OUT {
-			return nil, fmt.Errorf("⏰ getting price has timeout")
+		case <-timeout:
+			return nil, band, fmt.Errorf("getting price has timeout")
 		}
 	}
 
 	var lp LunaPrice
 	var fpu FxPriceUSD
+	for _, pwe := range priceWithErrList {
+		switch pwe.Val.(type) {
+		case LunaPrice:
+			band.LunaResult = pwe.Result
+		case FxPriceUSD:
+			band.FxResult = pwe.Result
+		}
+	}
 	for _, pwe := range priceWithErrList {
 		if pwe.Err != nil {
-			return nil, pwe.Err
+			return nil, band, pwe.Err
 		}
 		switch pwe.Val.(type) {
 		case LunaPrice:
@@ -485,72 +508,89 @@ func getLUNAPrices() (map[string]sdk.Dec, error) {
 		case FxPriceUSD:
 			fpu = pwe.Val.(FxPriceUSD)
 		default:
-			return nil, fmt.Errorf("unknown type %v", pwe.Val)
+			return nil, band, fmt.Errorf("unknown type %v", pwe.Val)
 		}
 	}
 
-	multiplier := sdk.NewDec(MULTIPLIER)
-
-	fmt.Printf("🌕 luna prices: %v \n", lp)
-	fmt.Printf("💵 fx prices: %v \n", fpu)
-
-	krws := []sdk.Dec{}
-	usds := []sdk.Dec{}
-	if lp.BithumbKRW >= 0 {
-		krws = append(krws, sdk.NewDec(lp.BithumbKRW).Quo(multiplier))
-		usds = append(usds, sdk.NewDec(lp.BithumbKRW).Mul(sdk.NewDec(int64(fpu[0]))).Quo(multiplier))
-	}
-	if lp.CoinoneKRW >= 0 {
-		krws = append(krws, sdk.NewDec(lp.CoinoneKRW).Quo(multiplier))
-		usds = append(usds, sdk.NewDec(lp.CoinoneKRW).Mul(sdk.NewDec(int64(fpu[0]))).Quo(multiplier))
-	}
-	if lp.BittrexUSD >= 0 {
-		krws = append(krws, sdk.NewDec(lp.BittrexUSD).Quo(sdk.NewDec(int64(fpu[0]))))
-		usds = append(usds, sdk.NewDec(lp.BittrexUSD))
+	band.Luna = lp.Sources()
+	if len(fpu) != len(FX_PRICE_CALLDATA.Symbols) {
+		return nil, band, fmt.Errorf("expect %d fx prices but got %d", len(FX_PRICE_CALLDATA.Symbols), len(fpu))
 	}
-	if lp.CoinGeckoUSD >= 0 {
-		krws = append(krws, sdk.NewDec(lp.CoinGeckoUSD).Quo(sdk.NewDec(int64(fpu[0]))))
-		usds = append(usds, sdk.NewDec(lp.CoinGeckoUSD))
+	band.Fx = map[string]sdk.Dec{}
+	for idx, price := range fpu {
+		band.Fx[FX_PRICE_CALLDATA.Symbols[idx]] = price.Dec
 	}
-	if lp.CryptoCompareUSD >= 0 {
-		krws = append(krws, sdk.NewDec(lp.CryptoCompareUSD).Quo(sdk.NewDec(int64(fpu[0]))))
-		usds = append(usds, sdk.NewDec(lp.CryptoCompareUSD))
+
+	logger.Debug("band_prices", "luna", lp, "fx", fpu)
+
+	for _, sp := range band.Luna {
+		if !sp.Price.IsPositive() {
+			logger.Warn("price_unavailable", "source", sp.Source, "currency", sp.Currency, "price", sp.Price)
+		}
 	}
-	if lp.HuobiproUSD >= 0 {
-		krws = append(krws, sdk.NewDec(lp.HuobiproUSD).Quo(sdk.NewDec(int64(fpu[0]))))
-		usds = append(usds, sdk.NewDec(lp.HuobiproUSD))
+
+	result, err := aggregateLUNAPrices(band.Luna, band.Fx)
+	if err != nil {
+		return nil, band, err
 	}
-	if lp.CoinmarketcapUSD >= 0 {
-		krws = append(krws, sdk.NewDec(lp.CoinmarketcapUSD).Quo(sdk.NewDec(int64(fpu[0]))))
-		usds = append(usds, sdk.NewDec(lp.CoinmarketcapUSD))
+
+	logger.Info("band_rates", "rates", result)
+
+	band.Rates = result
+	return result, band, nil
+}
+
+// aggregateLUNAPrices computes the LUNA price of every active denom from the prices of the LUNA
+// sources and the USD prices of the fx symbols, which are looked up by FX_DENOM_SYMBOLS. Sources
+// with a non-positive price are left out.
+func aggregateLUNAPrices(luna []LunaSourcePrice, fx map[string]sdk.Dec) (map[string]sdk.Dec, error) {
+	usdPrices := map[string]sdk.Dec{}
+	for _, denom := range activeDenoms {
+		symbol, ok := FX_DENOM_SYMBOLS[denom]
+		if !ok {
+			continue
+		}
+		price, ok := fx[symbol]
+		if !ok || price.IsNil() || !price.IsPositive() {
+			return nil, fmt.Errorf("fx price of %s is unavailable", symbol)
+		}
+		usdPrices[denom] = price
 	}
+	krwUSD := usdPrices["ukrw"]
 
-	fmt.Printf("krw rates: %s \n", decsPretty(krws))
-	fmt.Printf("usds rates: %s \n", decsPretty(func() []sdk.Dec {
-		tmp := []sdk.Dec{}
-		for _, x := range usds {
-			tmp = append(tmp, x.Quo(multiplier))
+	krws := []sdk.Dec{}
+	usds := []sdk.Dec{}
+	for _, sp := range luna {
+		if !sp.Price.IsPositive() {
+			continue
 		}
-		return tmp
-	}()))
+		switch sp.Currency {
+		case "KRW":
+			krws = append(krws, sp.Price)
+			usds = append(usds, sp.Price.Mul(krwUSD))
+		case "USD":
+			krws = append(krws, sp.Price.Quo(krwUSD))
+			usds = append(usds, sp.Price)
+		default:
+			return nil, fmt.Errorf("unknown currency %s of %s", sp.Currency, sp.Source)
+		}
+	}
 
-	if len(krws) == 0 || len(usds) == 0 {
-		return nil, fmt.Errorf("‼️🔥 fail to get luna price from every sources 🔥‼️")
+	logger.Debug("luna_rates", "krw", decsPretty(krws), "usd", decsPretty(usds))
+
+	if len(krws) < MIN_VALID_LUNA_SOURCES || len(usds) < MIN_VALID_LUNA_SOURCES {
+		return nil, fmt.Errorf("only %d luna price sources are valid, at least %d are required", len(usds), MIN_VALID_LUNA_SOURCES)
 	}
 
 	medKRW := medianDec(krws)
 	medUSD := medianDec(usds)
 
-	result := map[string]sdk.Dec{
+	return map[string]sdk.Dec{
 		"ukrw": medKRW,
-		"uusd": medUSD.Quo(multiplier),
-		"umnt": medUSD.Quo(sdk.NewDec(int64(fpu[1]))),
-		"usdr": medUSD.Quo(sdk.NewDec(int64(fpu[2]))),
-	}
-
-	fmt.Printf("🌟 result: %v \n", result)
-
-	return result, nil
+		"uusd": medUSD,
+		"umnt": medUSD.Quo(usdPrices["umnt"]),
+		"usdr": medUSD.Quo(usdPrices["usdr"]),
+	}, nil
 }
 
 func hasPrevotesForAllDenom(prevotes terra_types.ExchangeRatePrevotes) bool {
@@ -569,99 +609,92 @@ func hasPrevotesForAllDenom(prevotes terra_types.ExchangeRatePrevotes) bool {
 }
 
 func main() {
+	InitSDKConfig()
+	runCommand(os.Args[1:])
+}
 
-	fmt.Println("Start ...")
+// runStart is the start command, which runs the feeder until it is stopped.
+func runStart(args []string) error {
+	fs := newFlagSet("start")
+	configPath := configFlag(fs)
+	fs.Parse(args)
 
-	InitSDKConfig()
+	cfg := loadConfig(*configPath)
+	logger.Info("start", "config", *configPath)
+	feeder := setupFeeder(cfg)
 
-	feeder := NewFeeder()
+	statusServer := NewStatusServer(cfg.Status, systemClock{}, feeder.KeyAvailable)
+	if cfg.Status.ListenAddr != "" {
+		go statusServer.Serve(cfg.Status.ListenAddr)
+	}
 
 	for feeder.Params.VotePeriod == 0 {
-		feeder.fetchParams()
+		statusServer.Update(func(status *FeederStatus) { status.LoopAt = time.Now() })
+		err := feeder.fetchParams()
+		if err != nil {
+			logger.Error("params_query_failed", "error", err)
+		}
 		time.Sleep(1 * time.Second)
 	}
+	statusServer.Update(func(status *FeederStatus) { status.VotePeriod = feeder.Params.VotePeriod })
+
+	engine := setupEngine(cfg, &feeder)
+
+	alerter := NewAlerter(NewAlertSinks(cfg.Alert, VALIDATOR_ADDRESS), systemClock{}, cfg.Alert.RepeatInterval.Duration)
+	performanceRound := int64(-1)
 
 	for {
 		func() {
 			defer func() {
 				if r := recover(); r != nil {
-					logError(fmt.Errorf("Unknown error: %v", r))
+					logger.Error("panic", "error", fmt.Sprintf("%v", r))
 				}
 
+				statusServer.UpdateRound(engine)
+				statusServer.Update(func(status *FeederStatus) { status.LoopAt = time.Now() })
+				alerter.Check(cfg.Alert, statusServer.Status(), feeder.PriceSourceErrors())
+
 				time.Sleep(1 * time.Second)
 			}()
 
 			status, err := feeder.terraClient.Status()
 			if err != nil {
-				logError(fmt.Errorf("Fail to fetch status %v", err))
+				logger.Error("status_query_failed", "error", err)
 				return
 			}
 
 			feeder.LatestBlockHeight = status.SyncInfo.LatestBlockHeight
 			currentRound := feeder.LatestBlockHeight / feeder.Params.VotePeriod
 
-			fmt.Printf("\rOn latestBlockHeight=%d currentRound=%d", feeder.LatestBlockHeight, currentRound)
-
-			if currentRound > feeder.LastPrevoteRound {
-				fmt.Println("get prevotes from terra node")
-				prevotes, err := feeder.getPrevote()
-				if err != nil {
-					logError(err)
-					return
+			statusServer.Update(func(s *FeederStatus) {
+				s.LatestHeight = status.SyncInfo.LatestBlockHeight
+				s.LatestBlockTime = status.SyncInfo.LatestBlockTime
+				s.CatchingUp = status.SyncInfo.CatchingUp
+				s.CurrentRound = currentRound
+				if s.NodeStatusAt.IsZero() {
+					s.StartRound = currentRound
 				}
+				s.NodeStatusAt = time.Now()
+			})
 
-				prices, err := getLUNAPrices()
-				if err != nil {
-					logError(err)
-					return
-				}
-
-				msgs := []sdk.Msg{}
-
-				pass1 := hasPrevotesForAllDenom(prevotes)
-				pass2 := feeder.allVotesAndPrevotesAreCorrespond(prevotes)
-
-				if !pass1 {
-					fmt.Println("🔍 not all prevotes found")
-				}
-				if !pass2 {
-					fmt.Println("🧂 there are some votes that do not correspond with the prevotes")
-				}
-
-				if pass1 && pass2 {
-					fmt.Println("🗳️ vote for existed prevotes and then create new prevotes")
-
-					for _, vote := range feeder.votes {
-						msgs = append(msgs, vote)
-					}
-				} else {
-					fmt.Println("create new prevotes")
-				}
+			logger.Debug("block", "height", feeder.LatestBlockHeight, "round", currentRound)
 
-				feeder.commitNewVotes(prices)
-				newPrevotes, err := feeder.MsgPrevotesFromCurrentCommitVotes()
+			if currentRound != performanceRound {
+				performance, err := feeder.Performance()
 				if err != nil {
-					logError(err)
-					return
-				}
-
-				for _, x := range newPrevotes {
-					msgs = append(msgs, x)
-				}
-
-				res, err := feeder.broadcast(msgs)
-				if err != nil {
-					logError(err)
-					return
-				}
-
-				if pass1 && pass2 {
-					printStatus("🍻", "broadcast vote and prevotes", res)
+					logger.Error("miss_counter_query_failed", "round", currentRound, "error", err)
 				} else {
-					printStatus("🍺", "broadcast prevotes only", res)
+					performanceRound = currentRound
+					statusServer.Update(func(s *FeederStatus) { s.Performance = &performance })
+					logger.Info("oracle_performance", "round", currentRound, "miss_counter", performance.MissCounter,
+						"max_misses", performance.MaxMisses, "window_end", performance.WindowEnd)
 				}
+			}
 
-				feeder.LastPrevoteRound = currentRound
+			err = engine.Step(feeder.LatestBlockHeight)
+			if err != nil {
+				logger.Error("round_failed", "height", feeder.LatestBlockHeight, "round", currentRound, "error", err)
+				return
 			}
 		}()
 	}
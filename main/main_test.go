@@ -0,0 +1,70 @@
+package main
+
+import (
+	"io/ioutil"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys/mintkey"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+func TestMain(m *testing.M) {
+	InitSDKConfig()
+	// Keys of the test keyrings are encrypted with the lowest bcrypt cost to keep the tests fast.
+	mintkey.BcryptSecurityParameter = 4
+	logger = slog.New(slog.NewJSONHandler(ioutil.Discard, nil))
+	os.Exit(m.Run())
+}
+
+func TestAggregateLUNAPricesLooksUpFxBySymbol(t *testing.T) {
+	luna := []LunaSourcePrice{
+		{Source: "bithumb", Currency: "KRW", Price: sdk.NewDec(1000)},
+		{Source: "coinone", Currency: "KRW", Price: sdk.NewDec(1000)},
+		{Source: "bittrex", Currency: "USD", Price: sdk.NewDec(1)},
+		{Source: "coingecko", Currency: "USD", Price: sdk.NewDec(1)},
+		{Source: "cryptocompare", Currency: "USD", Price: sdk.ZeroDec()},
+	}
+	fx := map[string]sdk.Dec{
+		// Not in the order the denoms are voted in.
+		"XDR": sdk.MustNewDecFromStr("1.25"),
+		"KRW": sdk.MustNewDecFromStr("0.001"),
+		"EUR": sdk.MustNewDecFromStr("1.1"),
+		"MNT": sdk.MustNewDecFromStr("0.0004"),
+	}
+
+	rates, err := aggregateLUNAPrices(luna, fx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"ukrw": "1000", "uusd": "1", "umnt": "2500", "usdr": "0.8"}
+	for denom, rate := range expect {
+		if !rates[denom].Equal(sdk.MustNewDecFromStr(rate)) {
+			t.Errorf("expect %s of %s but got %s", rate, denom, rates[denom])
+		}
+	}
+
+	delete(fx, "MNT")
+	_, err = aggregateLUNAPrices(luna, fx)
+	if err == nil || err.Error() != "fx price of MNT is unavailable" {
+		t.Errorf("expect MNT to be unavailable but got %v", err)
+	}
+}
+
+func TestCheckFxSymbols(t *testing.T) {
+	for _, tc := range []struct {
+		symbols   []string
+		expectErr string
+	}{
+		{[]string{"KRW", "MNT", "XDR"}, ""},
+		{[]string{"XDR", "EUR", "KRW", "MNT"}, ""},
+		{[]string{"KRW", "XDR"}, "fx_price feed must ask for MNT to vote for umnt"},
+		{[]string{"KRW", "MNT", "XDR", "KRW"}, "fx_price feed asks for KRW more than once"},
+	} {
+		err := checkFxSymbols(tc.symbols)
+		if (err == nil) != (tc.expectErr == "") || (err != nil && err.Error() != tc.expectErr) {
+			t.Errorf("expect %v to fail with %q but got %v", tc.symbols, tc.expectErr, err)
+		}
+	}
+}
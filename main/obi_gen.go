@@ -0,0 +1,165 @@
+// Code generated by obigen. DO NOT EDIT.
+
+package main
+
+import (
+	"encoding/binary"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// OBISchema returns the OBI schema of FxPriceCallData.
+func (v FxPriceCallData) OBISchema() string {
+	return "{symbols:[string],multiplier:u64}"
+}
+
+// MarshalOBI encodes FxPriceCallData into OBI bytes.
+func (v FxPriceCallData) MarshalOBI() ([]byte, error) {
+	return v.AppendOBI(nil)
+}
+
+// AppendOBI appends the OBI encoding of FxPriceCallData to b.
+func (v FxPriceCallData) AppendOBI(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v.Symbols)))
+	for i1 := range v.Symbols {
+		b = binary.BigEndian.AppendUint32(b, uint32(len(v.Symbols[i1])))
+		b = append(b, v.Symbols[i1]...)
+	}
+	b = binary.BigEndian.AppendUint64(b, uint64(v.Multiplier))
+	return b, nil
+}
+
+// UnmarshalOBI decodes FxPriceCallData from the front of data and returns the remaining bytes.
+func (v *FxPriceCallData) UnmarshalOBI(data []byte) ([]byte, error) {
+	rem := data
+	var err error
+	var n1 int
+	n1, rem, err = obi.DecodeLength(rem)
+	if err != nil {
+		return nil, err
+	}
+	v.Symbols = make([]string, n1)
+	for i2 := range v.Symbols {
+		v.Symbols[i2], rem, err = obi.DecodeString(rem)
+		if err != nil {
+			return nil, err
+		}
+	}
+	v.Multiplier, rem, err = obi.DecodeUnsigned64(rem)
+	if err != nil {
+		return nil, err
+	}
+	return rem, nil
+}
+
+// OBISchema returns the OBI schema of LunaPrice.
+func (v LunaPrice) OBISchema() string {
+	return "{crypto_compare_usd:" + new(LunaPriceDec).OBISchema() + ",coin_gecko_usd:" + new(LunaPriceDec).OBISchema() + ",huobipro_usd:" + new(LunaPriceDec).OBISchema() + ",bittrex_usd:" + new(LunaPriceDec).OBISchema() + ",bithumb_krw:" + new(LunaPriceDec).OBISchema() + ",coinone_krw:" + new(LunaPriceDec).OBISchema() + ",coinmarketcap_usd:" + new(LunaPriceDec).OBISchema() + "}"
+}
+
+// MarshalOBI encodes LunaPrice into OBI bytes.
+func (v LunaPrice) MarshalOBI() ([]byte, error) {
+	return v.AppendOBI(nil)
+}
+
+// AppendOBI appends the OBI encoding of LunaPrice to b.
+func (v LunaPrice) AppendOBI(b []byte) ([]byte, error) {
+	var err error
+	b, err = v.CryptoCompareUSD.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = v.CoinGeckoUSD.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = v.HuobiproUSD.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = v.BittrexUSD.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = v.BithumbKRW.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = v.CoinoneKRW.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = v.CoinmarketcapUSD.AppendOBI(b)
+	if err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// UnmarshalOBI decodes LunaPrice from the front of data and returns the remaining bytes.
+func (v *LunaPrice) UnmarshalOBI(data []byte) ([]byte, error) {
+	rem := data
+	var err error
+	rem, err = v.CryptoCompareUSD.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	rem, err = v.CoinGeckoUSD.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	rem, err = v.HuobiproUSD.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	rem, err = v.BittrexUSD.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	rem, err = v.BithumbKRW.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	rem, err = v.CoinoneKRW.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	rem, err = v.CoinmarketcapUSD.UnmarshalOBI(rem)
+	if err != nil {
+		return nil, err
+	}
+	return rem, nil
+}
+
+// OBISchema returns the OBI schema of LunaPriceCallData.
+func (v LunaPriceCallData) OBISchema() string {
+	return "{symbol:string,multiplier:u64}"
+}
+
+// MarshalOBI encodes LunaPriceCallData into OBI bytes.
+func (v LunaPriceCallData) MarshalOBI() ([]byte, error) {
+	return v.AppendOBI(nil)
+}
+
+// AppendOBI appends the OBI encoding of LunaPriceCallData to b.
+func (v LunaPriceCallData) AppendOBI(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint32(b, uint32(len(v.Symbol)))
+	b = append(b, v.Symbol...)
+	b = binary.BigEndian.AppendUint64(b, uint64(v.Multiplier))
+	return b, nil
+}
+
+// UnmarshalOBI decodes LunaPriceCallData from the front of data and returns the remaining bytes.
+func (v *LunaPriceCallData) UnmarshalOBI(data []byte) ([]byte, error) {
+	rem := data
+	var err error
+	v.Symbol, rem, err = obi.DecodeString(rem)
+	if err != nil {
+		return nil, err
+	}
+	v.Multiplier, rem, err = obi.DecodeUnsigned64(rem)
+	if err != nil {
+		return nil, err
+	}
+	return rem, nil
+}
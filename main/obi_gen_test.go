@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// The reflect types have the fields of the generated types but none of their methods, so the obi
+// package encodes them by reflection.
+type reflectLunaPrice LunaPrice
+
+type reflectFxPriceCallData FxPriceCallData
+
+func benchLunaPrice() LunaPrice {
+	return LunaPrice{
+		lunaPriceDec("1.234567"), lunaPriceDec("1.23"), lunaPriceDec("0"), lunaPriceDec("-0.000001"),
+		lunaPriceDec("1500"), lunaPriceDec("1510"), lunaPriceDec("1.235"),
+	}
+}
+
+func benchFxPriceCallData() FxPriceCallData {
+	return FxPriceCallData{Symbols: []string{"KRW", "MNT", "XDR"}, Multiplier: 1000000}
+}
+
+func TestGeneratedMatchesReflection(t *testing.T) {
+	withMultiplier(t, 1000000)
+	for _, tc := range []struct {
+		name       string
+		generated  interface{}
+		reflection interface{}
+	}{
+		{"LunaPrice", benchLunaPrice(), reflectLunaPrice(benchLunaPrice())},
+		{"FxPriceCallData", benchFxPriceCallData(), reflectFxPriceCallData(benchFxPriceCallData())},
+	} {
+		generated := obi.MustEncode(tc.generated)
+		reflection := obi.MustEncode(tc.reflection)
+		if !bytes.Equal(generated, reflection) {
+			t.Errorf("%s encodes to %x generated but %x by reflection", tc.name, generated, reflection)
+		}
+		if obi.MustGetSchema(tc.generated) != obi.MustGetSchema(tc.reflection) {
+			t.Errorf("%s has schema %s generated but %s by reflection", tc.name, obi.MustGetSchema(tc.generated), obi.MustGetSchema(tc.reflection))
+		}
+	}
+}
+
+func TestCheckSchemaReordersGeneratedCalldata(t *testing.T) {
+	feed := &Feed{Name: "fx_price", Config: FeedConfig{OracleScriptID: 9, ResultSchema: "[u64]"}}
+	calldata := benchFxPriceCallData()
+	err := feed.checkSchema("{multiplier:u64,symbols:[string]}/[u64]", calldata)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "00000000000f4240" + "00000003000000034b5257000000034d4e5400000003584452"
+	if hex.EncodeToString(feed.Calldata) != want {
+		t.Errorf("calldata = %x, want %s", feed.Calldata, want)
+	}
+}
+
+func BenchmarkEncodeLunaPrice(b *testing.B) {
+	withMultiplier(b, 1000000)
+	generated, reflection := benchLunaPrice(), reflectLunaPrice(benchLunaPrice())
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obi.MustEncode(generated)
+		}
+	})
+	b.Run("reflection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obi.MustEncode(reflection)
+		}
+	})
+}
+
+func BenchmarkDecodeLunaPrice(b *testing.B) {
+	withMultiplier(b, 1000000)
+	bz := obi.MustEncode(benchLunaPrice())
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v LunaPrice
+			obi.MustDecode(bz, &v)
+		}
+	})
+	b.Run("reflection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v reflectLunaPrice
+			obi.MustDecode(bz, &v)
+		}
+	})
+}
+
+func BenchmarkEncodeFxPriceCallData(b *testing.B) {
+	generated, reflection := benchFxPriceCallData(), reflectFxPriceCallData(benchFxPriceCallData())
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obi.MustEncode(generated)
+		}
+	})
+	b.Run("reflection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			obi.MustEncode(reflection)
+		}
+	})
+}
+
+func BenchmarkDecodeFxPriceCallData(b *testing.B) {
+	bz := obi.MustEncode(benchFxPriceCallData())
+	b.Run("generated", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v FxPriceCallData
+			obi.MustDecode(bz, &v)
+		}
+	})
+	b.Run("reflection", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			var v reflectFxPriceCallData
+			obi.MustDecode(bz, &v)
+		}
+	})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// withMultiplier sets the multiplier the prices of the feeds are scaled with.
+func withMultiplier(tb testing.TB, multiplier uint64) {
+	prev := LUNA_PRICE_CALLDATA.Multiplier
+	LUNA_PRICE_CALLDATA.Multiplier = multiplier
+	tb.Cleanup(func() { LUNA_PRICE_CALLDATA.Multiplier = prev })
+}
+
+func lunaPriceDec(s string) LunaPriceDec {
+	return LunaPriceDec{sdk.MustNewDecFromStr(s)}
+}
+
+func fxPriceDec(s string) FxPriceDec {
+	return FxPriceDec{sdk.MustNewDecFromStr(s)}
+}
+
+func TestLunaPriceDec(t *testing.T) {
+	withMultiplier(t, 1000000)
+	for _, tc := range []struct {
+		price   string
+		encoded string
+	}{
+		{"1.234567", "000000000012d687"},
+		{"1500", "0000000059682f00"},
+		{"0", "0000000000000000"},
+		// Unavailable data sources report non-positive prices.
+		{"-0.000001", "ffffffffffffffff"},
+	} {
+		bz, err := obi.Encode(lunaPriceDec(tc.price))
+		if err != nil || hex.EncodeToString(bz) != tc.encoded {
+			t.Errorf("Encode of %s = %x, %v, want %s", tc.price, bz, err, tc.encoded)
+		}
+		var p LunaPriceDec
+		err = obi.Decode(bz, &p)
+		if err != nil || !p.Equal(sdk.MustNewDecFromStr(tc.price)) {
+			t.Errorf("Decode of %x = %s, %v, want %s", bz, p, err, tc.price)
+		}
+	}
+
+	// What is left below one unit of the multiplier is truncated.
+	bz, err := obi.Encode(lunaPriceDec("1.2345678"))
+	if err != nil || hex.EncodeToString(bz) != "000000000012d687" {
+		t.Errorf("Encode of 1.2345678 = %x, %v, want 000000000012d687", bz, err)
+	}
+	_, err = obi.Encode(lunaPriceDec("10000000000000"))
+	if err == nil || !strings.Contains(err.Error(), "out of range of i64") {
+		t.Errorf("expect a price beyond i64 to fail but got %v", err)
+	}
+}
+
+func TestFxPriceDec(t *testing.T) {
+	withMultiplier(t, 1000)
+	bz, err := obi.Encode(FxPriceUSD{fxPriceDec("1"), fxPriceDec("0.4"), fxPriceDec("1250")})
+	if err != nil || hex.EncodeToString(bz) != "0000000300000000000003e8000000000000019000000000001312d0" {
+		t.Errorf("Encode of the rates = %x, %v", bz, err)
+	}
+	var rates FxPriceUSD
+	err = obi.Decode(bz, &rates)
+	if err != nil || len(rates) != 3 || !rates[1].Equal(sdk.MustNewDecFromStr("0.4")) {
+		t.Errorf("Decode of %x = %v, %v", bz, rates, err)
+	}
+
+	_, err = obi.Encode(fxPriceDec("-1"))
+	if err == nil || !strings.Contains(err.Error(), "out of range of u64") {
+		t.Errorf("expect a negative rate to fail but got %v", err)
+	}
+}
+
+func TestPriceDecSchemas(t *testing.T) {
+	cfg := DefaultConfig()
+	for _, tc := range []struct {
+		value  interface{}
+		schema string
+	}{
+		{LunaPrice{}, cfg.LunaPrice.ResultSchema},
+		{FxPriceUSD{}, cfg.FxPrice.ResultSchema},
+	} {
+		err := obi.CheckSchema(tc.value, tc.schema)
+		if err != nil {
+			t.Errorf("%T does not match %s: %v", tc.value, tc.schema, err)
+		}
+	}
+}
+
+// fuzzFeedDecode checks that data either fails to decode into v with a DecodeError, or encodes back
+// into the same bytes.
+func fuzzFeedDecode(t *testing.T, data []byte, v interface{}, value func() interface{}) {
+	err := obi.Decode(data, v)
+	if err != nil {
+		var de *obi.DecodeError
+		if !errors.As(err, &de) {
+			t.Fatalf("Decode returned %v, want a DecodeError", err)
+		}
+		return
+	}
+	bz, err := obi.Encode(value())
+	if err != nil {
+		t.Fatalf("Encode of decoded %+v returned %v", value(), err)
+	}
+	if !bytes.Equal(bz, data) {
+		t.Fatalf("Encode of decoded %+v = %x, want %x", value(), bz, data)
+	}
+}
+
+// addFeedSeeds adds the encoding of the value, whole and cut short, to the seed corpus.
+func addFeedSeeds(f *testing.F, value interface{}) {
+	withMultiplier(f, 1000000)
+	bz := obi.MustEncode(value)
+	f.Add(bz)
+	f.Add(bz[:len(bz)-1])
+}
+
+func FuzzDecodeLunaPrice(f *testing.F) {
+	addFeedSeeds(f, benchLunaPrice())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v LunaPrice
+		fuzzFeedDecode(t, data, &v, func() interface{} { return v })
+	})
+}
+
+func FuzzDecodeFxPriceUSD(f *testing.F) {
+	addFeedSeeds(f, FxPriceUSD{fxPriceDec("0.001"), fxPriceDec("1.25")})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v FxPriceUSD
+		fuzzFeedDecode(t, data, &v, func() interface{} { return v })
+	})
+}
+
+func FuzzDecodeLunaPriceCallData(f *testing.F) {
+	addFeedSeeds(f, LunaPriceCallData{Symbol: "LUNA", Multiplier: 1000000})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v LunaPriceCallData
+		fuzzFeedDecode(t, data, &v, func() interface{} { return v })
+	})
+}
+
+func FuzzDecodeFxPriceCallData(f *testing.F) {
+	addFeedSeeds(f, benchFxPriceCallData())
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var v FxPriceCallData
+		fuzzFeedDecode(t, data, &v, func() interface{} { return v })
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// Oracle script constants
+var (
+	ORACLE_SCRIPT_END_POINT = "%s/oracle/oracle_scripts/%d"
+)
+
+type OracleScript struct {
+	Owner         string `json:"owner"`
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Filename      string `json:"filename"`
+	Schema        string `json:"schema"`
+	SourceCodeURL string `json:"source_code_url"`
+}
+
+type OracleScriptResponse struct {
+	Height int64        `json:"height,string"`
+	Result OracleScript `json:"result"`
+}
+
+func getOracleScript(bandURL string, id uint64) (OracleScript, error) {
+	resp, err := http.Get(fmt.Sprintf(ORACLE_SCRIPT_END_POINT, bandURL, id))
+	if err != nil {
+		return OracleScript{}, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return OracleScript{}, err
+	}
+
+	osr := OracleScriptResponse{}
+	err = json.Unmarshal(body, &osr)
+	if err != nil {
+		return OracleScript{}, fmt.Errorf("fail to unmarshal oracle script %d, %v, %s", id, err, string(body[:]))
+	}
+
+	return osr.Result, nil
+}
+
+// splitSchema splits the declared schema of an oracle script into its input and output schemas in compact form.
+func splitSchema(schema string) (string, string, error) {
+	input, output, err := obi.ParseOracleScriptSchema(schema)
+	if err != nil {
+		return "", "", err
+	}
+	return input.String(), output.String(), nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// OraclePerformance is how the validator does on-chain in the current slash window.
+//
+// The oracle module counts a miss for every vote period in which a validator did not have a
+// valid vote for all vote targets. At the last block of the slash window, it slashes and jails
+// the validators whose valid vote rate, (periods - misses) / periods, is below
+// MinValidPerWindow, and resets the miss counters of all validators.
+type OraclePerformance struct {
+	// Height is the height the miss counter was queried at.
+	Height      int64 `json:"height"`
+	MissCounter int64 `json:"miss_counter"`
+	// WindowStart and WindowEnd are the first and the last block of the slash window.
+	WindowStart          int64 `json:"window_start"`
+	WindowEnd            int64 `json:"window_end"`
+	VotePeriodsPerWindow int64 `json:"vote_periods_per_window"`
+	// ElapsedVotePeriods are the vote periods of the window that were tallied.
+	ElapsedVotePeriods int64 `json:"elapsed_vote_periods"`
+	// MaxMisses is how many vote periods of the window the validator may miss without being slashed.
+	MaxMisses int64 `json:"max_misses"`
+	// RemainingMisses is how many more vote periods the validator may miss in the window.
+	RemainingMisses int64 `json:"remaining_misses"`
+	// ValidVoteRate is the rate the window ends with if the validator misses no more periods.
+	ValidVoteRate     sdk.Dec `json:"valid_vote_rate"`
+	MinValidPerWindow sdk.Dec `json:"min_valid_per_window"`
+}
+
+// NewOraclePerformance computes the performance of the validator in the slash window of the
+// height from its miss counter, the same way the oracle module does when the window ends.
+func NewOraclePerformance(params terra_types.Params, height int64, missCounter int64) (OraclePerformance, error) {
+	if params.VotePeriod <= 0 || params.SlashWindow < params.VotePeriod {
+		return OraclePerformance{}, fmt.Errorf("invalid slash window %d of vote period %d", params.SlashWindow, params.VotePeriod)
+	}
+
+	periods := sdk.NewDec(params.SlashWindow).QuoInt64(params.VotePeriod).TruncateInt64()
+	minValid := params.MinValidPerWindow.MulInt64(periods).Ceil().TruncateInt64()
+	maxMisses := periods - minValid
+
+	windowStart := height / params.SlashWindow * params.SlashWindow
+	return OraclePerformance{
+		Height:               height,
+		MissCounter:          missCounter,
+		WindowStart:          windowStart,
+		WindowEnd:            windowStart + params.SlashWindow - 1,
+		VotePeriodsPerWindow: periods,
+		ElapsedVotePeriods:   (height+1)/params.VotePeriod - windowStart/params.VotePeriod,
+		MaxMisses:            maxMisses,
+		RemainingMisses:      maxMisses - missCounter,
+		ValidVoteRate:        sdk.NewDec(periods - missCounter).QuoInt64(periods),
+		MinValidPerWindow:    params.MinValidPerWindow,
+	}, nil
+}
+
+// MissCounter returns the vote periods the validator missed in the current slash window.
+func (f *Feeder) MissCounter(validator sdk.ValAddress) (int64, error) {
+	var missCounter int64
+	params := terra_types.NewQueryMissCounterParams(validator)
+
+	bz, err := cdc.MarshalJSON(params)
+	if err != nil {
+		return 0, fmt.Errorf("fail to marshal miss counter params: %v", err)
+	}
+
+	res, err := f.terraClient.ABCIQuery(fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryMissCounter), bz)
+	if err != nil {
+		return 0, fmt.Errorf("fail to query miss counter: %v", err)
+	}
+	if !res.Response.IsOK() {
+		return 0, fmt.Errorf("fail to query miss counter: %s", res.Response.Log)
+	}
+
+	err = cdc.UnmarshalJSON(res.Response.GetValue(), &missCounter)
+	if err != nil {
+		return 0, fmt.Errorf("fail to unmarshal miss counter json: %v", err)
+	}
+
+	return missCounter, nil
+}
+
+// Performance queries the miss counter of the validator and computes its performance at the
+// latest height.
+func (f *Feeder) Performance() (OraclePerformance, error) {
+	missCounter, err := f.MissCounter(f.validator)
+	if err != nil {
+		return OraclePerformance{}, err
+	}
+	return NewOraclePerformance(f.Params, f.LatestBlockHeight, missCounter)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+func TestNewOraclePerformance(t *testing.T) {
+	// A slash window of 100 blocks has 20 vote periods of 5 blocks.
+	params := terra_types.DefaultParams()
+	params.VotePeriod = 5
+	params.SlashWindow = 100
+
+	testCases := []struct {
+		name              string
+		minValidPerWindow string
+		height            int64
+		missCounter       int64
+
+		windowStart int64
+		windowEnd   int64
+		elapsed     int64
+		maxMisses   int64
+		remaining   int64
+		rate        string
+	}{
+		{"start of the first window", "0.05", 0, 0, 0, 99, 0, 19, 19, "1"},
+		{"last block of the first window", "0.05", 99, 3, 0, 99, 20, 19, 16, "0.85"},
+		{"first block of the second window", "0.05", 100, 0, 100, 199, 0, 19, 19, "1"},
+		{"end of the first period of the second window", "0.05", 104, 1, 100, 199, 1, 19, 18, "0.95"},
+		{"last block of the second window", "0.05", 199, 0, 100, 199, 20, 19, 19, "1"},
+		// 20 * 0.33 = 6.6 valid periods are rounded up to 7, so 13 may be missed.
+		{"non-integer valid periods", "0.33", 150, 13, 100, 199, 10, 13, 0, "0.35"},
+		{"more misses than allowed", "0.33", 150, 15, 100, 199, 10, 13, -2, "0.25"},
+		{"integer valid periods", "0.5", 150, 0, 100, 199, 10, 10, 10, "1"},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params.MinValidPerWindow = sdk.MustNewDecFromStr(tc.minValidPerWindow)
+			p, err := NewOraclePerformance(params, tc.height, tc.missCounter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Height != tc.height || p.MissCounter != tc.missCounter || p.VotePeriodsPerWindow != 20 {
+				t.Errorf("expect height %d, miss counter %d and 20 vote periods but got %+v", tc.height, tc.missCounter, p)
+			}
+			if p.WindowStart != tc.windowStart || p.WindowEnd != tc.windowEnd {
+				t.Errorf("expect window %d to %d but got %d to %d", tc.windowStart, tc.windowEnd, p.WindowStart, p.WindowEnd)
+			}
+			if p.ElapsedVotePeriods != tc.elapsed {
+				t.Errorf("expect %d elapsed vote periods but got %d", tc.elapsed, p.ElapsedVotePeriods)
+			}
+			if p.MaxMisses != tc.maxMisses || p.RemainingMisses != tc.remaining {
+				t.Errorf("expect %d max and %d remaining misses but got %d and %d", tc.maxMisses, tc.remaining, p.MaxMisses, p.RemainingMisses)
+			}
+			if !p.ValidVoteRate.Equal(sdk.MustNewDecFromStr(tc.rate)) || !p.MinValidPerWindow.Equal(params.MinValidPerWindow) {
+				t.Errorf("expect valid vote rate %s of min %s but got %s of %s", tc.rate, params.MinValidPerWindow, p.ValidVoteRate, p.MinValidPerWindow)
+			}
+		})
+	}
+}
+
+func TestNewOraclePerformanceRejectsInvalidParams(t *testing.T) {
+	params := terra_types.DefaultParams()
+	for _, window := range [][2]int64{{0, 100}, {5, 4}} {
+		params.VotePeriod, params.SlashWindow = window[0], window[1]
+		_, err := NewOraclePerformance(params, 10, 0)
+		if err == nil {
+			t.Errorf("expect vote period %d and slash window %d to be rejected", window[0], window[1])
+		}
+	}
+}
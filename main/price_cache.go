@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+type priceCacheKey struct {
+	Source string
+	Symbol string
+}
+
+type CachedPrice struct {
+	Source    string
+	Symbol    string
+	Value     sdk.Dec
+	UpdatedAt time.Time
+}
+
+// PriceCache keeps the last known price of every symbol reported by every source.
+type PriceCache struct {
+	mtx    sync.Mutex
+	prices map[priceCacheKey]CachedPrice
+}
+
+func NewPriceCache() *PriceCache {
+	return &PriceCache{prices: map[priceCacheKey]CachedPrice{}}
+}
+
+// Set records the price of the symbol reported by the source at the given time.
+func (c *PriceCache) Set(source string, symbol string, value sdk.Dec, at time.Time) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.prices[priceCacheKey{Source: source, Symbol: symbol}] = CachedPrice{
+		Source:    source,
+		Symbol:    symbol,
+		Value:     value,
+		UpdatedAt: at,
+	}
+}
+
+// Get returns the cached price of the symbol reported by the source.
+func (c *PriceCache) Get(source string, symbol string) (CachedPrice, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	cp, ok := c.prices[priceCacheKey{Source: source, Symbol: symbol}]
+	return cp, ok
+}
+
+// Freshest returns the most recently updated price of the symbol across all sources,
+// as long as it is not older than maxAge.
+func (c *PriceCache) Freshest(symbol string, maxAge time.Duration, now time.Time) (CachedPrice, bool) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	var best CachedPrice
+	found := false
+	for key, cp := range c.prices {
+		if key.Symbol != symbol || now.Sub(cp.UpdatedAt) > maxAge {
+			continue
+		}
+		if !found || cp.UpdatedAt.After(best.UpdatedAt) {
+			best = cp
+			found = true
+		}
+	}
+	return best, found
+}
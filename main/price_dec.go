@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// priceMultiplier returns the multiplier Band oracle scripts scale prices with. setupFeeds makes
+// sure both feeds are requested with the same non-zero multiplier.
+func priceMultiplier() sdk.Dec {
+	return sdk.NewDecFromInt(sdk.NewIntFromUint64(LUNA_PRICE_CALLDATA.Multiplier))
+}
+
+// scaledToDec divides an integer price from a Band result by the multiplier.
+func scaledToDec(x sdk.Int) sdk.Dec {
+	return sdk.NewDecFromInt(x).Quo(priceMultiplier())
+}
+
+// decToScaled multiplies a price by the multiplier, truncating what is left below one unit.
+func decToScaled(d sdk.Dec) sdk.Int {
+	if d.IsNil() {
+		return sdk.ZeroInt()
+	}
+	return d.Mul(priceMultiplier()).TruncateInt()
+}
+
+// LunaPriceDec is a price OBI encoded as an i64 multiplied by the multiplier. Non-positive values
+// mean the data source was unavailable.
+type LunaPriceDec struct {
+	sdk.Dec
+}
+
+func (p LunaPriceDec) OBISchema() string { return "i64" }
+
+func (p LunaPriceDec) MarshalOBI() ([]byte, error) {
+	return p.AppendOBI(nil)
+}
+
+func (p LunaPriceDec) AppendOBI(b []byte) ([]byte, error) {
+	scaled := decToScaled(p.Dec)
+	if !scaled.IsInt64() {
+		return nil, fmt.Errorf("price %s is out of range of i64", p.Dec)
+	}
+	return binary.BigEndian.AppendUint64(b, uint64(scaled.Int64())), nil
+}
+
+func (p *LunaPriceDec) UnmarshalOBI(data []byte) ([]byte, error) {
+	val, rem, err := obi.DecodeSigned64(data)
+	if err != nil {
+		return nil, err
+	}
+	p.Dec = scaledToDec(sdk.NewInt(val))
+	return rem, nil
+}
+
+// FxPriceDec is a rate OBI encoded as a u64 multiplied by the multiplier.
+type FxPriceDec struct {
+	sdk.Dec
+}
+
+func (p FxPriceDec) OBISchema() string { return "u64" }
+
+func (p FxPriceDec) MarshalOBI() ([]byte, error) {
+	return p.AppendOBI(nil)
+}
+
+func (p FxPriceDec) AppendOBI(b []byte) ([]byte, error) {
+	scaled := decToScaled(p.Dec)
+	if scaled.IsNegative() || !scaled.BigInt().IsUint64() {
+		return nil, fmt.Errorf("rate %s is out of range of u64", p.Dec)
+	}
+	return binary.BigEndian.AppendUint64(b, scaled.BigInt().Uint64()), nil
+}
+
+func (p *FxPriceDec) UnmarshalOBI(data []byte) ([]byte, error) {
+	val, rem, err := obi.DecodeUnsigned64(data)
+	if err != nil {
+		return nil, err
+	}
+	p.Dec = scaledToDec(sdk.NewIntFromUint64(val))
+	return rem, nil
+}
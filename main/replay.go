@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// FX_QUOTE_SOURCE is the source of the fx rows of a quotes CSV, whose currency is the fx symbol.
+const FX_QUOTE_SOURCE = "fx"
+
+// ReplayQuotes are the prices the feeder fetched in a round, as recorded in the audit log or a CSV.
+type ReplayQuotes struct {
+	Round int64
+	Luna  []LunaSourcePrice
+	// Fx are the USD prices of the fx symbols.
+	Fx map[string]sdk.Dec
+	// Voted are the prices the round voted with, if they were recorded. They differ from the
+	// aggregation of the quotes if a denom fell back to a direct provider or the cache.
+	Voted map[string]sdk.Dec
+}
+
+// OnChainRate is the weighted median the oracle module tallied for a denom in a round. The
+// standard deviation of the ballot widens the reward band if it is larger, and is nil if unknown.
+type OnChainRate struct {
+	Median            sdk.Dec
+	StandardDeviation sdk.Dec
+}
+
+// DenomReplay is how the votes of a denom would have done in a replay.
+type DenomReplay struct {
+	Denom string `json:"denom"`
+	// Rounds are the rounds the vote was compared with an on-chain rate.
+	Rounds int `json:"rounds"`
+	// Outside are the rounds the vote was outside of the reward band.
+	Outside     int     `json:"outside"`
+	OutsideRate float64 `json:"outside_rate"`
+	// MaxDeviation is the largest |vote / median - 1| of the rounds.
+	MaxDeviation sdk.Dec `json:"max_deviation"`
+	// OutsideRounds lists the rounds that were outside of the reward band.
+	OutsideRounds []int64 `json:"outside_rounds"`
+}
+
+// ReplayReport is the outcome of running recorded quotes through the aggregation.
+type ReplayReport struct {
+	RewardBand sdk.Dec `json:"reward_band"`
+	// Rounds are the rounds that were read, and Failed those the aggregation failed for.
+	Rounds int `json:"rounds"`
+	Failed int `json:"failed"`
+	// MissingRounds lists the rounds that were skipped because they had no LUNA quotes or no
+	// quote of an fx symbol.
+	MissingRounds []int64 `json:"missing_rounds"`
+	// VotedDiffers lists the rounds whose recorded votes are not the aggregation of their quotes,
+	// so the replay does not show how the round did.
+	VotedDiffers []int64       `json:"voted_differs"`
+	Denoms       []DenomReplay `json:"denoms"`
+}
+
+// missingQuotes tells what the aggregation of the quotes needs but was not recorded, empty if nothing.
+func missingQuotes(q ReplayQuotes) string {
+	missing := []string{}
+	if len(q.Luna) == 0 {
+		missing = append(missing, "LUNA")
+	}
+	for _, denom := range activeDenoms {
+		symbol, ok := FX_DENOM_SYMBOLS[denom]
+		if !ok {
+			continue
+		}
+		if _, ok := q.Fx[symbol]; !ok {
+			missing = append(missing, symbol)
+		}
+	}
+	return strings.Join(missing, ",")
+}
+
+// votedDiffers tells whether the recorded votes of a round are not the aggregated votes.
+func votedDiffers(voted map[string]sdk.Dec, votes map[string]sdk.Dec) bool {
+	if voted == nil {
+		return false
+	}
+	for _, denom := range activeDenoms {
+		if !voted[denom].IsNil() && (votes[denom].IsNil() || !voted[denom].Equal(votes[denom])) {
+			return true
+		}
+	}
+	return false
+}
+
+// Replay aggregates the quotes of every round the same way getLUNAPrices does and compares the
+// votes with the on-chain rates. Votes prevoted in a round are revealed and tallied in the next
+// one, so the quotes of round r are compared with the rates of round r+1. Like the oracle
+// module, a vote is within the reward band if it is at most the larger of median * rewardBand / 2
+// and the standard deviation away from the median. Unlike it, the votes are compared per denom
+// and not as cross rates against the reference denom. Rounds with missing quotes are skipped, and
+// rounds that voted other prices than the aggregation are listed in VotedDiffers.
+func Replay(quotes []ReplayQuotes, rates map[int64]map[string]OnChainRate, rewardBand sdk.Dec) ReplayReport {
+	report := ReplayReport{RewardBand: rewardBand, MissingRounds: []int64{}, VotedDiffers: []int64{}}
+	denoms := map[string]*DenomReplay{}
+	for _, denom := range activeDenoms {
+		denoms[denom] = &DenomReplay{Denom: denom, MaxDeviation: sdk.ZeroDec(), OutsideRounds: []int64{}}
+	}
+
+	for _, q := range quotes {
+		report.Rounds++
+		if missing := missingQuotes(q); missing != "" {
+			logger.Debug("replay_round_missing", "round", q.Round, "missing", missing)
+			report.MissingRounds = append(report.MissingRounds, q.Round)
+			if q.Voted != nil {
+				report.VotedDiffers = append(report.VotedDiffers, q.Round)
+			}
+			continue
+		}
+		votes, err := aggregateLUNAPrices(q.Luna, q.Fx)
+		if err != nil {
+			logger.Debug("replay_round_failed", "round", q.Round, "error", err)
+			report.Failed++
+			if q.Voted != nil {
+				report.VotedDiffers = append(report.VotedDiffers, q.Round)
+			}
+			continue
+		}
+		if votedDiffers(q.Voted, votes) {
+			logger.Debug("replay_voted_differs", "round", q.Round, "voted", q.Voted, "replayed", votes)
+			report.VotedDiffers = append(report.VotedDiffers, q.Round)
+		}
+
+		for denom, vote := range votes {
+			rate, ok := rates[q.Round+1][denom]
+			d, active := denoms[denom]
+			if !ok || !active || !rate.Median.IsPositive() {
+				continue
+			}
+			spread := rate.Median.Mul(rewardBand.QuoInt64(2))
+			if !rate.StandardDeviation.IsNil() && rate.StandardDeviation.GT(spread) {
+				spread = rate.StandardDeviation
+			}
+			d.Rounds++
+			if vote.Sub(rate.Median).Abs().GT(spread) {
+				d.Outside++
+				d.OutsideRounds = append(d.OutsideRounds, q.Round)
+			}
+			if deviation := vote.Quo(rate.Median).Sub(sdk.OneDec()).Abs(); deviation.GT(d.MaxDeviation) {
+				d.MaxDeviation = deviation
+			}
+		}
+	}
+
+	for _, denom := range activeDenoms {
+		d := denoms[denom]
+		if d.Rounds > 0 {
+			d.OutsideRate = float64(d.Outside) / float64(d.Rounds)
+		}
+		report.Denoms = append(report.Denoms, *d)
+	}
+	return report
+}
+
+// sortQuotes orders the quotes by round.
+func sortQuotes(byRound map[int64]ReplayQuotes) []ReplayQuotes {
+	quotes := []ReplayQuotes{}
+	for _, q := range byRound {
+		quotes = append(quotes, q)
+	}
+	sort.Slice(quotes, func(i, j int) bool { return quotes[i].Round < quotes[j].Round })
+	return quotes
+}
+
+// ReadAuditQuotes reads the Band quotes of every round from the audit log at path and its rotated
+// files, along with the prices the round voted with if it succeeded. If a round was tried more
+// than once, the last quotes of it are kept.
+func ReadAuditQuotes(path string) ([]ReplayQuotes, error) {
+	files := auditFiles(path)
+	if len(files) == 0 {
+		return nil, fmt.Errorf("audit log %s does not exist", path)
+	}
+
+	byRound := map[int64]ReplayQuotes{}
+	for _, name := range files {
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, err
+		}
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for line := 1; scanner.Scan(); line++ {
+			var record AuditRecord
+			err = json.Unmarshal(scanner.Bytes(), &record)
+			if err != nil {
+				file.Close()
+				return nil, fmt.Errorf("fail to unmarshal line %d of %s: %v", line, name, err)
+			}
+			if record.Fetch == nil {
+				continue
+			}
+			q := ReplayQuotes{Round: record.Round, Luna: record.Fetch.Band.Luna, Fx: record.Fetch.Band.Fx}
+			if record.Error == "" {
+				q.Voted = record.Prices
+			}
+			byRound[record.Round] = q
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sortQuotes(byRound), nil
+}
+
+// readCSV reads the rows of a CSV file with the given number of columns, or more if optional,
+// skipping a header row that starts with "round".
+func readCSV(r io.Reader, name string, columns int, optional int) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("fail to read %s: %v", name, err)
+	}
+	if len(rows) > 0 && len(rows[0]) > 0 && strings.EqualFold(rows[0][0], "round") {
+		rows = rows[1:]
+	}
+	for idx, row := range rows {
+		if len(row) < columns || len(row) > columns+optional {
+			return nil, fmt.Errorf("row %d of %s has %d columns, expect %d", idx+1, name, len(row), columns)
+		}
+	}
+	return rows, nil
+}
+
+// ReadCSVQuotes reads quotes from a CSV of round,source,currency,price rows. The rows of the fx
+// source are the USD prices of the fx symbols in their currency column.
+func ReadCSVQuotes(r io.Reader, name string) ([]ReplayQuotes, error) {
+	rows, err := readCSV(r, name, 4, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	byRound := map[int64]ReplayQuotes{}
+	for idx, row := range rows {
+		round, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid round in row %d of %s: %v", idx+1, name, err)
+		}
+		price, err := sdk.NewDecFromStr(row[3])
+		if err != nil {
+			return nil, fmt.Errorf("invalid price in row %d of %s: %v", idx+1, name, err)
+		}
+
+		q, ok := byRound[round]
+		if !ok {
+			q = ReplayQuotes{Round: round, Fx: map[string]sdk.Dec{}}
+		}
+		if row[1] == FX_QUOTE_SOURCE {
+			q.Fx[row[2]] = price
+		} else {
+			q.Luna = append(q.Luna, LunaSourcePrice{Source: row[1], Currency: row[2], Price: price})
+		}
+		byRound[round] = q
+	}
+	return sortQuotes(byRound), nil
+}
+
+// ReadCSVRates reads on-chain rates from a CSV of round,denom,rate rows, with an optional fourth
+// column of the standard deviation of the ballot. The round of a rate is the one it was tallied at
+// the end of.
+func ReadCSVRates(r io.Reader, name string) (map[int64]map[string]OnChainRate, error) {
+	rows, err := readCSV(r, name, 3, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	rates := map[int64]map[string]OnChainRate{}
+	for idx, row := range rows {
+		round, err := strconv.ParseInt(row[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid round in row %d of %s: %v", idx+1, name, err)
+		}
+		rate := OnChainRate{}
+		rate.Median, err = sdk.NewDecFromStr(row[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate in row %d of %s: %v", idx+1, name, err)
+		}
+		if len(row) > 3 && row[3] != "" {
+			rate.StandardDeviation, err = sdk.NewDecFromStr(row[3])
+			if err != nil {
+				return nil, fmt.Errorf("invalid standard deviation in row %d of %s: %v", idx+1, name, err)
+			}
+		}
+		if rates[round] == nil {
+			rates[round] = map[string]OnChainRate{}
+		}
+		rates[round][row[1]] = rate
+	}
+	return rates, nil
+}
+
+func readCSVFile(path string, read func(r io.Reader) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return read(file)
+}
+
+// runReplay is the replay command.
+func runReplay(args []string) error {
+	fs := newFlagSet("replay")
+	configPath := configFlag(fs)
+	auditPath := fs.String("audit", "", "audit log to read the quotes from")
+	quotesPath := fs.String("quotes", "", "CSV of round,source,currency,price rows to read the quotes from, instead of -audit")
+	ratesPath := fs.String("rates", "", "CSV of round,denom,rate[,standard_deviation] rows of the on-chain rates")
+	rewardBand := fs.String("reward-band", "", "reward band to compare with, that of the oracle params of the chain if empty")
+	fs.Parse(args)
+
+	loadConfig(*configPath)
+
+	if (*auditPath == "") == (*quotesPath == "") {
+		return fmt.Errorf("set one of -audit and -quotes")
+	}
+	if *ratesPath == "" {
+		return fmt.Errorf("set -rates")
+	}
+
+	var quotes []ReplayQuotes
+	var err error
+	if *auditPath != "" {
+		quotes, err = ReadAuditQuotes(*auditPath)
+	} else {
+		err = readCSVFile(*quotesPath, func(r io.Reader) (err error) {
+			quotes, err = ReadCSVQuotes(r, *quotesPath)
+			return err
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	var rates map[int64]map[string]OnChainRate
+	err = readCSVFile(*ratesPath, func(r io.Reader) (err error) {
+		rates, err = ReadCSVRates(r, *ratesPath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	var band sdk.Dec
+	if *rewardBand != "" {
+		band, err = sdk.NewDecFromStr(*rewardBand)
+		if err != nil {
+			return fmt.Errorf("invalid reward band %s: %v", *rewardBand, err)
+		}
+	} else {
+		feeder := NewFeeder()
+		err = feeder.fetchParams()
+		if err != nil {
+			return fmt.Errorf("%v, set -reward-band to replay without the chain", err)
+		}
+		band = feeder.Params.RewardBand
+	}
+
+	return printJSON(Replay(quotes, rates, band))
+}
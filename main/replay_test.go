@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// replayQuotes are three USD sources of LUNA at 1, which aggregate into 1000 ukrw, 1 uusd,
+// 2500 umnt and 0.8 usdr.
+func replayQuotes(round int64) ReplayQuotes {
+	return ReplayQuotes{
+		Round: round,
+		Luna: []LunaSourcePrice{
+			{Source: "binance", Currency: "USD", Price: sdk.MustNewDecFromStr("1")},
+			{Source: "huobi", Currency: "USD", Price: sdk.MustNewDecFromStr("1")},
+			{Source: "kraken", Currency: "USD", Price: sdk.MustNewDecFromStr("1")},
+		},
+		Fx: decs(map[string]string{"KRW": "0.001", "MNT": "0.0004", "XDR": "1.25"}),
+	}
+}
+
+func onChainRate(median string, sd string) OnChainRate {
+	rate := OnChainRate{Median: sdk.MustNewDecFromStr(median)}
+	if sd != "" {
+		rate.StandardDeviation = sdk.MustNewDecFromStr(sd)
+	}
+	return rate
+}
+
+func TestReplay(t *testing.T) {
+	voted := replayQuotes(11)
+	voted.Voted = decs(map[string]string{"ukrw": "1000", "uusd": "1", "umnt": "2500", "usdr": "0.8"})
+	noXDR := replayQuotes(12)
+	delete(noXDR.Fx, "XDR")
+	tooFew := replayQuotes(13)
+	tooFew.Luna = tooFew.Luna[:2]
+	tooFew.Voted = decs(map[string]string{"uusd": "1"})
+	fallback := replayQuotes(14)
+	fallback.Voted = decs(map[string]string{"ukrw": "1000", "uusd": "1.1", "umnt": "2500", "usdr": "0.8"})
+	quotes := []ReplayQuotes{replayQuotes(10), voted, noXDR, tooFew, fallback}
+
+	rates := map[int64]map[string]OnChainRate{
+		// The votes of the quotes of round 10 are tallied in round 11, so these rates are not compared.
+		10: {"uusd": onChainRate("5", "")},
+		// 1000 ukrw is 20 from the median, outside of the 1% half band.
+		11: {"ukrw": onChainRate("1020", ""), "uusd": onChainRate("1", ""), "umnt": onChainRate("2500", ""), "usdr": onChainRate("0.8", "")},
+		// The standard deviation widens the band to 25.
+		12: {"ukrw": onChainRate("1020", "25"), "uusd": onChainRate("1", "0.001")},
+		// 0.005 from the median is within 1% of 1.005.
+		15: {"uusd": onChainRate("1.005", "")},
+	}
+
+	report := Replay(quotes, rates, sdk.MustNewDecFromStr("0.02"))
+	if report.Rounds != 5 || report.Failed != 1 {
+		t.Errorf("Rounds = %d and Failed = %d, want 5 and 1", report.Rounds, report.Failed)
+	}
+	if !reflect.DeepEqual(report.MissingRounds, []int64{12}) {
+		t.Errorf("MissingRounds = %v, want [12]", report.MissingRounds)
+	}
+	if !reflect.DeepEqual(report.VotedDiffers, []int64{13, 14}) {
+		t.Errorf("VotedDiffers = %v, want [13 14]", report.VotedDiffers)
+	}
+
+	want := map[string]struct {
+		rounds        int
+		outsideRounds []int64
+		maxDeviation  string
+	}{
+		"ukrw": {2, []int64{10}, "0.019607843137254902"},
+		"uusd": {3, []int64{}, "0.004975124378109453"},
+		"umnt": {1, []int64{}, "0"},
+		"usdr": {1, []int64{}, "0"},
+	}
+	for _, d := range report.Denoms {
+		w := want[d.Denom]
+		if d.Rounds != w.rounds || d.Outside != len(w.outsideRounds) || !reflect.DeepEqual(d.OutsideRounds, w.outsideRounds) {
+			t.Errorf("%s compared %d rounds with %v outside, want %d with %v", d.Denom, d.Rounds, d.OutsideRounds, w.rounds, w.outsideRounds)
+		}
+		if !d.MaxDeviation.Equal(sdk.MustNewDecFromStr(w.maxDeviation)) {
+			t.Errorf("%s MaxDeviation = %s, want %s", d.Denom, d.MaxDeviation, w.maxDeviation)
+		}
+	}
+}
+
+func TestReadCSVQuotes(t *testing.T) {
+	csv := `round,source,currency,price
+11,binance,USD,1.01
+10,binance,USD,1
+10,upbit,KRW,1100
+10,fx,KRW,0.00085
+11,fx,XDR,1.25
+`
+	quotes, err := ReadCSVQuotes(strings.NewReader(csv), "quotes.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ReplayQuotes{
+		{
+			Round: 10,
+			Luna: []LunaSourcePrice{
+				{Source: "binance", Currency: "USD", Price: sdk.MustNewDecFromStr("1")},
+				{Source: "upbit", Currency: "KRW", Price: sdk.MustNewDecFromStr("1100")},
+			},
+			Fx: decs(map[string]string{"KRW": "0.00085"}),
+		},
+		{
+			Round: 11,
+			Luna:  []LunaSourcePrice{{Source: "binance", Currency: "USD", Price: sdk.MustNewDecFromStr("1.01")}},
+			Fx:    decs(map[string]string{"XDR": "1.25"}),
+		},
+	}
+	if fmt.Sprint(quotes) != fmt.Sprint(want) {
+		t.Errorf("ReadCSVQuotes = %v, want %v", quotes, want)
+	}
+
+	for _, tc := range []struct {
+		csv string
+		err string
+	}{
+		{"10,binance,USD", "row 1 of quotes.csv has 3 columns, expect 4"},
+		{"10,binance,USD,1,2", "row 1 of quotes.csv has 5 columns, expect 4"},
+		{"ten,binance,USD,1", "invalid round in row 1 of quotes.csv"},
+		{"round,source,currency,price\n10,binance,USD,one", "invalid price in row 1 of quotes.csv"},
+	} {
+		_, err := ReadCSVQuotes(strings.NewReader(tc.csv), "quotes.csv")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("ReadCSVQuotes(%q) returned %v, want %q", tc.csv, err, tc.err)
+		}
+	}
+}
+
+func TestReadCSVRates(t *testing.T) {
+	csv := `round,denom,rate,standard_deviation
+11,ukrw,1020,25
+11,uusd,1,
+12,uusd,1.005
+`
+	rates, err := ReadCSVRates(strings.NewReader(csv), "rates.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rates) != 2 || len(rates[11]) != 2 || len(rates[12]) != 1 {
+		t.Fatalf("ReadCSVRates = %v, want 2 rates of round 11 and 1 of round 12", rates)
+	}
+	if krw := rates[11]["ukrw"]; !krw.Median.Equal(sdk.NewDec(1020)) || !krw.StandardDeviation.Equal(sdk.NewDec(25)) {
+		t.Errorf("ukrw rate of round 11 = %+v, want 1020 with a standard deviation of 25", krw)
+	}
+	for _, rate := range []OnChainRate{rates[11]["uusd"], rates[12]["uusd"]} {
+		if !rate.StandardDeviation.IsNil() {
+			t.Errorf("rate %+v without a standard deviation has one", rate)
+		}
+	}
+
+	for _, tc := range []struct {
+		csv string
+		err string
+	}{
+		{"11,ukrw", "row 1 of rates.csv has 2 columns, expect 3"},
+		{"11,ukrw,1020,25,1", "row 1 of rates.csv has 5 columns, expect 3"},
+		{"11,ukrw,high", "invalid rate in row 1 of rates.csv"},
+		{"11,ukrw,1020,wide", "invalid standard deviation in row 1 of rates.csv"},
+	} {
+		_, err := ReadCSVRates(strings.NewReader(tc.csv), "rates.csv")
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("ReadCSVRates(%q) returned %v, want %q", tc.csv, err, tc.err)
+		}
+	}
+}
+
+func TestReadAuditQuotes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	q := replayQuotes(0)
+	fetch := &PriceFetch{Band: BandPrices{Luna: q.Luna, Fx: q.Fx}}
+	prices := decs(map[string]string{"ukrw": "1000", "uusd": "1", "umnt": "2500", "usdr": "0.8"})
+	write := func(path string, records ...AuditRecord) {
+		lines := []string{}
+		for _, record := range records {
+			bz, err := json.Marshal(record)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lines = append(lines, string(bz))
+		}
+		err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The rotated file has the first try of round 10, which failed before fetching the prices.
+	write(path+".1", AuditRecord{Round: 10, Error: "node down"})
+	write(path,
+		AuditRecord{Round: 10, Fetch: fetch, Prices: prices},
+		// Round 11 fetched the prices but failed to broadcast them, so it voted nothing.
+		AuditRecord{Round: 11, Fetch: fetch, Prices: prices, Error: "mempool full"},
+		// Band was down in round 12 and a direct provider resolved every denom.
+		AuditRecord{Round: 12, Fetch: &PriceFetch{}, Prices: prices},
+	)
+
+	quotes, err := ReadAuditQuotes(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(quotes) != 3 {
+		t.Fatalf("ReadAuditQuotes returned %d rounds, want 3", len(quotes))
+	}
+	for idx, round := range []int64{10, 11, 12} {
+		if quotes[idx].Round != round {
+			t.Errorf("round %d of the quotes is %d, want %d", idx, quotes[idx].Round, round)
+		}
+	}
+	if fmt.Sprint(quotes[0].Luna) != fmt.Sprint(q.Luna) || fmt.Sprint(quotes[0].Voted) != fmt.Sprint(prices) {
+		t.Errorf("quotes of round 10 = %+v, want the Band quotes voted with %v", quotes[0], prices)
+	}
+	if quotes[1].Voted != nil {
+		t.Errorf("failed round 11 voted %v", quotes[1].Voted)
+	}
+
+	report := Replay(quotes, nil, sdk.MustNewDecFromStr("0.02"))
+	if !reflect.DeepEqual(report.MissingRounds, []int64{12}) || !reflect.DeepEqual(report.VotedDiffers, []int64{12}) {
+		t.Errorf("Replay of the audit log has missing rounds %v and differing rounds %v, want [12] and [12]", report.MissingRounds, report.VotedDiffers)
+	}
+
+	_, err = ReadAuditQuotes(filepath.Join(t.TempDir(), "missing.jsonl"))
+	if err == nil || !strings.Contains(err.Error(), "does not exist") {
+		t.Errorf("ReadAuditQuotes of a missing log returned %v", err)
+	}
+}
@@ -0,0 +1,422 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// RoundState is where a RoundEngine is within a round of prevoting and voting.
+type RoundState int
+
+const (
+	RoundIdle RoundState = iota
+	RoundFetchingPrices
+	RoundCommitting
+	RoundBroadcasting
+	RoundAwaitingConfirmation
+)
+
+var roundStateNames = []string{"idle", "fetching prices", "committing", "broadcasting", "awaiting confirmation"}
+
+func (s RoundState) String() string {
+	if int(s) < 0 || int(s) >= len(roundStateNames) {
+		return fmt.Sprintf("RoundState(%d)", int(s))
+	}
+	return roundStateNames[s]
+}
+
+// ChainClient is the part of a Terra node a RoundEngine talks to.
+type ChainClient interface {
+	// Prevotes returns the prevotes of the validator that are in the store.
+	Prevotes(validator sdk.ValAddress) (terra_types.ExchangeRatePrevotes, error)
+	BroadcastTx(txBytes []byte) (sdk.TxResponse, error)
+	// QueryTx returns a transaction that was included in a block by its hash.
+	QueryTx(hash string) (sdk.TxResponse, error)
+}
+
+// PriceSource provides the price of every active denom.
+type PriceSource interface {
+	Prices() (map[string]sdk.Dec, error)
+}
+
+// PriceReporter is a PriceSource that can tell what it saw when it last fetched the prices.
+type PriceReporter interface {
+	LastFetch() PriceFetch
+}
+
+// Signer builds and signs a transaction of the messages.
+type Signer interface {
+	Sign(msgs []sdk.Msg) ([]byte, error)
+}
+
+// Clock tells the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+// DEFAULT_CONFIRM_TIMEOUT is how long a RoundEngine waits for a broadcast transaction to be included in a block.
+var DEFAULT_CONFIRM_TIMEOUT = 30 * time.Second
+
+// RoundEngine runs the prevote and vote rounds of a validator. Once per vote period it fetches the
+// prevotes and prices, reveals the votes of the previous round if all of them were prevoted, commits
+// new votes and broadcasts the votes with the prevotes of the new ones. A failed round is retried on
+// the next Step in the same vote period.
+type RoundEngine struct {
+	Chain     ChainClient
+	Prices    PriceSource
+	Signer    Signer
+	Clock     Clock
+	Validator sdk.ValAddress
+	Params    terra_types.Params
+	Timing    SubmitTiming
+	// ConfirmTimeout is how long to wait for a transaction that was accepted but not yet included.
+	ConfirmTimeout time.Duration
+	// Audit keeps a record of every round that ends, if it is set.
+	Audit AuditSink
+	// RevealOnly makes a round reveal the votes of the previous round without fetching prices and
+	// prevoting new votes. The round fails if there are no votes to reveal.
+	RevealOnly bool
+
+	State            RoundState
+	LastPrevoteRound int64
+
+	// votes are the votes whose prevotes were confirmed in the last round.
+	votes map[string]terra_types.MsgExchangeRateVote
+	// lastTx is the last transaction that was included or rejected, broadcast in lastTxRound.
+	lastTx      *sdk.TxResponse
+	lastTxRound int64
+
+	// The round in progress.
+	round     int64
+	prevotes  terra_types.ExchangeRatePrevotes
+	prices    map[string]sdk.Dec
+	reveal    bool
+	newVotes  map[string]terra_types.MsgExchangeRateVote
+	msgs      []sdk.Msg
+	pendingTx sdk.TxResponse
+	deadline  time.Time
+	audit     AuditRecord
+}
+
+func NewRoundEngine(chain ChainClient, prices PriceSource, signer Signer, clock Clock, validator sdk.ValAddress, params terra_types.Params) *RoundEngine {
+	return &RoundEngine{
+		Chain:          chain,
+		Prices:         prices,
+		Signer:         signer,
+		Clock:          clock,
+		Validator:      validator,
+		Params:         params,
+		Timing:         DefaultSubmitTiming(),
+		ConfirmTimeout: DEFAULT_CONFIRM_TIMEOUT,
+		State:          RoundIdle,
+		votes:          map[string]terra_types.MsgExchangeRateVote{},
+	}
+}
+
+// Step moves the engine forward at the given block height. It starts a new round when the height is
+// in a vote period that has no confirmed round yet and within the submit window of Timing, and goes
+// through the states until the round is done or is waiting for its transaction to be included. An
+// error ends the round in progress.
+func (e *RoundEngine) Step(height int64) error {
+	if e.State == RoundIdle {
+		round := height / e.Params.VotePeriod
+		if round <= e.LastPrevoteRound || !e.Timing.ShouldSubmit(height, e.Params.VotePeriod) {
+			return nil
+		}
+		e.round = round
+		e.State = RoundFetchingPrices
+		e.audit = AuditRecord{Round: round, VotePeriod: e.Params.VotePeriod, Height: height, Time: e.Clock.Now()}
+	}
+
+	for e.State != RoundIdle {
+		var next RoundState
+		var err error
+		switch e.State {
+		case RoundFetchingPrices:
+			next, err = e.fetchPrices()
+		case RoundCommitting:
+			next, err = e.commit()
+		case RoundBroadcasting:
+			next, err = e.broadcast()
+		case RoundAwaitingConfirmation:
+			next, err = e.awaitConfirmation()
+		default:
+			next, err = RoundIdle, fmt.Errorf("unknown round state %s", e.State)
+		}
+		if err != nil {
+			e.State = RoundIdle
+			e.writeAudit(err)
+			return err
+		}
+		if next == e.State {
+			return nil
+		}
+		e.State = next
+	}
+	e.writeAudit(nil)
+	return nil
+}
+
+// writeAudit records the round that ended with the error, nil if it succeeded.
+func (e *RoundEngine) writeAudit(err error) {
+	if e.Audit == nil {
+		return
+	}
+	if err != nil {
+		e.audit.Error = err.Error()
+	}
+	werr := e.Audit.Record(e.audit)
+	if werr != nil {
+		logger.Error("audit_write_failed", "round", e.audit.Round, "error", werr)
+	}
+}
+
+func (e *RoundEngine) fetchPrices() (RoundState, error) {
+	logger.Debug("prevotes_fetching", "round", e.round)
+	prevotes, err := e.Chain.Prevotes(e.Validator)
+	if err != nil {
+		return RoundIdle, err
+	}
+
+	e.audit.Prevotes = prevotes
+	e.prevotes = prevotes
+	if e.RevealOnly {
+		return RoundCommitting, nil
+	}
+
+	prices, err := e.Prices.Prices()
+	if reporter, ok := e.Prices.(PriceReporter); ok {
+		fetch := reporter.LastFetch()
+		e.audit.Fetch = &fetch
+	}
+	if err != nil {
+		return RoundIdle, err
+	}
+
+	e.prices = prices
+	e.audit.Prices = prices
+	return RoundCommitting, nil
+}
+
+func (e *RoundEngine) commit() (RoundState, error) {
+	pass1 := hasPrevotesForAllDenom(e.prevotes)
+	pass2 := e.allVotesAndPrevotesAreCorrespond(e.prevotes)
+	pass3 := prevotesAreFromRound(e.prevotes, e.round-1, e.Params.VotePeriod)
+
+	if !pass1 {
+		logger.Info("prevotes_missing", "round", e.round)
+	}
+	if !pass2 {
+		logger.Warn("votes_mismatch_prevotes", "round", e.round)
+	}
+	if !pass3 {
+		logger.Warn("prevotes_stale", "round", e.round)
+	}
+
+	e.reveal = pass1 && pass2 && pass3
+	e.msgs = []sdk.Msg{}
+	if e.reveal {
+		logger.Info("votes_revealing", "round", e.round)
+		for _, denom := range activeDenoms {
+			e.msgs = append(e.msgs, e.votes[denom])
+		}
+	} else if e.RevealOnly {
+		return RoundIdle, fmt.Errorf("no votes of round %d to reveal", e.round-1)
+	} else {
+		logger.Info("prevotes_only", "round", e.round)
+	}
+
+	newVotes := map[string]terra_types.MsgExchangeRateVote{}
+	if !e.RevealOnly {
+		var err error
+		newVotes, err = e.commitNewVotes(e.prices)
+		if err != nil {
+			return RoundIdle, err
+		}
+		prevotes, err := e.msgPrevotes(newVotes)
+		if err != nil {
+			return RoundIdle, err
+		}
+		for _, x := range prevotes {
+			e.msgs = append(e.msgs, x)
+		}
+	}
+	e.newVotes = newVotes
+
+	e.audit.Reveal = e.reveal
+	if e.reveal {
+		e.audit.Revealed = auditVotes(e.votes, e.Validator)
+	}
+	e.audit.Committed = auditVotes(newVotes, e.Validator)
+	var err error
+	e.audit.Msgs, err = cdc.MarshalJSON(e.msgs)
+	if err != nil {
+		return RoundIdle, fmt.Errorf("fail to marshal messages: %v", err)
+	}
+	return RoundBroadcasting, nil
+}
+
+func (e *RoundEngine) broadcast() (RoundState, error) {
+	txBytes, err := e.Signer.Sign(e.msgs)
+	if err != nil {
+		return RoundIdle, err
+	}
+
+	res, err := e.Chain.BroadcastTx(txBytes)
+	if err != nil {
+		return RoundIdle, err
+	}
+
+	logger.Info("tx_broadcast", "round", e.round, "tx_hash", res.TxHash, "messages", len(e.msgs))
+	e.audit.TxHash = res.TxHash
+	e.pendingTx = res
+	e.deadline = e.Clock.Now().Add(e.ConfirmTimeout)
+	return RoundAwaitingConfirmation, nil
+}
+
+func (e *RoundEngine) awaitConfirmation() (RoundState, error) {
+	if e.pendingTx.Code == 0 && e.pendingTx.Height == 0 {
+		res, err := e.Chain.QueryTx(e.pendingTx.TxHash)
+		if err != nil {
+			if e.Clock.Now().After(e.deadline) {
+				return RoundIdle, fmt.Errorf("transaction %s is not included within %s: %v", e.pendingTx.TxHash, e.ConfirmTimeout, err)
+			}
+			return RoundAwaitingConfirmation, nil
+		}
+		e.pendingTx = res
+	}
+
+	tx := e.pendingTx
+	e.lastTx = &tx
+	e.lastTxRound = e.round
+	e.audit.TxHeight = tx.Height
+	e.audit.Code = tx.Code
+	e.audit.Log = tx.RawLog
+	if e.pendingTx.Code != 0 {
+		logger.Error("tx_failed", "round", e.round, "height", e.pendingTx.Height, "tx_hash", e.pendingTx.TxHash, "code", e.pendingTx.Code, "log", e.pendingTx.RawLog)
+		return RoundIdle, fmt.Errorf("transaction %s failed with code %d: %s", e.pendingTx.TxHash, e.pendingTx.Code, e.pendingTx.RawLog)
+	}
+	logger.Info("tx_confirmed", "round", e.round, "height", e.pendingTx.Height, "tx_hash", e.pendingTx.TxHash, "reveal", e.reveal)
+
+	e.votes = e.newVotes
+	e.LastPrevoteRound = e.round
+	if included := e.pendingTx.Height / e.Params.VotePeriod; included > e.round {
+		// The prevotes landed in a later vote period, which is the one to reveal them after.
+		logger.Warn("tx_late", "round", e.round, "included_round", included, "tx_hash", e.pendingTx.TxHash)
+		e.LastPrevoteRound = included
+	}
+	return RoundIdle, nil
+}
+
+// RoundSnapshot is what a RoundEngine reports about its rounds.
+type RoundSnapshot struct {
+	State            RoundState
+	LastPrevoteRound int64
+	LastTx           *sdk.TxResponse
+	LastTxRound      int64
+	// PendingVotes are the rates prevoted in the last round that are yet to be revealed.
+	PendingVotes map[string]sdk.Dec
+	// Prices are the prices fetched in the latest round.
+	Prices map[string]sdk.Dec
+}
+
+func (e *RoundEngine) Snapshot() RoundSnapshot {
+	snapshot := RoundSnapshot{
+		State:            e.State,
+		LastPrevoteRound: e.LastPrevoteRound,
+		LastTxRound:      e.lastTxRound,
+		PendingVotes:     map[string]sdk.Dec{},
+		Prices:           map[string]sdk.Dec{},
+	}
+	if e.lastTx != nil {
+		tx := *e.lastTx
+		snapshot.LastTx = &tx
+	}
+	for denom, vote := range e.votes {
+		snapshot.PendingVotes[denom] = vote.ExchangeRate
+	}
+	for denom, price := range e.prices {
+		snapshot.Prices[denom] = price
+	}
+	return snapshot
+}
+
+// commitNewVotes makes the votes of the prices with a new salt.
+func (e *RoundEngine) commitNewVotes(prices map[string]sdk.Dec) (map[string]terra_types.MsgExchangeRateVote, error) {
+	// Salt legnth should be 1~4
+	// We use 4 here
+	salt, err := generateRandomString(4)
+	if err != nil {
+		return nil, err
+	}
+
+	votes := map[string]terra_types.MsgExchangeRateVote{}
+	for denom, value := range prices {
+		votes[denom] = terra_types.NewMsgExchangeRateVote(
+			value,
+			salt,
+			denom,
+			sdk.AccAddress(e.Validator),
+			e.Validator,
+		)
+	}
+	return votes, nil
+}
+
+func (e *RoundEngine) msgPrevotes(votes map[string]terra_types.MsgExchangeRateVote) ([]terra_types.MsgExchangeRatePrevote, error) {
+	msgs := []terra_types.MsgExchangeRatePrevote{}
+
+	for _, denom := range activeDenoms {
+		vote, ok := votes[denom]
+		if !ok {
+			return nil, fmt.Errorf("vote for %s not found in %v", denom, votes)
+		}
+
+		voteHash := terra_types.GetVoteHash(vote.Salt, vote.ExchangeRate, vote.Denom, e.Validator)
+		msg := terra_types.NewMsgExchangeRatePrevote(
+			voteHash,
+			denom,
+			sdk.AccAddress(e.Validator),
+			e.Validator,
+		)
+		msgs = append(msgs, msg)
+	}
+
+	return msgs, nil
+}
+
+func (e *RoundEngine) allVotesAndPrevotesAreCorrespond(prevotes terra_types.ExchangeRatePrevotes) bool {
+	for _, pv := range prevotes {
+		vote, ok := e.votes[pv.Denom]
+		if !ok {
+			return false
+		}
+		if vote.Denom != pv.Denom {
+			return false
+		}
+		voteHash := terra_types.GetVoteHash(vote.Salt, vote.ExchangeRate, vote.Denom, e.Validator)
+
+		if !voteHash.Equal(pv.Hash) {
+			return false
+		}
+	}
+	return true
+}
+
+// prevotesAreFromRound tells whether all prevotes were submitted in the vote period of round. Votes
+// can only be revealed in the vote period right after their prevotes.
+func prevotesAreFromRound(prevotes terra_types.ExchangeRatePrevotes, round int64, votePeriod int64) bool {
+	for _, pv := range prevotes {
+		if pv.SubmitBlock/votePeriod != round {
+			return false
+		}
+	}
+	return true
+}
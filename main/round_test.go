@@ -0,0 +1,438 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+const testVotePeriod = 5
+
+// fakeChain is a ChainClient and Signer that keeps the messages of every signed transaction, so that
+// a test can include a transaction and turn its prevotes into the prevotes of the store.
+type fakeChain struct {
+	engine *RoundEngine
+	// states are the states of the engine seen by the fakes, in order.
+	states []RoundState
+
+	prevotes     terra_types.ExchangeRatePrevotes
+	prevotesErr  error
+	signErr      error
+	broadcastErr error
+	// broadcastHeight and broadcastCode are returned by BroadcastTx, as in block mode.
+	broadcastHeight int64
+	broadcastCode   uint32
+
+	txs      [][]sdk.Msg
+	included map[string]sdk.TxResponse
+}
+
+func (c *fakeChain) see() {
+	c.states = append(c.states, c.engine.State)
+}
+
+func (c *fakeChain) Prevotes(validator sdk.ValAddress) (terra_types.ExchangeRatePrevotes, error) {
+	c.see()
+	return c.prevotes, c.prevotesErr
+}
+
+func (c *fakeChain) Sign(msgs []sdk.Msg) ([]byte, error) {
+	c.see()
+	if c.signErr != nil {
+		return nil, c.signErr
+	}
+	c.txs = append(c.txs, msgs)
+	return []byte(fmt.Sprintf("TX%d", len(c.txs))), nil
+}
+
+func (c *fakeChain) BroadcastTx(txBytes []byte) (sdk.TxResponse, error) {
+	c.see()
+	if c.broadcastErr != nil {
+		return sdk.TxResponse{}, c.broadcastErr
+	}
+	return sdk.TxResponse{TxHash: string(txBytes), Height: c.broadcastHeight, Code: c.broadcastCode}, nil
+}
+
+func (c *fakeChain) QueryTx(hash string) (sdk.TxResponse, error) {
+	c.see()
+	res, ok := c.included[hash]
+	if !ok {
+		return sdk.TxResponse{}, fmt.Errorf("tx %s not found", hash)
+	}
+	return res, nil
+}
+
+// lastTx returns the hash and messages of the last signed transaction.
+func (c *fakeChain) lastTx() (string, []sdk.Msg) {
+	return fmt.Sprintf("TX%d", len(c.txs)), c.txs[len(c.txs)-1]
+}
+
+// include includes the last signed transaction at the height, replacing the prevotes of the store
+// with its prevotes.
+func (c *fakeChain) include(height int64) {
+	hash, msgs := c.lastTx()
+	c.included[hash] = sdk.TxResponse{TxHash: hash, Height: height}
+	c.prevotes = terra_types.ExchangeRatePrevotes{}
+	for _, msg := range msgs {
+		if pv, ok := msg.(terra_types.MsgExchangeRatePrevote); ok {
+			c.prevotes = append(c.prevotes, terra_types.NewExchangeRatePrevote(pv.Hash, pv.Denom, pv.Validator, height))
+		}
+	}
+}
+
+type fakePrices struct {
+	chain  *fakeChain
+	prices map[string]sdk.Dec
+	err    error
+}
+
+func (p *fakePrices) Prices() (map[string]sdk.Dec, error) {
+	p.chain.see()
+	return p.prices, p.err
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func testPrices(rate string) map[string]sdk.Dec {
+	prices := map[string]sdk.Dec{}
+	for _, denom := range activeDenoms {
+		prices[denom] = sdk.MustNewDecFromStr(rate)
+	}
+	return prices
+}
+
+func newTestEngine() (*RoundEngine, *fakeChain, *fakePrices, *fakeClock) {
+	chain := &fakeChain{included: map[string]sdk.TxResponse{}}
+	prices := &fakePrices{chain: chain, prices: testPrices("1.5")}
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	params := terra_types.DefaultParams()
+	params.VotePeriod = testVotePeriod
+	validator := sdk.ValAddress([]byte("validator-address-01"))
+	engine := NewRoundEngine(chain, prices, chain, clock, validator, params)
+	chain.engine = engine
+	return engine, chain, prices, clock
+}
+
+// countMsgs counts the votes and prevotes of a transaction.
+func countMsgs(msgs []sdk.Msg) (votes []terra_types.MsgExchangeRateVote, prevotes int) {
+	for _, msg := range msgs {
+		switch msg := msg.(type) {
+		case terra_types.MsgExchangeRateVote:
+			votes = append(votes, msg)
+		case terra_types.MsgExchangeRatePrevote:
+			prevotes++
+		}
+	}
+	return votes, prevotes
+}
+
+func TestRoundStateTransitions(t *testing.T) {
+	engine, chain, _, _ := newTestEngine()
+
+	// Round 0 is never submitted, as LastPrevoteRound starts at 0.
+	err := engine.Step(1)
+	if err != nil || len(chain.states) != 0 {
+		t.Fatalf("Step in round 0 returned %v and saw states %v", err, chain.states)
+	}
+
+	err = engine.Step(2 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []RoundState{RoundFetchingPrices, RoundFetchingPrices, RoundBroadcasting, RoundBroadcasting, RoundAwaitingConfirmation}
+	if fmt.Sprint(chain.states) != fmt.Sprint(want) {
+		t.Errorf("Step went through %v, want %v", chain.states, want)
+	}
+	if engine.State != RoundAwaitingConfirmation {
+		t.Fatalf("State = %s after broadcasting, want %s", engine.State, RoundAwaitingConfirmation)
+	}
+	_, msgs := chain.lastTx()
+	votes, prevotes := countMsgs(msgs)
+	if len(votes) != 0 || prevotes != len(activeDenoms) {
+		t.Errorf("first round sent %d votes and %d prevotes, want only %d prevotes", len(votes), prevotes, len(activeDenoms))
+	}
+
+	// The transaction is not included yet.
+	err = engine.Step(2*testVotePeriod + 1)
+	if err != nil || engine.State != RoundAwaitingConfirmation {
+		t.Fatalf("Step before inclusion returned %v in state %s", err, engine.State)
+	}
+
+	chain.include(2*testVotePeriod + 1)
+	err = engine.Step(2*testVotePeriod + 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engine.State != RoundIdle || engine.LastPrevoteRound != 2 {
+		t.Errorf("after confirmation State = %s and LastPrevoteRound = %d, want idle and 2", engine.State, engine.LastPrevoteRound)
+	}
+
+	// Nothing more happens in the same vote period.
+	txs := len(chain.txs)
+	err = engine.Step(2*testVotePeriod + 3)
+	if err != nil || len(chain.txs) != txs {
+		t.Errorf("Step in a confirmed vote period returned %v and signed %d transactions", err, len(chain.txs)-txs)
+	}
+}
+
+func TestRoundRevealsPrevotesOfPreviousRound(t *testing.T) {
+	engine, chain, prices, _ := newTestEngine()
+	chain.broadcastHeight = 2*testVotePeriod + 1
+
+	err := engine.Step(2 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.include(2*testVotePeriod + 1)
+
+	prices.prices = testPrices("2.5")
+	err = engine.Step(3 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, msgs := chain.lastTx()
+	votes, prevotes := countMsgs(msgs)
+	if len(votes) != len(activeDenoms) || prevotes != len(activeDenoms) {
+		t.Fatalf("second round sent %d votes and %d prevotes, want %d of each", len(votes), prevotes, len(activeDenoms))
+	}
+	for _, vote := range votes {
+		// The votes revealed are those of the prices of the first round.
+		if !vote.ExchangeRate.Equal(sdk.MustNewDecFromStr("1.5")) {
+			t.Errorf("revealed %s for %s, want 1.5", vote.ExchangeRate, vote.Denom)
+		}
+	}
+}
+
+func TestRoundDoesNotRevealStalePrevotes(t *testing.T) {
+	engine, chain, _, _ := newTestEngine()
+	chain.broadcastHeight = 2*testVotePeriod + 1
+
+	err := engine.Step(2 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The prevotes match the votes of the engine, but were submitted in round 1.
+	chain.include(2*testVotePeriod - 1)
+	if !prevotesAreFromRound(chain.prevotes, 1, testVotePeriod) {
+		t.Fatal("prevotes are not from round 1")
+	}
+
+	err = engine.Step(3 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, msgs := chain.lastTx()
+	votes, prevotes := countMsgs(msgs)
+	if len(votes) != 0 || prevotes != len(activeDenoms) {
+		t.Errorf("round after stale prevotes sent %d votes and %d prevotes, want only %d prevotes", len(votes), prevotes, len(activeDenoms))
+	}
+}
+
+func TestRoundRevealOnly(t *testing.T) {
+	engine, chain, prices, _ := newTestEngine()
+	chain.broadcastHeight = 2*testVotePeriod + 1
+
+	err := engine.Step(2 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.include(2*testVotePeriod + 1)
+
+	engine.RevealOnly = true
+	prices.err = errors.New("band down")
+	chain.states = nil
+	chain.broadcastHeight = 3*testVotePeriod + 1
+	err = engine.Step(3 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only the prevotes are fetched, as the prices would fail the round.
+	want := []RoundState{RoundFetchingPrices, RoundBroadcasting, RoundBroadcasting}
+	if fmt.Sprint(chain.states) != fmt.Sprint(want) {
+		t.Errorf("reveal only round went through %v, want %v", chain.states, want)
+	}
+	_, msgs := chain.lastTx()
+	votes, prevotes := countMsgs(msgs)
+	if len(votes) != len(activeDenoms) || prevotes != 0 {
+		t.Errorf("reveal only round sent %d votes and %d prevotes, want only %d votes", len(votes), prevotes, len(activeDenoms))
+	}
+	if engine.LastPrevoteRound != 3 || len(engine.Snapshot().PendingVotes) != 0 {
+		t.Errorf("reveal only round left LastPrevoteRound %d and pending votes %v", engine.LastPrevoteRound, engine.Snapshot().PendingVotes)
+	}
+
+	// There is nothing left to reveal in the next round.
+	txs := len(chain.txs)
+	chain.prevotes = nil
+	err = engine.Step(4 * testVotePeriod)
+	if err == nil || !strings.Contains(err.Error(), "no votes of round 3 to reveal") || len(chain.txs) != txs {
+		t.Errorf("reveal only round without prevotes returned %v and signed %d transactions", err, len(chain.txs)-txs)
+	}
+}
+
+func TestPrevotesAreFromRound(t *testing.T) {
+	prevote := func(block int64) terra_types.ExchangeRatePrevote {
+		return terra_types.NewExchangeRatePrevote(nil, "ukrw", nil, block)
+	}
+	for _, tc := range []struct {
+		blocks []int64
+		round  int64
+		want   bool
+	}{
+		{nil, 3, true},
+		{[]int64{15, 19}, 3, true},
+		{[]int64{14, 15}, 3, false},
+		{[]int64{20}, 3, false},
+	} {
+		prevotes := terra_types.ExchangeRatePrevotes{}
+		for _, block := range tc.blocks {
+			prevotes = append(prevotes, prevote(block))
+		}
+		got := prevotesAreFromRound(prevotes, tc.round, testVotePeriod)
+		if got != tc.want {
+			t.Errorf("prevotesAreFromRound(%v, %d) = %v, want %v", tc.blocks, tc.round, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTxLate(t *testing.T) {
+	engine, chain, _, _ := newTestEngine()
+
+	err := engine.Step(2*testVotePeriod + 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The transaction of round 2 lands in round 3.
+	chain.include(3*testVotePeriod + 1)
+	err = engine.Step(3*testVotePeriod + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if engine.LastPrevoteRound != 3 {
+		t.Fatalf("LastPrevoteRound = %d after a late tx, want 3", engine.LastPrevoteRound)
+	}
+
+	// Round 3 already has the prevotes, which are revealed in round 4.
+	txs := len(chain.txs)
+	err = engine.Step(3*testVotePeriod + 2)
+	if err != nil || len(chain.txs) != txs {
+		t.Fatalf("Step in the round of the late tx returned %v and signed %d transactions", err, len(chain.txs)-txs)
+	}
+	err = engine.Step(4 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, msgs := chain.lastTx()
+	votes, _ := countMsgs(msgs)
+	if len(votes) != len(activeDenoms) {
+		t.Errorf("round after a late tx revealed %d votes, want %d", len(votes), len(activeDenoms))
+	}
+}
+
+func TestRoundRetries(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		fail func(chain *fakeChain, prices *fakePrices, clock *fakeClock)
+		heal func(chain *fakeChain, prices *fakePrices)
+		err  string
+	}{
+		{
+			name: "prevotes",
+			fail: func(chain *fakeChain, prices *fakePrices, clock *fakeClock) {
+				chain.prevotesErr = errors.New("node down")
+			},
+			heal: func(chain *fakeChain, prices *fakePrices) { chain.prevotesErr = nil },
+			err:  "node down",
+		},
+		{
+			name: "prices",
+			fail: func(chain *fakeChain, prices *fakePrices, clock *fakeClock) { prices.err = errors.New("band down") },
+			heal: func(chain *fakeChain, prices *fakePrices) { prices.err = nil },
+			err:  "band down",
+		},
+		{
+			name: "sign",
+			fail: func(chain *fakeChain, prices *fakePrices, clock *fakeClock) { chain.signErr = errors.New("no key") },
+			heal: func(chain *fakeChain, prices *fakePrices) { chain.signErr = nil },
+			err:  "no key",
+		},
+		{
+			name: "broadcast",
+			fail: func(chain *fakeChain, prices *fakePrices, clock *fakeClock) {
+				chain.broadcastErr = errors.New("mempool full")
+			},
+			heal: func(chain *fakeChain, prices *fakePrices) { chain.broadcastErr = nil },
+			err:  "mempool full",
+		},
+		{
+			name: "tx failed",
+			fail: func(chain *fakeChain, prices *fakePrices, clock *fakeClock) {
+				chain.broadcastHeight = 2*testVotePeriod + 1
+				chain.broadcastCode = 3
+			},
+			heal: func(chain *fakeChain, prices *fakePrices) { chain.broadcastCode = 0 },
+			err:  "failed with code 3",
+		},
+	} {
+		engine, chain, prices, clock := newTestEngine()
+		tc.fail(chain, prices, clock)
+		err := engine.Step(2 * testVotePeriod)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: Step returned %v, want %q", tc.name, err, tc.err)
+			continue
+		}
+		if engine.State != RoundIdle || engine.LastPrevoteRound != 0 {
+			t.Errorf("%s: failed round left State %s and LastPrevoteRound %d", tc.name, engine.State, engine.LastPrevoteRound)
+		}
+
+		// The round is retried at the next height of the same vote period.
+		tc.heal(chain, prices)
+		chain.broadcastHeight = 2*testVotePeriod + 1
+		err = engine.Step(2*testVotePeriod + 1)
+		if err != nil {
+			t.Errorf("%s: retried Step returned %v", tc.name, err)
+			continue
+		}
+		if engine.State != RoundIdle || engine.LastPrevoteRound != 2 {
+			t.Errorf("%s: retried round left State %s and LastPrevoteRound %d", tc.name, engine.State, engine.LastPrevoteRound)
+		}
+	}
+}
+
+func TestRoundConfirmTimeout(t *testing.T) {
+	engine, chain, _, clock := newTestEngine()
+
+	err := engine.Step(2 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.now = clock.now.Add(engine.ConfirmTimeout)
+	err = engine.Step(2*testVotePeriod + 1)
+	if err != nil || engine.State != RoundAwaitingConfirmation {
+		t.Fatalf("Step at the deadline returned %v in state %s", err, engine.State)
+	}
+
+	clock.now = clock.now.Add(time.Second)
+	err = engine.Step(2*testVotePeriod + 2)
+	if err == nil || !strings.Contains(err.Error(), "is not included within") {
+		t.Fatalf("Step past the deadline returned %v", err)
+	}
+	if engine.State != RoundIdle || engine.LastPrevoteRound != 0 {
+		t.Fatalf("timed out round left State %s and LastPrevoteRound %d", engine.State, engine.LastPrevoteRound)
+	}
+
+	// A new transaction is signed for the retry.
+	txs := len(chain.txs)
+	err = engine.Step(2*testVotePeriod + 3)
+	if err != nil || len(chain.txs) != txs+1 {
+		t.Errorf("retry after the timeout returned %v and signed %d transactions", err, len(chain.txs)-txs)
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+)
+
+// StatusConfig describes the HTTP server that reports the health and status of the feeder.
+type StatusConfig struct {
+	// ListenAddr is the address to serve on, e.g. ":8080". The server is off if it is empty.
+	ListenAddr string `json:"listen_addr"`
+	// MaxStatusAge is how long ago the main loop may have last run, and last got the status of
+	// the Terra node, for the feeder to be alive and ready.
+	MaxStatusAge Duration `json:"max_status_age"`
+}
+
+func DefaultStatusConfig() StatusConfig {
+	return StatusConfig{ListenAddr: "", MaxStatusAge: Duration{30 * time.Second}}
+}
+
+// TxStatus is the outcome of the last transaction broadcast by the feeder.
+type TxStatus struct {
+	Round  int64  `json:"round"`
+	Hash   string `json:"hash"`
+	Code   uint32 `json:"code"`
+	Height int64  `json:"height"`
+}
+
+// FeederStatus is what the status server reports as /status.
+type FeederStatus struct {
+	LatestHeight    int64     `json:"latest_height"`
+	LatestBlockTime time.Time `json:"latest_block_time"`
+	CatchingUp      bool      `json:"catching_up"`
+	CurrentRound    int64     `json:"current_round"`
+	// StartRound is the vote period of the first block the feeder saw.
+	StartRound       int64     `json:"start_round"`
+	LastPrevoteRound int64     `json:"last_prevote_round"`
+	RoundState       string    `json:"round_state"`
+	LastTx           *TxStatus `json:"last_tx"`
+	// PendingVotes are the rates prevoted in the last round that are yet to be revealed.
+	PendingVotes map[string]sdk.Dec `json:"pending_votes"`
+	// Prices are the latest prices fetched for every denom.
+	Prices       map[string]sdk.Dec `json:"prices"`
+	VotePeriod   int64              `json:"vote_period"`
+	LoopAt       time.Time          `json:"loop_at"`
+	NodeStatusAt time.Time          `json:"node_status_at"`
+	// Performance is how the validator does on-chain in the current slash window, nil until the
+	// miss counter was queried.
+	Performance *OraclePerformance `json:"performance"`
+}
+
+// StatusServer keeps the status of the feeder updated by the main loop and serves /healthz,
+// /readyz and /status.
+type StatusServer struct {
+	MaxStatusAge time.Duration
+	Clock        Clock
+	// KeyAvailable tells whether the key that signs the transactions can be loaded.
+	KeyAvailable func() error
+
+	mtx    sync.Mutex
+	status FeederStatus
+}
+
+func NewStatusServer(cfg StatusConfig, clock Clock, keyAvailable func() error) *StatusServer {
+	return &StatusServer{
+		MaxStatusAge: cfg.MaxStatusAge.Duration,
+		Clock:        clock,
+		KeyAvailable: keyAvailable,
+		status:       FeederStatus{PendingVotes: map[string]sdk.Dec{}, Prices: map[string]sdk.Dec{}},
+	}
+}
+
+// Update changes the status under the lock of the server.
+func (s *StatusServer) Update(update func(status *FeederStatus)) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	update(&s.status)
+}
+
+// Status returns a copy of the status.
+func (s *StatusServer) Status() FeederStatus {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	status := s.status
+	status.PendingVotes = copyDecs(s.status.PendingVotes)
+	status.Prices = copyDecs(s.status.Prices)
+	if s.status.LastTx != nil {
+		tx := *s.status.LastTx
+		status.LastTx = &tx
+	}
+	if s.status.Performance != nil {
+		performance := *s.status.Performance
+		status.Performance = &performance
+	}
+	return status
+}
+
+func copyDecs(decs map[string]sdk.Dec) map[string]sdk.Dec {
+	c := make(map[string]sdk.Dec, len(decs))
+	for k, v := range decs {
+		c[k] = v
+	}
+	return c
+}
+
+// UpdateRound copies what the engine reports about its rounds into the status.
+func (s *StatusServer) UpdateRound(e *RoundEngine) {
+	snapshot := e.Snapshot()
+	s.Update(func(status *FeederStatus) {
+		status.LastPrevoteRound = snapshot.LastPrevoteRound
+		status.RoundState = snapshot.State.String()
+		status.PendingVotes = snapshot.PendingVotes
+		status.Prices = snapshot.Prices
+		if snapshot.LastTx != nil {
+			status.LastTx = &TxStatus{
+				Round:  snapshot.LastTxRound,
+				Hash:   snapshot.LastTx.TxHash,
+				Code:   snapshot.LastTx.Code,
+				Height: snapshot.LastTx.Height,
+			}
+		}
+	})
+}
+
+// Alive checks that the main loop ran recently.
+func (s *StatusServer) Alive() error {
+	status := s.Status()
+	if status.LoopAt.IsZero() {
+		return fmt.Errorf("main loop has not run yet")
+	}
+	if age := s.Clock.Now().Sub(status.LoopAt); age > s.MaxStatusAge {
+		return fmt.Errorf("main loop last ran %s ago", age.Round(time.Second))
+	}
+	return nil
+}
+
+// Ready runs the readiness checks and returns the failed ones by name.
+func (s *StatusServer) Ready() map[string]error {
+	status := s.Status()
+	failed := map[string]error{}
+
+	if status.NodeStatusAt.IsZero() {
+		failed["node_synced"] = fmt.Errorf("node status has not been fetched yet")
+	} else if age := s.Clock.Now().Sub(status.NodeStatusAt); age > s.MaxStatusAge {
+		failed["node_synced"] = fmt.Errorf("last got the node status %s ago", age.Round(time.Second))
+	} else if status.CatchingUp {
+		failed["node_synced"] = fmt.Errorf("node is catching up at height %d", status.LatestHeight)
+	}
+	if status.VotePeriod == 0 {
+		failed["params_loaded"] = fmt.Errorf("oracle params are not loaded")
+	}
+	if err := s.KeyAvailable(); err != nil {
+		failed["key_available"] = err
+	}
+	return failed
+}
+
+// Handler returns the handler of /healthz, /readyz, /status and /metrics.
+func (s *StatusServer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		if err := s.Alive(); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		checks := map[string]string{"node_synced": "ok", "params_loaded": "ok", "key_available": "ok"}
+		failed := s.Ready()
+		for name, err := range failed {
+			checks[name] = err.Error()
+		}
+		code := http.StatusOK
+		if len(failed) > 0 {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, map[string]interface{}{"ready": len(failed) == 0, "checks": checks})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Status())
+	})
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		writeMetrics(w, s.Status())
+	})
+	return mux
+}
+
+// writeMetrics writes the status as gauges in the Prometheus text format.
+func writeMetrics(w io.Writer, status FeederStatus) {
+	gauge := func(name string, help string, value interface{}) {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("terra_feeder_latest_height", "Latest block height of the Terra node.", status.LatestHeight)
+	gauge("terra_feeder_current_round", "Current vote period.", status.CurrentRound)
+	gauge("terra_feeder_last_prevote_round", "Last vote period the prevotes of the feeder were confirmed in.", status.LastPrevoteRound)
+	if status.LastTx != nil {
+		gauge("terra_feeder_last_tx_code", "Result code of the last transaction.", status.LastTx.Code)
+	}
+	if p := status.Performance; p != nil {
+		gauge("terra_oracle_miss_counter", "Vote periods missed in the current slash window.", p.MissCounter)
+		gauge("terra_oracle_max_misses", "Vote periods that may be missed in a slash window without being slashed.", p.MaxMisses)
+		gauge("terra_oracle_remaining_misses", "Vote periods that may still be missed in the current slash window.", p.RemainingMisses)
+		gauge("terra_oracle_elapsed_vote_periods", "Vote periods of the current slash window that were tallied.", p.ElapsedVotePeriods)
+		gauge("terra_oracle_vote_periods_per_window", "Vote periods in a slash window.", p.VotePeriodsPerWindow)
+		gauge("terra_oracle_valid_vote_rate", "Valid vote rate the slash window ends with if no more periods are missed.", p.ValidVoteRate.String())
+		gauge("terra_oracle_min_valid_per_window", "Valid vote rate below which the validator is slashed.", p.MinValidPerWindow.String())
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	bz, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	w.Write(bz)
+}
+
+// Serve serves the status on the address until it fails.
+func (s *StatusServer) Serve(addr string) {
+	logger.Info("status_server_started", "addr", addr)
+	err := http.ListenAndServe(addr, s.Handler())
+	logger.Error("status_server_stopped", "addr", addr, "error", err)
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// newTestStatusServer returns a server whose main loop just ran and which is ready: the node is
+// synced, the params are loaded and the key is available.
+func newTestStatusServer() (*StatusServer, *fakeClock) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	s := NewStatusServer(StatusConfig{MaxStatusAge: Duration{30 * time.Second}}, clock, func() error { return nil })
+	s.Update(func(status *FeederStatus) {
+		status.LatestHeight = 2*testVotePeriod + 2
+		status.CurrentRound = 2
+		status.VotePeriod = testVotePeriod
+		status.LoopAt = clock.now
+		status.NodeStatusAt = clock.now
+	})
+	return s, clock
+}
+
+func get(s *StatusServer, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	s.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func TestHealthz(t *testing.T) {
+	s, clock := newTestStatusServer()
+	if rec := get(s, "/healthz"); rec.Code != http.StatusOK || rec.Body.String() != "ok\n" {
+		t.Errorf("expect 200 ok but got %d %q", rec.Code, rec.Body.String())
+	}
+
+	clock.now = clock.now.Add(31 * time.Second)
+	rec := get(s, "/healthz")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "main loop last ran 31s ago") {
+		t.Errorf("expect a stale main loop to be unhealthy but got %d %q", rec.Code, rec.Body.String())
+	}
+
+	s, _ = newTestStatusServer()
+	s.Update(func(status *FeederStatus) { status.LoopAt = time.Time{} })
+	rec = get(s, "/healthz")
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "main loop has not run yet") {
+		t.Errorf("expect a main loop that has not run to be unhealthy but got %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	testCases := []struct {
+		name   string
+		update func(s *StatusServer, clock *fakeClock)
+		checks map[string]string
+	}{
+		{
+			name:   "ready",
+			update: func(s *StatusServer, clock *fakeClock) {},
+		},
+		{
+			name: "node status not fetched",
+			update: func(s *StatusServer, clock *fakeClock) {
+				s.Update(func(status *FeederStatus) { status.NodeStatusAt = time.Time{} })
+			},
+			checks: map[string]string{"node_synced": "node status has not been fetched yet"},
+		},
+		{
+			name: "node status stale",
+			update: func(s *StatusServer, clock *fakeClock) {
+				clock.now = clock.now.Add(time.Minute)
+				s.Update(func(status *FeederStatus) { status.LoopAt = clock.now })
+			},
+			checks: map[string]string{"node_synced": "last got the node status 1m0s ago"},
+		},
+		{
+			name: "node catching up",
+			update: func(s *StatusServer, clock *fakeClock) {
+				s.Update(func(status *FeederStatus) { status.CatchingUp = true })
+			},
+			checks: map[string]string{"node_synced": "node is catching up at height 12"},
+		},
+		{
+			name: "params not loaded",
+			update: func(s *StatusServer, clock *fakeClock) {
+				s.Update(func(status *FeederStatus) { status.VotePeriod = 0 })
+			},
+			checks: map[string]string{"params_loaded": "oracle params are not loaded"},
+		},
+		{
+			name: "key missing",
+			update: func(s *StatusServer, clock *fakeClock) {
+				s.KeyAvailable = func() error { return errors.New("key feeder not found") }
+			},
+			checks: map[string]string{"key_available": "key feeder not found"},
+		},
+		{
+			name: "everything fails",
+			update: func(s *StatusServer, clock *fakeClock) {
+				s.Update(func(status *FeederStatus) { status.CatchingUp, status.VotePeriod = true, 0 })
+				s.KeyAvailable = func() error { return errors.New("key feeder not found") }
+			},
+			checks: map[string]string{
+				"node_synced":   "node is catching up at height 12",
+				"params_loaded": "oracle params are not loaded",
+				"key_available": "key feeder not found",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s, clock := newTestStatusServer()
+			tc.update(s, clock)
+			rec := get(s, "/readyz")
+
+			var body struct {
+				Ready  bool              `json:"ready"`
+				Checks map[string]string `json:"checks"`
+			}
+			err := json.Unmarshal(rec.Body.Bytes(), &body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checks := map[string]string{"node_synced": "ok", "params_loaded": "ok", "key_available": "ok"}
+			for name, msg := range tc.checks {
+				checks[name] = msg
+			}
+			if !reflect.DeepEqual(body.Checks, checks) {
+				t.Errorf("expect checks %v but got %v", checks, body.Checks)
+			}
+			ready := len(tc.checks) == 0
+			code := http.StatusOK
+			if !ready {
+				code = http.StatusServiceUnavailable
+			}
+			if rec.Code != code || body.Ready != ready {
+				t.Errorf("expect %d with ready %t but got %d with ready %t", code, ready, rec.Code, body.Ready)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	// The engine prevotes round 2 and its transaction is included.
+	engine, chain, _, _ := newTestEngine()
+	err := engine.Step(2 * testVotePeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain.include(2*testVotePeriod + 1)
+	err = engine.Step(2*testVotePeriod + 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, _ := newTestStatusServer()
+	s.UpdateRound(engine)
+	rec := get(s, "/status")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("expect 200 json but got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var status FeederStatus
+	err = json.Unmarshal(rec.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LatestHeight != 12 || status.CurrentRound != 2 || status.LastPrevoteRound != 2 {
+		t.Errorf("expect latest height 12, current round 2 and last prevote round 2 but got %d, %d and %d",
+			status.LatestHeight, status.CurrentRound, status.LastPrevoteRound)
+	}
+	if status.RoundState != RoundIdle.String() {
+		t.Errorf("expect round state %s but got %s", RoundIdle, status.RoundState)
+	}
+	want := TxStatus{Round: 2, Hash: "TX1", Code: 0, Height: 2*testVotePeriod + 1}
+	if status.LastTx == nil || *status.LastTx != want {
+		t.Errorf("expect last tx %+v but got %+v", want, status.LastTx)
+	}
+	if len(status.PendingVotes) != len(activeDenoms) || len(status.Prices) != len(activeDenoms) {
+		t.Fatalf("expect pending votes and prices of %d denoms but got %v and %v", len(activeDenoms), status.PendingVotes, status.Prices)
+	}
+	for _, denom := range activeDenoms {
+		if !status.PendingVotes[denom].Equal(sdk.MustNewDecFromStr("1.5")) || !status.Prices[denom].Equal(sdk.MustNewDecFromStr("1.5")) {
+			t.Errorf("expect pending vote and price 1.5 of %s but got %s and %s", denom, status.PendingVotes[denom], status.Prices[denom])
+		}
+	}
+
+	// A rejected transaction reports its code.
+	chain.broadcastCode = 5
+	err = engine.Step(3 * testVotePeriod)
+	if err == nil || !strings.Contains(err.Error(), "failed with code 5") {
+		t.Fatalf("expect the rejected transaction to fail the round but got %v", err)
+	}
+	s.UpdateRound(engine)
+	err = json.Unmarshal(get(s, "/status").Body.Bytes(), &status)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.LastTx == nil || status.LastTx.Round != 3 || status.LastTx.Hash != "TX2" || status.LastTx.Code != 5 {
+		t.Errorf("expect the rejected tx TX2 of round 3 with code 5 but got %+v", status.LastTx)
+	}
+}
+
+func TestStatusIsACopy(t *testing.T) {
+	s, _ := newTestStatusServer()
+	s.Update(func(status *FeederStatus) {
+		status.Prices["uusd"] = sdk.OneDec()
+		status.LastTx = &TxStatus{Hash: "TX1"}
+	})
+	status := s.Status()
+	status.Prices["uusd"] = sdk.ZeroDec()
+	status.LastTx.Hash = "TX2"
+	if status = s.Status(); !status.Prices["uusd"].Equal(sdk.OneDec()) || status.LastTx.Hash != "TX1" {
+		t.Errorf("expect the status to be unchanged by its copy but got %+v", status)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s, _ := newTestStatusServer()
+	rec := get(s, "/metrics")
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "text/plain; version=0.0.4" {
+		t.Fatalf("expect 200 text but got %d %s", rec.Code, rec.Header().Get("Content-Type"))
+	}
+	want := strings.Join([]string{
+		"# HELP terra_feeder_latest_height Latest block height of the Terra node.",
+		"# TYPE terra_feeder_latest_height gauge",
+		"terra_feeder_latest_height 12",
+		"# HELP terra_feeder_current_round Current vote period.",
+		"# TYPE terra_feeder_current_round gauge",
+		"terra_feeder_current_round 2",
+		"# HELP terra_feeder_last_prevote_round Last vote period the prevotes of the feeder were confirmed in.",
+		"# TYPE terra_feeder_last_prevote_round gauge",
+		"terra_feeder_last_prevote_round 0",
+		"",
+	}, "\n")
+	if rec.Body.String() != want {
+		t.Errorf("expect metrics\n%s\nbut got\n%s", want, rec.Body.String())
+	}
+
+	// The last tx and the performance add their gauges once they are known.
+	params := terra_types.DefaultParams()
+	params.VotePeriod = 5
+	params.SlashWindow = 100
+	params.MinValidPerWindow = sdk.MustNewDecFromStr("0.05")
+	performance, err := NewOraclePerformance(params, 99, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Update(func(status *FeederStatus) {
+		status.LastTx = &TxStatus{Round: 2, Hash: "TX1", Code: 5}
+		status.Performance = &performance
+	})
+	body := get(s, "/metrics").Body.String()
+	for _, line := range []string{
+		"terra_feeder_last_tx_code 5",
+		"terra_oracle_miss_counter 3",
+		"terra_oracle_max_misses 19",
+		"terra_oracle_remaining_misses 16",
+		"terra_oracle_elapsed_vote_periods 20",
+		"terra_oracle_vote_periods_per_window 20",
+		"terra_oracle_valid_vote_rate 0.850000000000000000",
+		"terra_oracle_min_valid_per_window 0.050000000000000000",
+	} {
+		if !strings.Contains(body, "\n"+line+"\n") {
+			t.Errorf("expect metrics to have %q but got\n%s", line, body)
+		}
+	}
+	if n := strings.Count(body, "# TYPE "); n != 11 {
+		t.Errorf("expect 11 gauges but got %d", n)
+	}
+}
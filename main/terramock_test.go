@@ -0,0 +1,128 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/cosmos/cosmos-sdk/crypto/keys"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+
+	"github.com/bandprotocol/band-terra-oracle/terramock"
+)
+
+// newTerramockFeeder returns a feeder whose Terra key is the operator of a validator of the node.
+func newTerramockFeeder(t *testing.T, node *terramock.Node) Feeder {
+	kb := keys.NewInMemory()
+	info, _, err := kb.CreateMnemonic(TERRA_KEYNAME, keys.English, TERRA_KEY_PASSWORD, keys.Secp256k1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := openTerraKeybase
+	openTerraKeybase = func(dir string) (keys.Keybase, error) { return kb, nil }
+	t.Cleanup(func() { openTerraKeybase = open })
+
+	validator := sdk.ValAddress(info.GetAddress())
+	node.AddValidator(validator)
+	feeder := NewFeederWithClient(node, validator)
+	err = feeder.fetchParams()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feeder
+}
+
+func TestFeederVotesOnTerramock(t *testing.T) {
+	providers := DIRECT_PRICE_PROVIDERS
+	defer func() { DIRECT_PRICE_PROVIDERS = providers }()
+	DIRECT_PRICE_PROVIDERS = nil
+
+	node := terramock.NewNode(TERRA_CHAIN_ID)
+	feeder := newTerramockFeeder(t, node)
+	votePeriod := feeder.Params.VotePeriod
+
+	// Every round fetches other prices, so that a tally shows which round its votes were prevoted in.
+	fetched := map[int64]map[string]sdk.Dec{}
+	feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) {
+		round := node.Height() / votePeriod
+		prices := map[string]sdk.Dec{}
+		for idx, denom := range activeDenoms {
+			prices[denom] = sdk.NewDec(round*100 + int64(idx))
+		}
+		fetched[round] = prices
+		return prices, BandPrices{}, nil
+	}
+
+	engine := NewRoundEngine(&feeder, &feeder, &feeder, systemClock{}, feeder.validator, feeder.Params)
+	// Round 0 is never submitted, so the votes of round 1 are the first to be tallied, at the end
+	// of round 2.
+	const rounds = 5
+	for node.Height() < rounds*votePeriod {
+		err := engine.Step(node.Height())
+		if err != nil {
+			t.Fatalf("Step(%d) returned %v", node.Height(), err)
+		}
+		node.AdvanceBlocks(1)
+	}
+
+	for _, tx := range node.Txs() {
+		if tx.Code != 0 {
+			t.Errorf("tx at height %d failed with code %d: %s", tx.Height, tx.Code, tx.Log)
+		}
+	}
+
+	tallies := node.Tallies()
+	if len(tallies) != rounds-2 {
+		t.Errorf("node tallied %d vote periods, want %d", len(tallies), rounds-2)
+	}
+	for round := int64(2); round < rounds; round++ {
+		end := (round+1)*votePeriod - 1
+		votes := tallies[end]
+		if len(votes) != len(feeder.Params.Whitelist) {
+			t.Errorf("tally of round %d has %d votes, want %d", round, len(votes), len(feeder.Params.Whitelist))
+			continue
+		}
+		for _, vote := range votes {
+			want := fetched[round-1][vote.Denom]
+			if !vote.Voter.Equals(feeder.validator) || !vote.ExchangeRate.Equal(want) {
+				t.Errorf("tally of round %d has a vote of %s for %s by %s, want %s of the prices of round %d", round, vote.ExchangeRate, vote.Denom, vote.Voter, want, round-1)
+			}
+		}
+	}
+
+	// Only the vote periods before the first reveal are missed.
+	if missed := node.MissCounter(feeder.validator); missed != 2 {
+		t.Errorf("validator missed %d vote periods, want 2", missed)
+	}
+}
+
+func TestRevealOnlyLeavesNoPrevotesOnTerramock(t *testing.T) {
+	providers := DIRECT_PRICE_PROVIDERS
+	defer func() { DIRECT_PRICE_PROVIDERS = providers }()
+	DIRECT_PRICE_PROVIDERS = nil
+
+	node := terramock.NewNode(TERRA_CHAIN_ID)
+	feeder := newTerramockFeeder(t, node)
+	feeder.fetchBand = func() (map[string]sdk.Dec, BandPrices, error) {
+		return decs(map[string]string{"ukrw": "1000", "uusd": "0.8", "umnt": "2300", "usdr": "0.6"}), BandPrices{}, nil
+	}
+
+	// Like vote-once, prevote in one round and only reveal in the next.
+	engine := NewRoundEngine(&feeder, &feeder, &feeder, systemClock{}, feeder.validator, feeder.Params)
+	for confirmed := 0; confirmed < 2; node.AdvanceBlocks(1) {
+		last := engine.LastPrevoteRound
+		err := engine.Step(node.Height())
+		if err != nil {
+			t.Fatalf("Step(%d) returned %v", node.Height(), err)
+		}
+		if engine.LastPrevoteRound != last {
+			confirmed++
+			engine.RevealOnly = true
+		}
+	}
+
+	if prevotes := node.Prevotes(); len(prevotes) != 0 {
+		t.Errorf("node has %d prevotes after the reveal, want none", len(prevotes))
+	}
+	if votes := node.Votes(); len(votes) != len(feeder.Params.Whitelist) {
+		t.Errorf("node has %d votes after the reveal, want %d", len(votes), len(feeder.Params.Whitelist))
+	}
+}
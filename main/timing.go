@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	SUBMIT_FIRST_BLOCK       = "first_block"
+	SUBMIT_BLOCKS_BEFORE_END = "blocks_before_end"
+	SUBMIT_TIME_OFFSET       = "time_offset"
+)
+
+// SubmitTiming decides where in a vote period the feeder submits its votes and prevotes.
+//
+// A transaction broadcast at a height is included at the next height at the earliest, so the
+// feeder never submits at the last block of a vote period. The prevotes would land in the next
+// period, and the votes revealed with them would fail to match the period of their prevotes.
+type SubmitTiming struct {
+	// Mode is first_block, blocks_before_end or time_offset. Empty means first_block.
+	Mode string `json:"mode"`
+	// BlocksBeforeEnd is how many blocks before the last block of the period to submit at, in
+	// blocks_before_end mode. It is also the number of blocks of the submit window, which must leave
+	// time to fetch the prices and broadcast.
+	BlocksBeforeEnd int64 `json:"blocks_before_end"`
+	// TimeOffset is how long after the start of the period to submit, in time_offset mode.
+	TimeOffset Duration `json:"time_offset"`
+	// AverageBlockTime turns TimeOffset and the submit window into blocks.
+	AverageBlockTime Duration `json:"average_block_time"`
+	// BroadcastLatency is how long signing and broadcasting a transaction takes after the prices
+	// are fetched.
+	BroadcastLatency Duration `json:"broadcast_latency"`
+}
+
+func DefaultSubmitTiming() SubmitTiming {
+	return SubmitTiming{
+		Mode:             SUBMIT_FIRST_BLOCK,
+		BlocksBeforeEnd:  4,
+		TimeOffset:       Duration{0},
+		AverageBlockTime: Duration{6 * time.Second},
+		BroadcastLatency: Duration{3 * time.Second},
+	}
+}
+
+// Validate checks that the timing can submit within a vote period of the given length, and that
+// its submit window is long enough to fetch the prices within GET_PRICE_TIME_OUT and broadcast.
+func (t SubmitTiming) Validate(votePeriod int64) error {
+	if votePeriod < 2 {
+		return fmt.Errorf("vote period of %d blocks is too short to submit before its last block", votePeriod)
+	}
+	if t.AverageBlockTime.Duration <= 0 {
+		return fmt.Errorf("average_block_time must be positive, got %s", t.AverageBlockTime)
+	}
+	if t.BroadcastLatency.Duration < 0 {
+		return fmt.Errorf("broadcast_latency must not be negative, got %s", t.BroadcastLatency)
+	}
+	switch t.Mode {
+	case "", SUBMIT_FIRST_BLOCK:
+	case SUBMIT_BLOCKS_BEFORE_END:
+		if t.BlocksBeforeEnd < 1 || t.BlocksBeforeEnd > votePeriod-1 {
+			return fmt.Errorf("blocks_before_end must be between 1 and %d, got %d", votePeriod-1, t.BlocksBeforeEnd)
+		}
+	case SUBMIT_TIME_OFFSET:
+		if t.TimeOffset.Duration < 0 {
+			return fmt.Errorf("time_offset must not be negative, got %s", t.TimeOffset)
+		}
+		if t.offsetBlocks() > votePeriod-2 {
+			return fmt.Errorf("time_offset %s is %d blocks of %s, which does not leave a block before the end of a %d block vote period",
+				t.TimeOffset, t.offsetBlocks(), t.AverageBlockTime, votePeriod)
+		}
+	default:
+		return fmt.Errorf("unknown submit timing mode %q", t.Mode)
+	}
+
+	// A round that starts at the first height of the window has until the last height of the
+	// window to broadcast, so that its transaction is included before the end of the period.
+	from, last := t.SubmitWindow(0, votePeriod)
+	window := time.Duration(last-from+1) * t.AverageBlockTime.Duration
+	needed := GET_PRICE_TIME_OUT + t.BroadcastLatency.Duration
+	if window < needed {
+		return fmt.Errorf("submit window of %d blocks of %s is shorter than the %s price timeout and %s broadcast latency",
+			last-from+1, t.AverageBlockTime, GET_PRICE_TIME_OUT, t.BroadcastLatency)
+	}
+	return nil
+}
+
+// offsetBlocks is TimeOffset in blocks, rounded up.
+func (t SubmitTiming) offsetBlocks() int64 {
+	avg := t.AverageBlockTime.Duration
+	return int64((t.TimeOffset.Duration + avg - 1) / avg)
+}
+
+// SubmitWindow returns the first and last height of the vote period of round at which to submit.
+func (t SubmitTiming) SubmitWindow(round int64, votePeriod int64) (int64, int64) {
+	start := round * votePeriod
+	last := start + votePeriod - 2
+	if last < start {
+		last = start
+	}
+
+	from := start
+	switch t.Mode {
+	case SUBMIT_BLOCKS_BEFORE_END:
+		from = start + votePeriod - 1 - t.BlocksBeforeEnd
+	case SUBMIT_TIME_OFFSET:
+		from = start + t.offsetBlocks()
+	}
+	if from < start {
+		from = start
+	}
+	if from > last {
+		from = last
+	}
+	return from, last
+}
+
+// ShouldSubmit tells whether to submit at the height.
+func (t SubmitTiming) ShouldSubmit(height int64, votePeriod int64) bool {
+	from, last := t.SubmitWindow(height/votePeriod, votePeriod)
+	return height >= from && height <= last
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShouldSubmitAtWindowBoundaries(t *testing.T) {
+	const votePeriod = 10
+	const round = 2
+	start := int64(round * votePeriod)
+
+	offset := DefaultSubmitTiming()
+	offset.Mode = SUBMIT_TIME_OFFSET
+	offset.TimeOffset = Duration{13 * time.Second}
+
+	for _, tc := range []struct {
+		name   string
+		timing SubmitTiming
+		from   int64
+	}{
+		{"first_block", DefaultSubmitTiming(), start},
+		{"blocks_before_end", SubmitTiming{Mode: SUBMIT_BLOCKS_BEFORE_END, BlocksBeforeEnd: 4}, start + 5},
+		// 13s are 3 blocks of 6s, rounded up.
+		{"time_offset", offset, start + 3},
+	} {
+		from, last := tc.timing.SubmitWindow(round, votePeriod)
+		if from != tc.from || last != start+votePeriod-2 {
+			t.Errorf("%s: SubmitWindow = %d, %d, want %d, %d", tc.name, from, last, tc.from, start+votePeriod-2)
+			continue
+		}
+
+		heights := []int64{start, from - 1, from, last, last + 1}
+		// The start is in the window only when the window starts there.
+		want := []bool{from == start, false, true, true, false}
+		for idx, height := range heights {
+			got := tc.timing.ShouldSubmit(height, votePeriod)
+			if got != want[idx] {
+				t.Errorf("%s: ShouldSubmit(%d) = %v, want %v (window %d-%d)", tc.name, height, got, want[idx], from, last)
+			}
+		}
+	}
+}
+
+func TestDefaultSubmitWindowIsWider(t *testing.T) {
+	timing := DefaultSubmitTiming()
+	timing.Mode = SUBMIT_BLOCKS_BEFORE_END
+	from, last := timing.SubmitWindow(0, 10)
+	if last-from+1 < 2 {
+		t.Errorf("default blocks_before_end submits in a window of %d blocks", last-from+1)
+	}
+	err := timing.Validate(10)
+	if err != nil {
+		t.Errorf("default blocks_before_end timing is invalid, %v", err)
+	}
+}
+
+func TestValidateSubmitTiming(t *testing.T) {
+	timeout := GET_PRICE_TIME_OUT
+	defer func() { GET_PRICE_TIME_OUT = timeout }()
+	GET_PRICE_TIME_OUT = 20 * time.Second
+
+	withMode := func(mode string, change func(*SubmitTiming)) SubmitTiming {
+		timing := DefaultSubmitTiming()
+		timing.Mode = mode
+		if change != nil {
+			change(&timing)
+		}
+		return timing
+	}
+
+	for _, tc := range []struct {
+		name       string
+		timing     SubmitTiming
+		votePeriod int64
+		err        string
+	}{
+		{"default", DefaultSubmitTiming(), 5, ""},
+		{"one block period", DefaultSubmitTiming(), 1, "too short"},
+		// 4 blocks of 6s fit the 20s timeout and 3s latency.
+		{"4 blocks before end", withMode(SUBMIT_BLOCKS_BEFORE_END, nil), 10, ""},
+		{"1 block before end", withMode(SUBMIT_BLOCKS_BEFORE_END, func(t *SubmitTiming) { t.BlocksBeforeEnd = 1 }), 10, "shorter than the 20s price timeout"},
+		{"3 blocks before end", withMode(SUBMIT_BLOCKS_BEFORE_END, func(t *SubmitTiming) { t.BlocksBeforeEnd = 3 }), 10, "submit window of 3 blocks"},
+		{"3 blocks of 10s before end", withMode(SUBMIT_BLOCKS_BEFORE_END, func(t *SubmitTiming) {
+			t.BlocksBeforeEnd = 3
+			t.AverageBlockTime = Duration{10 * time.Second}
+		}), 10, ""},
+		{"blocks before end past the period", withMode(SUBMIT_BLOCKS_BEFORE_END, func(t *SubmitTiming) { t.BlocksBeforeEnd = 10 }), 10, "between 1 and 9"},
+		{"late time offset", withMode(SUBMIT_TIME_OFFSET, func(t *SubmitTiming) { t.TimeOffset = Duration{36 * time.Second} }), 10, "submit window of 3 blocks"},
+		{"early time offset", withMode(SUBMIT_TIME_OFFSET, func(t *SubmitTiming) { t.TimeOffset = Duration{24 * time.Second} }), 10, ""},
+		{"first block of a short period", DefaultSubmitTiming(), 3, "submit window of 2 blocks"},
+		{"negative latency", withMode(SUBMIT_FIRST_BLOCK, func(t *SubmitTiming) { t.BroadcastLatency = Duration{-time.Second} }), 10, "must not be negative"},
+		{"unknown mode", withMode("sometime", nil), 10, "unknown submit timing mode"},
+	} {
+		err := tc.timing.Validate(tc.votePeriod)
+		if tc.err == "" && err != nil {
+			t.Errorf("%s: Validate returned %v", tc.name, err)
+		}
+		if tc.err != "" && (err == nil || !strings.Contains(err.Error(), tc.err)) {
+			t.Errorf("%s: Validate returned %v, want %q", tc.name, err, tc.err)
+		}
+	}
+}
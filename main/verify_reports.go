@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+// ReportValue points at a value inside the raw reports of a data source.
+type ReportValue struct {
+	ExternalID uint64 `json:"external_id"`
+	Index      int    `json:"index"`
+}
+
+// VerifyConfig describes how the result of a feed is checked against the validators' raw reports.
+type VerifyConfig struct {
+	Enabled      bool    `json:"enabled"`
+	Tolerance    float64 `json:"tolerance"`
+	MinReporters int     `json:"min_reporters"`
+	Reject       bool    `json:"reject"`
+	// Values maps every value of the result, in order, to the raw report value it was aggregated from.
+	// If empty, the values of the raw reports are taken in the order of their external IDs.
+	Values []ReportValue `json:"values"`
+}
+
+// flattenNumbers returns every integer inside a value decoded by obi.DecodeValue in schema order.
+func flattenNumbers(v interface{}, schema *obi.Schema) []float64 {
+	switch schema.Kind {
+	case obi.KindVector, obi.KindArray:
+		res := []float64{}
+		for _, elem := range v.([]interface{}) {
+			res = append(res, flattenNumbers(elem, schema.Elem)...)
+		}
+		return res
+	case obi.KindOption:
+		if v == nil {
+			return nil
+		}
+		return flattenNumbers(v, schema.Elem)
+	case obi.KindMap:
+		res := []float64{}
+		for _, entry := range v.([]obi.MapEntry) {
+			res = append(res, flattenNumbers(entry.Value, schema.Elem)...)
+		}
+		return res
+	case obi.KindStruct:
+		res := []float64{}
+		fields := v.(map[string]interface{})
+		for _, field := range schema.Fields {
+			res = append(res, flattenNumbers(fields[field.Name], field.Type)...)
+		}
+		return res
+	default:
+		rv := reflect.ValueOf(v)
+		switch rv.Kind() {
+		case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return []float64{float64(rv.Int())}
+		case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return []float64{float64(rv.Uint())}
+		default:
+			return nil
+		}
+	}
+}
+
+func medianFloat(xs []float64) float64 {
+	sorted := append([]float64{}, xs...)
+	sort.Float64s(sorted)
+	return sorted[len(sorted)/2]
+}
+
+// relativeDiff returns how far a is from b relative to b. Equal values are no diff, even at 0.
+func relativeDiff(a float64, b float64) float64 {
+	if a == b {
+		return 0
+	}
+	if b == 0 {
+		return math.Inf(1)
+	}
+	return math.Abs(a-b) / math.Abs(b)
+}
+
+// VerifyReports re-derives the result of the feed from the raw reports of the validators and returns
+// the problems found: too few reports in before resolve, too few distinct reporters, reporters that
+// disagree with the median of their data source and result values that differ from the re-derived median.
+func (feed *Feed) VerifyReports(result BandResult, multiplier uint64) []string {
+	cfg := feed.Config.Verify
+	problems := []string{}
+
+	inBeforeResolve := 0
+	reporters := map[string]bool{}
+	// values[externalID][index] lists the value reported by every validator in before resolve.
+	values := map[uint64]map[int][]float64{}
+	reporterValues := map[ReportValue]map[string]float64{}
+	for _, report := range result.Reports {
+		if reporters[report.Validator] {
+			problems = append(problems, fmt.Sprintf("validator %s reported more than once", report.Validator))
+			continue
+		}
+		reporters[report.Validator] = true
+		if !report.InBeforeResolve {
+			continue
+		}
+		inBeforeResolve++
+
+		for _, raw := range report.RawReports {
+			if values[raw.ExternalID] == nil {
+				values[raw.ExternalID] = map[int][]float64{}
+			}
+			for idx, field := range strings.Fields(raw.Data) {
+				x, err := strconv.ParseFloat(field, 64)
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("validator %s reported unparsable value %q for external id %d", report.Validator, field, raw.ExternalID))
+					continue
+				}
+				values[raw.ExternalID][idx] = append(values[raw.ExternalID][idx], x)
+				key := ReportValue{ExternalID: raw.ExternalID, Index: idx}
+				if reporterValues[key] == nil {
+					reporterValues[key] = map[string]float64{}
+				}
+				reporterValues[key][report.Validator] = x
+			}
+		}
+	}
+
+	if uint64(inBeforeResolve) < result.Request.MinCount {
+		problems = append(problems, fmt.Sprintf("only %d reports were in before resolve, min count is %d", inBeforeResolve, result.Request.MinCount))
+	}
+	if len(reporters) < cfg.MinReporters {
+		problems = append(problems, fmt.Sprintf("only %d distinct validators reported, %d are required", len(reporters), cfg.MinReporters))
+	}
+
+	mapping := cfg.Values
+	if len(mapping) == 0 {
+		externalIDs := []uint64{}
+		for externalID := range values {
+			externalIDs = append(externalIDs, externalID)
+		}
+		sort.Slice(externalIDs, func(i, j int) bool { return externalIDs[i] < externalIDs[j] })
+		for _, externalID := range externalIDs {
+			for idx := 0; idx < len(values[externalID]); idx++ {
+				mapping = append(mapping, ReportValue{ExternalID: externalID, Index: idx})
+			}
+		}
+	}
+
+	medians := map[ReportValue]float64{}
+	for _, rv := range mapping {
+		xs := values[rv.ExternalID][rv.Index]
+		if len(xs) == 0 {
+			continue
+		}
+		medians[rv] = medianFloat(xs)
+		// A non-positive median means the source was unavailable to most reporters, like a non-positive result value.
+		if medians[rv] <= 0 {
+			continue
+		}
+		for validator, x := range reporterValues[rv] {
+			if diff := relativeDiff(x, medians[rv]); diff > cfg.Tolerance {
+				problems = append(problems, fmt.Sprintf("validator %s reported %v for external id %d[%d], %.2f%% away from median %v", validator, x, rv.ExternalID, rv.Index, diff*100, medians[rv]))
+			}
+		}
+	}
+
+	schema, err := obi.ParseSchema(feed.Config.ResultSchema)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	decoded, err := obi.DecodeValue(schema, result.Result.ResponsePacketData.Result)
+	if err != nil {
+		return append(problems, err.Error())
+	}
+	resultValues := flattenNumbers(decoded, schema)
+	if len(resultValues) != len(mapping) {
+		problems = append(problems, fmt.Sprintf("result has %d values but %d report values are mapped to it", len(resultValues), len(mapping)))
+		return problems
+	}
+	for idx, rv := range mapping {
+		median, ok := medians[rv]
+		// Non-positive values mean the source was unavailable, which is checked when the prices are aggregated.
+		if !ok || resultValues[idx] <= 0 {
+			continue
+		}
+		value := resultValues[idx] / float64(multiplier)
+		if diff := relativeDiff(value, median); diff > cfg.Tolerance {
+			problems = append(problems, fmt.Sprintf("result value %d is %v but the median of external id %d[%d] is %v, %.2f%% away", idx, value, rv.ExternalID, rv.Index, median, diff*100))
+		}
+	}
+
+	return problems
+}
+
+// checkReports verifies the result of the feed if it is enabled. Problems are printed, and only turned
+// into an error when the feed is configured to reject disputed results.
+func (feed *Feed) checkReports(result BandResult, multiplier uint64) error {
+	if !feed.Config.Verify.Enabled {
+		return nil
+	}
+
+	problems := feed.VerifyReports(result, multiplier)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, problem := range problems {
+		logger.Warn("report_disagrees", "feed", feed.Name, "request_id", result.Result.ResponsePacketData.RequestID, "problem", problem)
+	}
+	if feed.Config.Verify.Reject {
+		return fmt.Errorf("result of %s feed request %d disagrees with its reports", feed.Name, result.Result.ResponsePacketData.RequestID)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+
+	obi "github.com/bandprotocol/band-terra-oracle/obi"
+)
+
+func report(validator string, inBeforeResolve bool, data ...string) Reports {
+	r := Reports{Validator: validator, InBeforeResolve: inBeforeResolve}
+	for idx, d := range data {
+		r.RawReports = append(r.RawReports, RawReports{ExternalID: uint64(idx + 1), Data: d})
+	}
+	return r
+}
+
+// verifyFeed is a feed whose result is a vector of the report values times 100.
+func verifyFeed(cfg VerifyConfig) *Feed {
+	return &Feed{Name: "test", Config: FeedConfig{ResultSchema: "[u64]", Verify: cfg}}
+}
+
+func bandResult(minCount uint64, result []uint64, reports ...Reports) BandResult {
+	res := BandResult{Request: Request{MinCount: minCount}, Reports: reports}
+	res.Result.ResponsePacketData.RequestID = 7
+	res.Result.ResponsePacketData.Result = obi.MustEncode(result)
+	return res
+}
+
+func TestVerifyReports(t *testing.T) {
+	cfg := VerifyConfig{Enabled: true, Tolerance: 0.1, MinReporters: 3}
+	agree := []Reports{report("v1", true, "1 2"), report("v2", true, "1 2"), report("v3", true, "1.05 2")}
+
+	testCases := []struct {
+		name     string
+		cfg      VerifyConfig
+		result   BandResult
+		problems []string
+	}{
+		{
+			name:   "reports agree with the result",
+			cfg:    cfg,
+			result: bandResult(3, []uint64{100, 200}, agree...),
+		},
+		{
+			name:     "too few reports in before resolve",
+			cfg:      cfg,
+			result:   bandResult(3, []uint64{100, 200}, report("v1", true, "1 2"), report("v2", true, "1 2"), report("v3", false, "1 2")),
+			problems: []string{"only 2 reports were in before resolve, min count is 3"},
+		},
+		{
+			name:     "too few distinct reporters",
+			cfg:      VerifyConfig{Tolerance: 0.1, MinReporters: 4},
+			result:   bandResult(3, []uint64{100, 200}, agree...),
+			problems: []string{"only 3 distinct validators reported, 4 are required"},
+		},
+		{
+			name:   "duplicate reporter",
+			cfg:    cfg,
+			result: bandResult(2, []uint64{100, 200}, report("v1", true, "1 2"), report("v2", true, "1 2"), report("v1", true, "9 9")),
+			problems: []string{
+				"validator v1 reported more than once",
+				"only 2 distinct validators reported, 3 are required",
+			},
+		},
+		{
+			name:     "reporter outside of the tolerance",
+			cfg:      cfg,
+			result:   bandResult(3, []uint64{100, 200}, report("v1", true, "1 2"), report("v2", true, "1 2"), report("v3", true, "1.2 2")),
+			problems: []string{"validator v3 reported 1.2 for external id 1[0], 20.00% away from median 1"},
+		},
+		{
+			name:     "result outside of the tolerance",
+			cfg:      cfg,
+			result:   bandResult(3, []uint64{150, 200}, agree...),
+			problems: []string{"result value 0 is 1.5 but the median of external id 1[0] is 1, 50.00% away"},
+		},
+		{
+			name:     "unparsable report value",
+			cfg:      cfg,
+			result:   bandResult(3, []uint64{100, 200}, report("v1", true, "1 2"), report("v2", true, "1 2"), report("v3", true, "1 two")),
+			problems: []string{`validator v3 reported unparsable value "two" for external id 1`},
+		},
+		{
+			name: "unavailable source reports 0",
+			cfg:  cfg,
+			// Every reporter and the result have 0, so there is no diff to the median.
+			result: bandResult(3, []uint64{0, 200}, report("v1", true, "0 2"), report("v2", true, "0 2"), report("v3", true, "0 2")),
+		},
+		{
+			name:   "reporter outside of a 0 median is skipped",
+			cfg:    cfg,
+			result: bandResult(3, []uint64{0, 200}, report("v1", true, "0 2"), report("v2", true, "0 2"), report("v3", true, "1 2")),
+		},
+		{
+			name:   "values mapped across data sources",
+			cfg:    VerifyConfig{Tolerance: 0.1, MinReporters: 3, Values: []ReportValue{{ExternalID: 2, Index: 0}, {ExternalID: 1, Index: 1}}},
+			result: bandResult(3, []uint64{300, 200}, report("v1", true, "1 2", "3"), report("v2", true, "1 2", "3"), report("v3", true, "1 2", "3")),
+		},
+		{
+			name:     "mapping shorter than the result",
+			cfg:      VerifyConfig{Tolerance: 0.1, MinReporters: 3, Values: []ReportValue{{ExternalID: 1, Index: 0}}},
+			result:   bandResult(3, []uint64{100, 200}, agree...),
+			problems: []string{"result has 2 values but 1 report values are mapped to it"},
+		},
+		{
+			name:     "reports longer than the result",
+			cfg:      cfg,
+			result:   bandResult(3, []uint64{100}, agree...),
+			problems: []string{"result has 1 values but 2 report values are mapped to it"},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			problems := verifyFeed(tc.cfg).VerifyReports(tc.result, 100)
+			if len(tc.problems) == 0 {
+				tc.problems = []string{}
+			}
+			if !reflect.DeepEqual(problems, tc.problems) {
+				t.Errorf("expect problems %q but got %q", tc.problems, problems)
+			}
+		})
+	}
+}
+
+func TestCheckReports(t *testing.T) {
+	disputed := bandResult(3, []uint64{150, 200}, report("v1", true, "1 2"), report("v2", true, "1 2"), report("v3", true, "1 2"))
+
+	testCases := []struct {
+		name   string
+		cfg    VerifyConfig
+		result BandResult
+		err    string
+	}{
+		{"disabled", VerifyConfig{Tolerance: 0.1, Reject: true}, disputed, ""},
+		{"problems are only logged", VerifyConfig{Enabled: true, Tolerance: 0.1}, disputed, ""},
+		{"problems reject the result", VerifyConfig{Enabled: true, Tolerance: 0.1, Reject: true}, disputed, "result of test feed request 7 disagrees with its reports"},
+		{"no problems", VerifyConfig{Enabled: true, Tolerance: 0.5, Reject: true}, disputed, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := verifyFeed(tc.cfg).checkReports(tc.result, 100)
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("expect no error but got %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.err) {
+				t.Errorf("expect error %q but got %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestRelativeDiff(t *testing.T) {
+	for _, tc := range []struct {
+		a, b, diff float64
+	}{
+		{0, 0, 0},
+		{1, 1, 0},
+		{1.1, 1, 0.1},
+		{0.9, 1, 0.1},
+		{-1, -2, 0.5},
+	} {
+		if diff := relativeDiff(tc.a, tc.b); diff < tc.diff-1e-9 || diff > tc.diff+1e-9 {
+			t.Errorf("relativeDiff(%v, %v) = %v, expect %v", tc.a, tc.b, diff, tc.diff)
+		}
+	}
+	if diff := relativeDiff(1, 0); !math.IsInf(diff, 1) {
+		t.Errorf("relativeDiff(1, 0) = %v, expect infinity", diff)
+	}
+}
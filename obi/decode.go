@@ -1,104 +1,464 @@
 package obi
 
 import (
+	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 )
 
-func decodeImpl(data []byte, v interface{}) ([]byte, error) {
-	rv := reflect.ValueOf(v)
-	if rv.Kind() != reflect.Ptr || rv.IsNil() {
-		return nil, errors.New("obi: decode into non-ptr type")
+// decodeState reads the data being decoded from either a byte slice or a reader.
+type decodeState struct {
+	// data is the remaining data of a byte slice source.
+	data []byte
+	// r is the reader source, and buf the buffer reused to read from it.
+	r   *bufio.Reader
+	buf []byte
+	// offset is the number of bytes read so far.
+	offset int
+	limits Limits
+	depth  int
+	// captured collects the bytes read from the reader while captures is non-zero.
+	captured []byte
+	captures int
+}
+
+func newDecodeState(data []byte, limits Limits) *decodeState {
+	return &decodeState{data: data, limits: limits}
+}
+
+// remaining returns the number of bytes left, or -1 if the source is a reader.
+func (d *decodeState) remaining() int {
+	if d.r != nil {
+		return -1
+	}
+	return len(d.data)
+}
+
+// read returns the next n bytes. Bytes read from a reader are only valid until the next read.
+func (d *decodeState) read(n int) ([]byte, error) {
+	if d.r == nil {
+		if len(d.data) < n {
+			return nil, errors.New("obi: out of range")
+		}
+		res := d.data[:n]
+		d.data = d.data[n:]
+		d.offset += n
+		return res, nil
+	}
+	if cap(d.buf) < n {
+		d.buf = make([]byte, n)
+	}
+	res := d.buf[:n]
+	read, err := io.ReadFull(d.r, res)
+	d.offset += read
+	if d.captures != 0 {
+		d.captured = append(d.captured, res[:read]...)
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errors.New("obi: out of range")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// capture calls read and returns the bytes it read. Captures can be nested.
+func (d *decodeState) capture(read func() error) ([]byte, error) {
+	if d.r == nil {
+		start := d.data
+		err := read()
+		if err != nil {
+			return nil, err
+		}
+		return start[:len(start)-len(d.data)], nil
+	}
+	start := len(d.captured)
+	d.captures++
+	err := read()
+	d.captures--
+	res := append([]byte(nil), d.captured[start:]...)
+	if d.captures == 0 {
+		d.captured = d.captured[:0]
+	}
+	return res, err
+}
+
+func (d *decodeState) readLength(max int) (int, error) {
+	bz, err := d.read(4)
+	if err != nil {
+		return 0, err
+	}
+	length := binary.BigEndian.Uint32(bz)
+	err = checkLength(length, max)
+	if err != nil {
+		return 0, err
+	}
+	return int(length), nil
+}
+
+func (d *decodeState) readBytes() ([]byte, error) {
+	length, err := d.readLength(d.limits.MaxBytesLength)
+	if err != nil {
+		return nil, err
+	}
+	bz, err := d.read(length)
+	if err != nil {
+		return nil, err
+	}
+	if d.r != nil {
+		return append([]byte{}, bz...), nil
+	}
+	return bz, nil
+}
+
+func (d *decodeState) readBool() (bool, error) {
+	bz, err := d.read(1)
+	if err != nil {
+		return false, err
+	}
+	val, _, err := DecodeBool(bz)
+	return val, err
+}
+
+// readUnsigned reads a big endian unsigned integer of the given size in bytes.
+func (d *decodeState) readUnsigned(size int) (uint64, error) {
+	bz, err := d.read(size)
+	if err != nil {
+		return 0, err
+	}
+	switch size {
+	case 1:
+		return uint64(bz[0]), nil
+	case 2:
+		return uint64(binary.BigEndian.Uint16(bz)), nil
+	case 4:
+		return uint64(binary.BigEndian.Uint32(bz)), nil
+	default:
+		return binary.BigEndian.Uint64(bz), nil
+	}
+}
+
+// skip reads a whole value of the schema without decoding it.
+func (d *decodeState) skip(schema *Schema) error {
+	d.depth++
+	defer func() { d.depth-- }()
+	err := checkDepth(d.depth, d.limits.MaxDepth)
+	if err != nil {
+		return err
+	}
+	switch schema.Kind {
+	case KindU8, KindI8, KindBool:
+		_, err := d.read(1)
+		return err
+	case KindU16, KindI16:
+		_, err := d.read(2)
+		return err
+	case KindU32, KindI32:
+		_, err := d.read(4)
+		return err
+	case KindU64, KindI64:
+		_, err := d.read(8)
+		return err
+	case KindString, KindBytes:
+		_, err := d.readBytes()
+		return err
+	case KindVector, KindArray, KindMap:
+		length := schema.Len
+		if schema.Kind != KindArray {
+			var err error
+			length, err = d.readLength(d.limits.MaxSliceLength)
+			if err != nil {
+				return err
+			}
+		}
+		for idx := 0; idx < length; idx++ {
+			if schema.Kind == KindMap {
+				err := d.skip(schema.Key)
+				if err != nil {
+					return err
+				}
+			}
+			err := d.skip(schema.Elem)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	case KindOption:
+		present, err := d.readBool()
+		if err != nil || !present {
+			return err
+		}
+		return d.skip(schema.Elem)
+	case KindStruct:
+		for _, field := range schema.Fields {
+			err := d.skip(field.Type)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("obi: unsupported schema kind: %d", schema.Kind)
+	}
+}
+
+// rebase positions a DecodeError returned by an Unmarshaler in the whole data. The error is located
+// in the size bytes that were passed to the Unmarshaler from the given offset.
+func (d *decodeState) rebase(err error, offset int, size int) error {
+	if de, ok := err.(*DecodeError); ok && de.Remaining >= 0 {
+		de.Offset = offset + size - de.Remaining
+		if d.r != nil {
+			de.Remaining = -1
+		}
+	}
+	return err
+}
+
+// unmarshal decodes a value with its Unmarshaler. From a reader, the bytes of the value are found
+// with the schema the type reports.
+func (d *decodeState) unmarshal(u Unmarshaler, t reflect.Type) error {
+	offset := d.offset
+	if d.r == nil {
+		rem, err := u.UnmarshalOBI(d.data)
+		if err != nil {
+			return d.rebase(err, offset, len(d.data))
+		}
+		d.offset += len(d.data) - len(rem)
+		d.data = rem
+		return nil
+	}
+	custom, ok := customSchema(t)
+	if !ok {
+		return fmt.Errorf("obi: %s must implement Schemer to be decoded from a reader", t)
+	}
+	schema, err := ParseSchema(custom)
+	if err != nil {
+		return err
+	}
+	bz, err := d.capture(func() error { return d.skip(schema) })
+	if err != nil {
+		return err
+	}
+	rem, err := u.UnmarshalOBI(bz)
+	if err != nil {
+		return d.rebase(err, offset, len(bz))
+	}
+	if len(rem) != 0 {
+		return fmt.Errorf("obi: %s left %d bytes of its schema %s", t, len(rem), schema)
+	}
+	return nil
+}
+
+func (d *decodeState) decode(ev reflect.Value, schema *Schema) error {
+	offset, remaining := d.offset, d.remaining()
+	d.depth++
+	err := checkDepth(d.depth, d.limits.MaxDepth)
+	if err == nil {
+		err = d.decodeKind(ev, schema)
+	}
+	d.depth--
+	if err == nil {
+		return nil
+	}
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{Offset: offset, Expected: expectedType(ev.Type(), schema)(), Remaining: remaining, Err: err}
+}
+
+func (d *decodeState) decodeKind(ev reflect.Value, schema *Schema) error {
+	if ev.Kind() == reflect.Ptr {
+		present, err := d.readBool()
+		if err != nil {
+			return err
+		}
+		if !present {
+			ev.Set(reflect.Zero(ev.Type()))
+			return nil
+		}
+		elem := reflect.New(ev.Type().Elem())
+		err = d.decode(elem.Elem(), schema.elem())
+		if err != nil {
+			return err
+		}
+		ev.Set(elem)
+		return nil
+	}
+	if u, ok := asUnmarshaler(ev); ok && !reordered(ev.Type(), schema) {
+		return d.unmarshal(u, ev.Type())
 	}
-	ev := rv.Elem()
 	switch ev.Kind() {
-	case reflect.Uint8:
-		val, rem, err := DecodeUnsigned8(data)
-		ev.SetUint(uint64(val))
-		return rem, err
-	case reflect.Uint16:
-		val, rem, err := DecodeUnsigned16(data)
-		ev.SetUint(uint64(val))
-		return rem, err
-	case reflect.Uint32:
-		val, rem, err := DecodeUnsigned32(data)
-		ev.SetUint(uint64(val))
-		return rem, err
-	case reflect.Uint64:
-		val, rem, err := DecodeUnsigned64(data)
-		ev.SetUint(uint64(val))
-		return rem, err
-	case reflect.Int8:
-		val, rem, err := DecodeSigned8(data)
-		ev.SetInt(int64(val))
-		return rem, err
-	case reflect.Int16:
-		val, rem, err := DecodeSigned16(data)
-		ev.SetInt(int64(val))
-		return rem, err
-	case reflect.Int32:
-		val, rem, err := DecodeSigned32(data)
-		ev.SetInt(int64(val))
-		return rem, err
-	case reflect.Int64:
-		val, rem, err := DecodeSigned64(data)
-		ev.SetInt(int64(val))
-		return rem, err
+	case reflect.Bool:
+		val, err := d.readBool()
+		ev.SetBool(val)
+		return err
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val, err := d.readUnsigned(int(ev.Type().Size()))
+		ev.SetUint(val)
+		return err
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val, err := d.readUnsigned(int(ev.Type().Size()))
+		size := uint(ev.Type().Size()) * 8
+		// Sign extend the value from its size.
+		ev.SetInt(int64(val<<(64-size)) >> (64 - size))
+		return err
 	case reflect.String:
-		val, rem, err := DecodeString(data)
-		ev.SetString(val)
-		return rem, err
+		val, err := d.readBytes()
+		ev.SetString(string(val))
+		return err
 	case reflect.Slice:
 		if ev.Type().Elem().Kind() == reflect.Uint8 {
-			val, rem, err := DecodeBytes(data)
+			val, err := d.readBytes()
 			ev.SetBytes(val)
-			return rem, err
+			return err
 		}
-		length, rem, err := DecodeUnsigned32(data)
+		length, err := d.readLength(d.limits.MaxSliceLength)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		slice := reflect.MakeSlice(ev.Type(), int(length), int(length))
-		for idx := 0; idx < int(length); idx++ {
-			var err error
-			rem, err = decodeImpl(rem, slice.Index(idx).Addr().Interface())
+		// The slice grows with the decoded elements rather than trusting the length prefix.
+		initial := length
+		if initial > 64 {
+			initial = 64
+		}
+		slice := reflect.MakeSlice(ev.Type(), 0, initial)
+		elem := reflect.New(ev.Type().Elem()).Elem()
+		for idx := 0; idx < length; idx++ {
+			elem.Set(reflect.Zero(elem.Type()))
+			err := d.decode(elem, schema.elem())
 			if err != nil {
-				return nil, err
+				return withPath(err, fmt.Sprintf("[%d]", idx))
 			}
+			slice = reflect.Append(slice, elem)
 		}
 		ev.Set(slice)
-		return rem, nil
+		return nil
+	case reflect.Array:
+		for idx := 0; idx < ev.Len(); idx++ {
+			err := d.decode(ev.Index(idx), schema.elem())
+			if err != nil {
+				return withPath(err, fmt.Sprintf("[%d]", idx))
+			}
+		}
+		return nil
+	case reflect.Map:
+		length, err := d.readLength(d.limits.MaxSliceLength)
+		if err != nil {
+			return err
+		}
+		m := reflect.MakeMap(ev.Type())
+		var prev []byte
+		for idx := 0; idx < length; idx++ {
+			offset, remaining := d.offset, d.remaining()
+			key := reflect.New(ev.Type().Key()).Elem()
+			bz, err := d.capture(func() error { return d.decode(key, schema.key()) })
+			if err != nil {
+				return withPath(err, fmt.Sprintf("[key %d]", idx))
+			}
+			if prev != nil && bytes.Compare(prev, bz) >= 0 {
+				return &DecodeError{Offset: offset, Path: fmt.Sprintf("[key %d]", idx), Expected: "map key", Remaining: remaining, Err: ErrUnsortedMapKeys}
+			}
+			prev = bz
+			value := reflect.New(ev.Type().Elem()).Elem()
+			err = d.decode(value, schema.elem())
+			if err != nil {
+				return withPath(err, fmt.Sprintf("[%v]", key.Interface()))
+			}
+			m.SetMapIndex(key, value)
+		}
+		ev.Set(m)
+		return nil
 	case reflect.Struct:
-		rem := data
-		for idx := 0; idx < ev.NumField(); idx++ {
-			var err error
-			rem, err = decodeImpl(rem, ev.Field(idx).Addr().Interface())
+		fields, err := orderedFields(ev.Type(), schema)
+		if err != nil {
+			return err
+		}
+		for _, field := range fields {
+			err := d.decode(ev.Field(field.Index), field.Schema)
 			if err != nil {
-				return nil, err
+				return withPath(err, "."+ev.Type().Field(field.Index).Name)
 			}
 		}
-		return rem, nil
+		return nil
 	default:
-		return nil, fmt.Errorf("obi: unsupported value type: %s", ev.Kind())
+		return fmt.Errorf("obi: unsupported value type: %s", ev.Kind())
 	}
 }
 
+func (d *decodeState) decodePtr(v interface{}, schema *Schema) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return errors.New("obi: decode into non-ptr type")
+	}
+	return d.decode(rv.Elem(), schema)
+}
+
+// checkedPtr checks that v is a non-nil pointer to a value that can be laid out as the schema.
+func checkedPtr(schema string, v interface{}) (*Schema, error) {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return nil, errors.New("obi: decode into non-ptr type")
+	}
+	return s, checkSchemaImpl(rv.Elem().Type(), s)
+}
+
 // Decode uses obi encoding scheme to decode the given input(s).
+// Struct fields are decoded in declaration order, skipping fields tagged with `obi:"-"`.
+// Values implementing Unmarshaler decode themselves. Pointers are decoded as options.
+// Decoding failures are returned as a *DecodeError. Data beyond DefaultLimits is rejected.
 func Decode(data []byte, v ...interface{}) error {
-	var err error
-	rem := data
+	rem, err := DecodeLenient(data, v...)
+	if err != nil {
+		return err
+	}
+	return trailingError(len(data), rem)
+}
+
+// DecodeLenient decodes like Decode, but returns the bytes left after the values instead of failing.
+func DecodeLenient(data []byte, v ...interface{}) ([]byte, error) {
+	d := newDecodeState(data, DefaultLimits)
 	for _, each := range v {
-		rem, err = decodeImpl(rem, each)
+		err := d.decodePtr(each, nil)
 		if err != nil {
-			return err
+			return nil, err
 		}
 	}
-	if len(rem) != 0 {
-		return errors.New("obi: not all data was consumed while decoding")
+	return d.data, nil
+}
+
+// DecodeWithSchema decodes data laid out as the schema into v. Struct fields are matched to
+// the schema by their `obi` tag, so they are decoded in the order of the schema.
+func DecodeWithSchema(schema string, data []byte, v interface{}) error {
+	rem, err := DecodeWithSchemaLenient(schema, data, v)
+	if err != nil {
+		return err
 	}
-	return nil
+	return trailingError(len(data), rem)
+}
+
+// DecodeWithSchemaLenient decodes like DecodeWithSchema, but returns the bytes left after the value
+// instead of failing, e.g. when an oracle script has appended fields to its output.
+func DecodeWithSchemaLenient(schema string, data []byte, v interface{}) ([]byte, error) {
+	s, err := checkedPtr(schema, v)
+	if err != nil {
+		return nil, err
+	}
+	d := newDecodeState(data, DefaultLimits)
+	err = d.decodePtr(v, s)
+	if err != nil {
+		return nil, err
+	}
+	return d.data, nil
 }
 
 // MustDecode uses obi encoding scheme to decode the given input. Panics on error.
@@ -109,7 +469,23 @@ func MustDecode(data []byte, v ...interface{}) {
 	}
 }
 
-// DecodeUnsigned16 decodes the input bytes into `uint8` and returns the remaining bytes.
+// DecodeBool decodes the input bytes into `bool` and returns the remaining bytes.
+func DecodeBool(data []byte) (bool, []byte, error) {
+	val, rem, err := DecodeUnsigned8(data)
+	if err != nil {
+		return false, nil, err
+	}
+	switch val {
+	case 0:
+		return false, rem, nil
+	case 1:
+		return true, rem, nil
+	default:
+		return false, nil, fmt.Errorf("obi: invalid bool %d", val)
+	}
+}
+
+// DecodeUnsigned8 decodes the input bytes into `uint8` and returns the remaining bytes.
 func DecodeUnsigned8(data []byte) (uint8, []byte, error) {
 	if len(data) < 1 {
 		return 0, nil, errors.New("obi: out of range")
@@ -166,11 +542,16 @@ func DecodeSigned64(data []byte) (int64, []byte, error) {
 }
 
 // DecodeBytes decodes the input bytes and returns bytes result and the remaining bytes.
+// Lengths above DefaultLimits.MaxBytesLength are rejected.
 func DecodeBytes(data []byte) ([]byte, []byte, error) {
 	length, rem, err := DecodeUnsigned32(data)
 	if err != nil {
 		return nil, nil, err
 	}
+	err = checkLength(length, DefaultLimits.MaxBytesLength)
+	if err != nil {
+		return nil, nil, err
+	}
 	if uint32(len(rem)) < length {
 		return nil, nil, errors.New("obi: out of range")
 	}
@@ -178,11 +559,16 @@ func DecodeBytes(data []byte) ([]byte, []byte, error) {
 }
 
 // DecodeString decodes the input bytes and returns string result and the remaining bytes.
+// Lengths above DefaultLimits.MaxBytesLength are rejected.
 func DecodeString(data []byte) (string, []byte, error) {
 	length, rem, err := DecodeUnsigned32(data)
 	if err != nil {
 		return "", nil, err
 	}
+	err = checkLength(length, DefaultLimits.MaxBytesLength)
+	if err != nil {
+		return "", nil, err
+	}
 	if uint32(len(rem)) < length {
 		return "", nil, errors.New("obi: out of range")
 	}
@@ -1,75 +1,171 @@
 package obi
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
 )
 
-// Encode uses obi encoding scheme to encode the given input into bytes.
-func encodeImpl(v interface{}) ([]byte, error) {
-	rv := reflect.ValueOf(v)
+// EncodedEntry is the encoded key and value of a map entry.
+type EncodedEntry struct {
+	Key   []byte
+	Value []byte
+}
+
+// encodeEntries encodes the entries of a map as their count followed by every key and value,
+// sorted by the encoded bytes of the keys.
+func encodeEntries(entries []EncodedEntry) ([]byte, error) {
+	return AppendEntries([]byte{}, entries)
+}
+
+// AppendEntries appends the encoding of a map with the given entries to b, sorting the entries by
+// their keys. It is used by the code generated by obigen.
+func AppendEntries(b []byte, entries []EncodedEntry) ([]byte, error) {
+	sort.Slice(entries, func(i, j int) bool { return bytes.Compare(entries[i].Key, entries[j].Key) < 0 })
+	b = binary.BigEndian.AppendUint32(b, uint32(len(entries)))
+	for idx, entry := range entries {
+		if idx != 0 && bytes.Equal(entries[idx-1].Key, entry.Key) {
+			return nil, errors.New("obi: duplicate map key")
+		}
+		b = append(b, entry.Key...)
+		b = append(b, entry.Value...)
+	}
+	return b, nil
+}
+
+// appendImpl appends the encoding of the value to b.
+func appendImpl(b []byte, rv reflect.Value, schema *Schema) ([]byte, error) {
+	if !rv.IsValid() {
+		return nil, fmt.Errorf("obi: unsupported value type: %s", rv.Kind())
+	}
+	if rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return append(b, 0), nil
+		}
+		return appendImpl(append(b, 1), rv.Elem(), schema.elem())
+	}
+	if m, ok := asMarshaler(rv); ok && !reordered(rv.Type(), schema) {
+		if a, ok := m.(Appender); ok {
+			return a.AppendOBI(b)
+		}
+		bz, err := m.MarshalOBI()
+		if err != nil {
+			return nil, err
+		}
+		return append(b, bz...), nil
+	}
 	switch rv.Kind() {
+	case reflect.Bool:
+		return append(b, EncodeBool(rv.Bool())...), nil
 	case reflect.Uint8:
-		return EncodeUnsigned8(uint8(rv.Uint())), nil
+		return append(b, uint8(rv.Uint())), nil
 	case reflect.Uint16:
-		return EncodeUnsigned16(uint16(rv.Uint())), nil
+		return binary.BigEndian.AppendUint16(b, uint16(rv.Uint())), nil
 	case reflect.Uint32:
-		return EncodeUnsigned32(uint32(rv.Uint())), nil
+		return binary.BigEndian.AppendUint32(b, uint32(rv.Uint())), nil
 	case reflect.Uint64:
-		return EncodeUnsigned64(uint64(rv.Uint())), nil
+		return binary.BigEndian.AppendUint64(b, rv.Uint()), nil
 	case reflect.Int8:
-		return EncodeSigned8(int8(rv.Int())), nil
+		return append(b, uint8(rv.Int())), nil
 	case reflect.Int16:
-		return EncodeSigned16(int16(rv.Int())), nil
+		return binary.BigEndian.AppendUint16(b, uint16(rv.Int())), nil
 	case reflect.Int32:
-		return EncodeSigned32(int32(rv.Int())), nil
+		return binary.BigEndian.AppendUint32(b, uint32(rv.Int())), nil
 	case reflect.Int64:
-		return EncodeSigned64(int64(rv.Int())), nil
+		return binary.BigEndian.AppendUint64(b, uint64(rv.Int())), nil
 	case reflect.String:
-		return EncodeString(rv.String()), nil
+		b = binary.BigEndian.AppendUint32(b, uint32(rv.Len()))
+		return append(b, rv.String()...), nil
 	case reflect.Slice:
+		b = binary.BigEndian.AppendUint32(b, uint32(rv.Len()))
 		if rv.Type().Elem().Kind() == reflect.Uint8 {
-			return EncodeBytes(rv.Bytes()), nil
+			return append(b, rv.Bytes()...), nil
 		}
-
-		res := EncodeUnsigned32(uint32(rv.Len()))
 		for idx := 0; idx < rv.Len(); idx++ {
-			each, err := Encode(rv.Index(idx).Interface())
+			var err error
+			b, err = appendImpl(b, rv.Index(idx), schema.elem())
+			if err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	case reflect.Array:
+		for idx := 0; idx < rv.Len(); idx++ {
+			var err error
+			b, err = appendImpl(b, rv.Index(idx), schema.elem())
 			if err != nil {
 				return nil, err
 			}
-			res = append(res, each...)
 		}
-		return res, nil
+		return b, nil
+	case reflect.Map:
+		entries := []EncodedEntry{}
+		iter := rv.MapRange()
+		for iter.Next() {
+			key, err := appendImpl(nil, iter.Key(), schema.key())
+			if err != nil {
+				return nil, err
+			}
+			value, err := appendImpl(nil, iter.Value(), schema.elem())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, EncodedEntry{Key: key, Value: value})
+		}
+		bz, err := encodeEntries(entries)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, bz...), nil
 	case reflect.Struct:
-		res := []byte{}
-		for idx := 0; idx < rv.NumField(); idx++ {
-			each, err := Encode(rv.Field(idx).Interface())
+		fields, err := orderedFields(rv.Type(), schema)
+		if err != nil {
+			return nil, err
+		}
+		for _, field := range fields {
+			b, err = appendImpl(b, rv.Field(field.Index), field.Schema)
 			if err != nil {
 				return nil, err
 			}
-			res = append(res, each...)
 		}
-		return res, nil
+		return b, nil
 	default:
 		return nil, fmt.Errorf("obi: unsupported value type: %s", rv.Kind())
 	}
 }
 
 // Encode uses obi encoding scheme to encode the given input(s) into bytes.
+// Struct fields are encoded in declaration order, skipping fields tagged with `obi:"-"`.
+// Values implementing Marshaler encode themselves. Pointers are encoded as options.
 func Encode(v ...interface{}) ([]byte, error) {
 	res := []byte{}
 	for _, each := range v {
-		encoded, err := encodeImpl(each)
+		var err error
+		res, err = appendImpl(res, reflect.ValueOf(each), nil)
 		if err != nil {
 			return nil, err
 		}
-		res = append(res, encoded...)
 	}
 	return res, nil
 }
 
+// EncodeWithSchema encodes the given input into bytes laid out as the schema. Struct fields are
+// matched to the schema by their `obi` tag, so they are encoded in the order of the schema.
+func EncodeWithSchema(schema string, v interface{}) ([]byte, error) {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	err = checkSchemaImpl(reflect.TypeOf(v), s)
+	if err != nil {
+		return nil, err
+	}
+	return appendImpl([]byte{}, reflect.ValueOf(v), s)
+}
+
 // MustEncode uses obi encoding scheme to encode the given input into bytes. Panics on error.
 func MustEncode(v ...interface{}) []byte {
 	res, err := Encode(v...)
@@ -79,6 +175,14 @@ func MustEncode(v ...interface{}) []byte {
 	return res
 }
 
+// EncodeBool takes a `bool` variable and encodes it into a byte array
+func EncodeBool(v bool) []byte {
+	if v {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
 // EncodeUnsigned8 takes an `uint8` variable and encodes it into a byte array
 func EncodeUnsigned8(v uint8) []byte {
 	return []byte{v}
@@ -0,0 +1,165 @@
+package obi
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+func TestEncodeNilIsUnsupported(t *testing.T) {
+	for name, encode := range map[string]func() error{
+		"Encode": func() error {
+			_, err := Encode(nil)
+			return err
+		},
+		"Encode after value": func() error {
+			_, err := Encode(uint8(1), nil)
+			return err
+		},
+		"Encoder.Encode": func() error {
+			return NewEncoder(&bytes.Buffer{}).Encode(nil)
+		},
+	} {
+		err := encode()
+		if err == nil || !strings.Contains(err.Error(), "unsupported value type") {
+			t.Errorf("%s(nil) returned %v, want unsupported value type error", name, err)
+		}
+	}
+}
+
+func TestNilValueHasNoSchema(t *testing.T) {
+	_, err := GetSchema(nil)
+	if err == nil {
+		t.Errorf("GetSchema(nil) returned no error")
+	}
+	_, err = EncodeWithSchema("u8", nil)
+	if err == nil {
+		t.Errorf("EncodeWithSchema(nil) returned no error")
+	}
+}
+
+// cents is a precision of 2 decimal places.
+type cents struct{}
+
+func (cents) Places() int { return 2 }
+
+type decimals struct {
+	Micro Decimal[Micro] `obi:"micro"`
+	Cents Decimal[cents] `obi:"cents"`
+}
+
+func TestDecimalPrecision(t *testing.T) {
+	price := decimals{
+		Decimal[Micro]{big.NewRat(3, 2)},
+		// 1/3 is truncated to 0.33.
+		Decimal[cents]{big.NewRat(1, 3)},
+	}
+	schema, err := GetSchema(price)
+	if err != nil || schema != "{micro:i64,cents:i64}" {
+		t.Errorf("GetSchema = %s, %v", schema, err)
+	}
+	bz, err := Encode(price)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(EncodeSigned64(1500000), EncodeSigned64(33)...); !bytes.Equal(bz, want) {
+		t.Errorf("Encode = %x, want %x", bz, want)
+	}
+
+	var got decimals
+	err = Decode(bz, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Micro.String() != "1.500000" || got.Cents.String() != "0.33" {
+		t.Errorf("Decode = %s and %s, want 1.500000 and 0.33", got.Micro, got.Cents)
+	}
+	if zero := (Decimal[cents]{}).String(); zero != "0.00" {
+		t.Errorf("zero Decimal is %s, want 0.00", zero)
+	}
+
+	_, err = Encode(Decimal[Micro]{new(big.Rat).SetInt64(1 << 60)})
+	if err == nil || !strings.Contains(err.Error(), "out of range of i64 with precision 6") {
+		t.Errorf("Encode of a Decimal out of range returned %v", err)
+	}
+}
+
+type quote struct {
+	Symbol string   `obi:"symbol"`
+	Rates  []uint16 `obi:"rates"`
+	Ok     bool     `obi:"ok"`
+}
+
+func TestDecodeErrorPosition(t *testing.T) {
+	valid := MustEncode(quote{Symbol: "LUNA", Rates: []uint16{1, 2, 3}, Ok: true})
+	// symbol takes 8 bytes, the length of rates 4 and every rate 2, so ok is at offset 18.
+	badBool := append(append([]byte{}, valid[:18]...), 2)
+
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		offset   int
+		path     string
+		expected string
+		err      string
+	}{
+		{"truncated string", valid[:6], 0, ".Symbol", "string", "obi: cannot decode string at .Symbol (offset 0, 6 bytes left): out of range"},
+		{"truncated rate", valid[:15], 14, ".Rates[1]", "u16", "obi: cannot decode u16 at .Rates[1] (offset 14, 1 bytes left): out of range"},
+		{"missing bool", valid[:18], 18, ".Ok", "bool", "obi: cannot decode bool at .Ok (offset 18, 0 bytes left): out of range"},
+		{"invalid bool", badBool, 18, ".Ok", "bool", "obi: cannot decode bool at .Ok (offset 18, 1 bytes left): invalid bool 2"},
+	} {
+		var q quote
+		err := Decode(tc.data, &q)
+		var de *DecodeError
+		if !errors.As(err, &de) {
+			t.Errorf("%s: Decode returned %v, want a DecodeError", tc.name, err)
+			continue
+		}
+		if de.Offset != tc.offset || de.Path != tc.path || de.Expected != tc.expected {
+			t.Errorf("%s: DecodeError at offset %d %s (%s), want offset %d %s (%s)", tc.name, de.Offset, de.Path, de.Expected, tc.offset, tc.path, tc.expected)
+		}
+		if de.Error() != tc.err {
+			t.Errorf("%s: DecodeError is %q, want %q", tc.name, de.Error(), tc.err)
+		}
+	}
+
+	// The second value of Decode is located from the start of the data.
+	var n uint8
+	var s string
+	err := Decode(append([]byte{7}, EncodeString("LUNA")[:5]...), &n, &s)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Offset != 1 || de.Path != "" || de.Expected != "string" {
+		t.Errorf("Decode of a truncated second value returned %v", err)
+	}
+}
+
+func TestDecodeLenient(t *testing.T) {
+	extra := []byte{0xde, 0xad}
+	bz := append(MustEncode(uint8(7), "LUNA"), extra...)
+
+	var n uint8
+	var s string
+	rem, err := DecodeLenient(bz, &n, &s)
+	if err != nil || n != 7 || s != "LUNA" || !bytes.Equal(rem, extra) {
+		t.Errorf("DecodeLenient = %d, %q, %x, %v", n, s, rem, err)
+	}
+	rem, err = DecodeLenient(bz[:5], &n, &s)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Offset != 1 || rem != nil {
+		t.Errorf("DecodeLenient of a truncated value returned %x, %v", rem, err)
+	}
+
+	// An oracle script that appended a field to its output still decodes with the old schema.
+	appended := MustEncode("LUNA", []uint16{1}, true, uint64(99))
+	var q quote
+	err = DecodeWithSchema("{symbol:string,rates:[u16],ok:bool}", appended, &q)
+	if !errors.As(err, &de) || de.Err != ErrTrailingData || de.Offset != 15 || de.Remaining != 8 {
+		t.Errorf("DecodeWithSchema of appended data returned %v", err)
+	}
+	rem, err = DecodeWithSchemaLenient("{symbol:string,rates:[u16],ok:bool}", appended, &q)
+	if err != nil || q.Symbol != "LUNA" || len(q.Rates) != 1 || !q.Ok || !bytes.Equal(rem, EncodeUnsigned64(99)) {
+		t.Errorf("DecodeWithSchemaLenient = %+v, %x, %v", q, rem, err)
+	}
+}
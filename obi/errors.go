@@ -0,0 +1,97 @@
+package obi
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// ErrTrailingData is the error of a DecodeError for data that is left after decoding.
+var ErrTrailingData = errors.New("obi: not all data was consumed while decoding")
+
+// ErrUnsortedMapKeys is the error of a DecodeError for map keys that are not sorted by their encoded
+// bytes or not unique.
+var ErrUnsortedMapKeys = errors.New("obi: map keys are not sorted or not unique")
+
+// DecodeError describes where and why decoding failed.
+type DecodeError struct {
+	// Offset is the position of the value that failed to decode from the start of the data.
+	Offset int
+	// Path is the path of the value inside the decoded value, e.g. ".Symbols[2]".
+	Path string
+	// Expected is the OBI type of the value, or its Go type if it has no OBI schema.
+	Expected string
+	// Remaining is the number of bytes left from Offset, or -1 when decoding from a reader.
+	Remaining int
+	Err       error
+}
+
+func (e *DecodeError) Error() string {
+	reason := strings.TrimPrefix(e.Err.Error(), "obi: ")
+	if e.Err == ErrTrailingData {
+		return fmt.Sprintf("obi: %s, %d bytes left at offset %d", reason, e.Remaining, e.Offset)
+	}
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "obi: cannot decode %s", e.Expected)
+	if e.Path != "" {
+		fmt.Fprintf(b, " at %s", e.Path)
+	}
+	if e.Remaining < 0 {
+		fmt.Fprintf(b, " (offset %d): %s", e.Offset, reason)
+	} else {
+		fmt.Fprintf(b, " (offset %d, %d bytes left): %s", e.Offset, e.Remaining, reason)
+	}
+	return b.String()
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// decodeErrorAt turns err into a DecodeError for a value of the expected type at the front of data.
+// Errors that are already DecodeErrors of nested values are returned as they are.
+func decodeErrorAt(data []byte, expected func() string, err error) error {
+	if _, ok := err.(*DecodeError); ok {
+		return err
+	}
+	return &DecodeError{Expected: expected(), Remaining: len(data), Err: err}
+}
+
+// withPath prepends a path segment to the path of a DecodeError.
+func withPath(err error, segment string) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.Path = segment + de.Path
+	}
+	return err
+}
+
+// locate sets the offset of a DecodeError from the size of the whole decoded data.
+func locate(err error, size int) error {
+	if de, ok := err.(*DecodeError); ok {
+		de.Offset = size - de.Remaining
+	}
+	return err
+}
+
+// trailingError returns a DecodeError if data is left after decoding.
+func trailingError(size int, rem []byte) error {
+	if len(rem) == 0 {
+		return nil
+	}
+	return &DecodeError{Offset: size - len(rem), Remaining: len(rem), Err: ErrTrailingData}
+}
+
+// expectedType describes the type being decoded for a DecodeError.
+func expectedType(t reflect.Type, schema *Schema) func() string {
+	return func() string {
+		if schema != nil {
+			return schema.String()
+		}
+		s := &strings.Builder{}
+		if getSchemaImpl(s, t, map[reflect.Type]bool{}) == nil {
+			return s.String()
+		}
+		return t.String()
+	}
+}
@@ -0,0 +1,105 @@
+package obi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// checkFuzzDecodeError checks that err is a DecodeError at an offset within data.
+func checkFuzzDecodeError(t *testing.T, err error, data []byte) {
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("decoding returned %v, want a DecodeError", err)
+	}
+	if de.Offset < 0 || de.Offset > len(data) {
+		t.Fatalf("decoding failed at offset %d of %d bytes", de.Offset, len(data))
+	}
+}
+
+// FuzzDecodeValue decodes arbitrary bytes with the schema of a golden vector, and checks that they
+// either fail with a DecodeError or encode back into the same bytes, also through JSON.
+func FuzzDecodeValue(f *testing.F) {
+	vectors := loadGoldenVectors(f)
+	for idx, v := range vectors {
+		bz, err := hex.DecodeString(v.Hex)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(uint8(idx), bz)
+		f.Add(uint8(idx), bz[:len(bz)-1])
+	}
+	f.Fuzz(func(t *testing.T, idx uint8, data []byte) {
+		v := vectors[int(idx)%len(vectors)]
+		schema := MustParseSchema(v.Schema)
+
+		value, err := DecodeValue(schema, data)
+		if err != nil {
+			checkFuzzDecodeError(t, err, data)
+			return
+		}
+		bz, err := EncodeValue(schema, value)
+		if err != nil {
+			t.Fatalf("EncodeValue of decoded %s returned %v", v.Schema, err)
+		}
+		if !bytes.Equal(bz, data) {
+			t.Fatalf("EncodeValue of decoded %s = %x, want %x", v.Schema, bz, data)
+		}
+
+		js, err := ToJSON(v.Schema, data)
+		if err != nil {
+			t.Fatalf("ToJSON of %s returned %v", v.Schema, err)
+		}
+		if bytes.Contains(js, []byte("�")) {
+			// JSON replaces strings that are not valid UTF-8, so they cannot round trip.
+			return
+		}
+		bz, err = FromJSON(v.Schema, js)
+		if err != nil {
+			t.Fatalf("FromJSON of %s returned %v", js, err)
+		}
+		if !bytes.Equal(bz, data) {
+			t.Fatalf("FromJSON of %s = %x, want %x", js, bz, data)
+		}
+	})
+}
+
+// fuzzDecode checks that data either fails to decode into a T from both a byte slice and a reader
+// at the same offset, or decodes alike from both and encodes back into the same bytes.
+func fuzzDecode[T any](t *testing.T, data []byte) {
+	var fromSlice, fromReader T
+	sliceErr := Decode(data, &fromSlice)
+	readerErr := NewDecoder(bytes.NewReader(data)).Decode(&fromReader)
+
+	if sliceErr != nil {
+		checkFuzzDecodeError(t, sliceErr, data)
+		return
+	}
+	// A Decoder ignores trailing data, so it must decode whatever Decode does.
+	if readerErr != nil {
+		t.Fatalf("Decode succeeded but Decoder.Decode returned %v", readerErr)
+	}
+	if !reflect.DeepEqual(fromSlice, fromReader) {
+		t.Fatalf("Decode = %+v but Decoder.Decode = %+v", fromSlice, fromReader)
+	}
+
+	bz, err := Encode(fromSlice)
+	if err != nil {
+		t.Fatalf("Encode of decoded %+v returned %v", fromSlice, err)
+	}
+	if !bytes.Equal(bz, data) {
+		t.Fatalf("Encode of decoded %+v = %x, want %x", fromSlice, bz, data)
+	}
+}
+
+func FuzzDecodeQuote(f *testing.F) {
+	for _, q := range []quote{{}, {Symbol: "KRW", Rates: []uint16{1, 65535}, Ok: true}} {
+		bz := MustEncode(q)
+		f.Add(bz)
+		f.Add(bz[:len(bz)-1])
+	}
+	f.Add([]byte{0xff, 0xff, 0xff, 0xff})
+	f.Fuzz(fuzzDecode[quote])
+}
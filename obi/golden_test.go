@@ -0,0 +1,107 @@
+package obi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+// goldenVector is a vector of testdata/golden.json, see testdata/README.md for where its bytes
+// come from.
+type goldenVector struct {
+	Name      string          `json:"name"`
+	Schema    string          `json:"schema"`
+	Value     json.RawMessage `json:"value"`
+	Hex       string          `json:"hex"`
+	Reference string          `json:"reference"`
+}
+
+func loadGoldenVectors(tb testing.TB) []goldenVector {
+	bz, err := os.ReadFile("testdata/golden.json")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var vectors []goldenVector
+	err = json.Unmarshal(bz, &vectors)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return vectors
+}
+
+func goldenBytes(tb testing.TB, name string) []byte {
+	for _, v := range loadGoldenVectors(tb) {
+		if v.Name == name {
+			bz, err := hex.DecodeString(v.Hex)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			return bz
+		}
+	}
+	tb.Fatalf("no golden vector %s", name)
+	return nil
+}
+
+func TestGoldenVectors(t *testing.T) {
+	for _, v := range loadGoldenVectors(t) {
+		want, err := hex.DecodeString(v.Hex)
+		if err != nil {
+			t.Fatalf("%s: invalid golden hex, %v", v.Name, err)
+		}
+
+		got, err := FromJSON(v.Schema, v.Value)
+		if err != nil {
+			t.Fatalf("%s: FromJSON returned %v", v.Name, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: FromJSON = %x, want %x", v.Name, got, want)
+		}
+
+		// ToJSON writes the fields in schema order and the map entries in key order, as in the file.
+		value := &bytes.Buffer{}
+		err = json.Compact(value, v.Value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		decoded, err := ToJSON(v.Schema, want)
+		if err != nil {
+			t.Fatalf("%s: ToJSON returned %v", v.Name, err)
+		}
+		if !bytes.Equal(decoded, value.Bytes()) {
+			t.Errorf("%s: ToJSON = %s, want %s", v.Name, decoded, value)
+		}
+	}
+}
+
+func TestGoldenVectorsOfStructs(t *testing.T) {
+	// The oracle script declares the fields of the calldata in another order than the struct.
+	callData := struct {
+		Symbol     string `obi:"symbol"`
+		Multiplier uint64 `obi:"multiplier"`
+	}{"LUNA", 1000000}
+
+	got, err := Encode(callData)
+	if err != nil {
+		t.Fatalf("Encode returned %v", err)
+	}
+	if want := goldenBytes(t, "luna_price input"); !bytes.Equal(got, want) {
+		t.Errorf("Encode = %x, want %x", got, want)
+	}
+
+	got, err = EncodeWithSchema("{multiplier:u64,symbol:string}", callData)
+	if err != nil {
+		t.Fatalf("EncodeWithSchema returned %v", err)
+	}
+	if want := goldenBytes(t, "luna_price input in oracle script order"); !bytes.Equal(got, want) {
+		t.Errorf("EncodeWithSchema = %x, want %x", got, want)
+	}
+
+	var rates []uint64
+	err = Decode(goldenBytes(t, "fx_price output"), &rates)
+	if err != nil || len(rates) != 3 || rates[0] != 1000 || rates[1] != 400 || rates[2] != 1250000 {
+		t.Errorf("Decode = %v, %v, want [1000 400 1250000]", rates, err)
+	}
+}
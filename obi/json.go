@@ -0,0 +1,143 @@
+package obi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+func writeJSONImpl(buf *bytes.Buffer, schema *Schema, v interface{}) error {
+	switch schema.Kind {
+	case KindBytes:
+		bz, err := json.Marshal(hex.EncodeToString(v.([]byte)))
+		if err != nil {
+			return err
+		}
+		buf.Write(bz)
+	case KindOption:
+		if v == nil {
+			buf.WriteString("null")
+			return nil
+		}
+		return writeJSONImpl(buf, schema.Elem, v)
+	case KindMap:
+		entries := v.([]MapEntry)
+		if schema.Key.Kind == KindString {
+			buf.WriteString("{")
+			for idx, entry := range entries {
+				if idx != 0 {
+					buf.WriteString(",")
+				}
+				err := writeJSONImpl(buf, schema.Key, entry.Key)
+				if err != nil {
+					return err
+				}
+				buf.WriteString(":")
+				err = writeJSONImpl(buf, schema.Elem, entry.Value)
+				if err != nil {
+					return err
+				}
+			}
+			buf.WriteString("}")
+			return nil
+		}
+		buf.WriteString("[")
+		for idx, entry := range entries {
+			if idx != 0 {
+				buf.WriteString(",")
+			}
+			buf.WriteString("[")
+			err := writeJSONImpl(buf, schema.Key, entry.Key)
+			if err != nil {
+				return err
+			}
+			buf.WriteString(",")
+			err = writeJSONImpl(buf, schema.Elem, entry.Value)
+			if err != nil {
+				return err
+			}
+			buf.WriteString("]")
+		}
+		buf.WriteString("]")
+	case KindVector, KindArray:
+		buf.WriteString("[")
+		for idx, elem := range v.([]interface{}) {
+			if idx != 0 {
+				buf.WriteString(",")
+			}
+			err := writeJSONImpl(buf, schema.Elem, elem)
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteString("]")
+	case KindStruct:
+		fields := v.(map[string]interface{})
+		buf.WriteString("{")
+		for idx, field := range schema.Fields {
+			if idx != 0 {
+				buf.WriteString(",")
+			}
+			name, err := json.Marshal(field.Name)
+			if err != nil {
+				return err
+			}
+			buf.Write(name)
+			buf.WriteString(":")
+			err = writeJSONImpl(buf, field.Type, fields[field.Name])
+			if err != nil {
+				return err
+			}
+		}
+		buf.WriteString("}")
+	default:
+		bz, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(bz)
+	}
+	return nil
+}
+
+// ToJSON decodes OBI encoded data with the given schema into JSON. Struct fields keep their schema
+// order, integers are written as JSON numbers without losing precision and bytes as hex strings.
+// Absent options are null. Maps with string keys are objects, other maps are arrays of [key, value].
+func ToJSON(schema string, data []byte) ([]byte, error) {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	v, err := DecodeValue(s, data)
+	if err != nil {
+		return nil, err
+	}
+	buf := &bytes.Buffer{}
+	err = writeJSONImpl(buf, s, v)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// FromJSON encodes JSON into OBI bytes with the given schema. It accepts the JSON written by ToJSON,
+// and integers may also be given as decimal strings.
+func FromJSON(schema string, data []byte) ([]byte, error) {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v interface{}
+	err = dec.Decode(&v)
+	if err != nil {
+		return nil, fmt.Errorf("obi: invalid json, %v", err)
+	}
+	if dec.More() {
+		return nil, errors.New("obi: unexpected data after json value")
+	}
+	return EncodeValue(s, v)
+}
@@ -0,0 +1,101 @@
+package obi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestJSONRoundTrip(t *testing.T) {
+	testCases := []struct {
+		schema string
+		json   string
+	}{
+		{"{symbol:string,multiplier:u64}", `{"symbol":"LUNA","multiplier":1000000}`},
+		// Integers keep their precision beyond float64.
+		{"{max:u64,min:i64}", `{"max":18446744073709551615,"min":-9223372036854775808}`},
+		{"[i32]", `[-1,0,2147483647]`},
+		{"[u64]", `[]`},
+		{"bytes", `"deadbeef"`},
+		{"{ok:bool,fixed:[u8;3]}", `{"ok":true,"fixed":[1,2,3]}`},
+		{"[option<string>]", `[null,"set"]`},
+		{"map<string,u16>", `{"a":1,"b":2}`},
+		{"map<u8,string>", `[[1,"one"],[2,"two"]]`},
+		{"{rates:[{symbol:string,px:u64}]}", `{"rates":[{"symbol":"KRW","px":1000},{"symbol":"MNT","px":400}]}`},
+	}
+	for _, tc := range testCases {
+		bz, err := FromJSON(tc.schema, []byte(tc.json))
+		if err != nil {
+			t.Errorf("FromJSON(%s, %s) returned %v", tc.schema, tc.json, err)
+			continue
+		}
+		out, err := ToJSON(tc.schema, bz)
+		if err != nil {
+			t.Errorf("ToJSON(%s, %x) returned %v", tc.schema, bz, err)
+			continue
+		}
+		if string(out) != tc.json {
+			t.Errorf("%s round trips %s into %s", tc.schema, tc.json, out)
+		}
+	}
+}
+
+func TestFromJSONMatchesEncode(t *testing.T) {
+	bz, err := FromJSON("{symbol:string,multiplier:u64}", []byte(`{"multiplier":"1000000","symbol":"LUNA"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := MustEncode(struct {
+		Symbol     string
+		Multiplier uint64
+	}{"LUNA", 1000000})
+	if string(bz) != string(want) {
+		t.Errorf("FromJSON of a decimal string = %x, want %x", bz, want)
+	}
+}
+
+func TestFromJSONErrors(t *testing.T) {
+	testCases := []struct {
+		schema string
+		json   string
+		err    string
+	}{
+		{"{symbol:string", `{"symbol":"LUNA"}`, "obi: invalid schema"},
+		{"u64", `{`, "obi: invalid json"},
+		{"u64", `1 2`, "obi: unexpected data after json value"},
+		{"u8", `256`, "obi: 256 is out of range of u8"},
+		{"u64", `-1`, "obi: -1 is out of range of u64"},
+		{"u64", `1.5`, "is not an integer"},
+		{"u64", `"ten"`, "is not an integer"},
+		{"string", `1`, "obi: expect string"},
+		{"bytes", `"xyz"`, "obi: bytes must be hex encoded"},
+		{"[u8;2]", `[1]`, "obi: expect 2 elements but got 1"},
+		{"{a:u8,b:u8}", `{"a":1}`, "obi: expect 2 fields but got 1"},
+		{"{a:u8,b:u8}", `{"a":1,"c":2}`, "obi: missing field b"},
+		{"map<u8,u8>", `[[1]]`, "obi: map entry must be a [key, value] pair"},
+	}
+	for _, tc := range testCases {
+		_, err := FromJSON(tc.schema, []byte(tc.json))
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("FromJSON(%s, %s) returned %v, want %q", tc.schema, tc.json, err, tc.err)
+		}
+	}
+}
+
+func TestToJSONErrors(t *testing.T) {
+	testCases := []struct {
+		schema string
+		data   []byte
+		err    string
+	}{
+		{"[u8", nil, "obi: invalid schema"},
+		{"u64", []byte{0, 0, 1}, "obi: cannot decode u64 (offset 0, 3 bytes left)"},
+		{"u8", []byte{1, 2}, "not all data was consumed"},
+		{"bool", []byte{2}, "invalid bool 2"},
+	}
+	for _, tc := range testCases {
+		_, err := ToJSON(tc.schema, tc.data)
+		if err == nil || !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("ToJSON(%s, %x) returned %v, want %q", tc.schema, tc.data, err, tc.err)
+		}
+	}
+}
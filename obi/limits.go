@@ -0,0 +1,52 @@
+package obi
+
+import (
+	"fmt"
+)
+
+// Limits bound what decoding accepts, so a malicious length prefix cannot cause a huge allocation
+// and deeply nested data cannot exhaust the stack. Zero means no limit.
+type Limits struct {
+	// MaxBytesLength is the maximum length of strings and bytes.
+	MaxBytesLength int
+	// MaxSliceLength is the maximum number of elements of vectors and entries of maps.
+	MaxSliceLength int
+	// MaxDepth is the maximum nesting of values, counting every vector, array, option, map and struct.
+	MaxDepth int
+}
+
+// DefaultLimits are the limits of Decode, DecodeValue, DecodeBytes, DecodeString, DecodeLength and of
+// a new Decoder.
+var DefaultLimits = Limits{
+	MaxBytesLength: 1 << 20,
+	MaxSliceLength: 1 << 16,
+	MaxDepth:       64,
+}
+
+func checkLength(length uint32, max int) error {
+	if max > 0 && uint64(length) > uint64(max) {
+		return fmt.Errorf("obi: length %d exceeds the limit of %d", length, max)
+	}
+	return nil
+}
+
+func checkDepth(depth int, max int) error {
+	if max > 0 && depth > max {
+		return fmt.Errorf("obi: nesting exceeds the depth limit of %d", max)
+	}
+	return nil
+}
+
+// DecodeLength decodes the length prefix of a vector or map, checking it against
+// DefaultLimits.MaxSliceLength, and returns the remaining bytes.
+func DecodeLength(data []byte) (int, []byte, error) {
+	length, rem, err := DecodeUnsigned32(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	err = checkLength(length, DefaultLimits.MaxSliceLength)
+	if err != nil {
+		return 0, nil, err
+	}
+	return int(length), rem, nil
+}
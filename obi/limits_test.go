@@ -0,0 +1,121 @@
+package obi
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type limitedInner struct {
+	Inner []uint16
+}
+
+type limitedValue struct {
+	Head  uint8
+	Name  string
+	Outer []limitedInner
+}
+
+// checkDecodeError checks that err is a DecodeError at the given offset and path whose reason
+// contains the given text.
+func checkDecodeError(t *testing.T, name string, err error, offset int, path string, reason string) {
+	t.Helper()
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Errorf("%s returned %v, want a DecodeError", name, err)
+		return
+	}
+	if de.Offset != offset || de.Path != path {
+		t.Errorf("%s failed at offset %d %q, want offset %d %q", name, de.Offset, de.Path, offset, path)
+	}
+	if !strings.Contains(de.Err.Error(), reason) {
+		t.Errorf("%s failed with %v, want %q", name, de.Err, reason)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	value := limitedValue{
+		Head:  1,
+		Name:  "hello",
+		Outer: []limitedInner{{Inner: []uint16{1}}, {Inner: []uint16{1, 2, 3}}},
+	}
+	bz := MustEncode(value)
+	// Head is 1 byte and Name 4+5 bytes. Outer[0] starts after the 4 byte length of Outer and
+	// takes 4+2 bytes, so Outer[1].Inner starts at 1+9+4+6.
+	for _, tc := range []struct {
+		name   string
+		limits Limits
+		offset int
+		path   string
+		reason string
+	}{
+		{"MaxBytesLength", Limits{MaxBytesLength: 4}, 1, ".Name", "length 5 exceeds the limit of 4"},
+		{"MaxSliceLength", Limits{MaxSliceLength: 2}, 20, ".Outer[1].Inner", "length 3 exceeds the limit of 2"},
+		{"MaxDepth", Limits{MaxDepth: 3}, 14, ".Outer[0].Inner", "exceeds the depth limit of 3"},
+	} {
+		dec := NewDecoder(bytes.NewReader(bz))
+		dec.SetLimits(tc.limits)
+		var got limitedValue
+		checkDecodeError(t, tc.name, dec.Decode(&got), tc.offset, tc.path, tc.reason)
+	}
+
+	var got limitedValue
+	err := NewDecoder(bytes.NewReader(bz)).Decode(&got)
+	if err != nil {
+		t.Errorf("Decoder.Decode within DefaultLimits returned %v", err)
+	}
+}
+
+func TestDecodeRejectsForgedLengths(t *testing.T) {
+	type raw struct {
+		Head uint8
+		Data []byte
+	}
+	forged := append([]byte{1}, EncodeUnsigned32(uint32(DefaultLimits.MaxBytesLength)+1)...)
+	var r raw
+	checkDecodeError(t, "Decode of a forged bytes length", Decode(forged, &r), 1, ".Data", "exceeds the limit")
+
+	type list struct {
+		Head  uint8
+		Items []uint32
+	}
+	forged = append([]byte{1}, EncodeUnsigned32(uint32(DefaultLimits.MaxSliceLength)+1)...)
+	var l list
+	checkDecodeError(t, "Decode of a forged vector length", Decode(forged, &l), 1, ".Items", "exceeds the limit")
+
+	schema := MustParseSchema("{head:u8,items:[u32]}")
+	_, err := DecodeValue(schema, forged)
+	checkDecodeError(t, "DecodeValue of a forged vector length", err, 1, ".items", "exceeds the limit")
+
+	_, _, err = DecodeBytes(EncodeUnsigned32(uint32(DefaultLimits.MaxBytesLength) + 1))
+	if err == nil {
+		t.Errorf("DecodeBytes of a forged length returned no error")
+	}
+	_, _, err = DecodeString(EncodeUnsigned32(uint32(DefaultLimits.MaxBytesLength) + 1))
+	if err == nil {
+		t.Errorf("DecodeString of a forged length returned no error")
+	}
+	_, _, err = DecodeLength(EncodeUnsigned32(uint32(DefaultLimits.MaxSliceLength) + 1))
+	if err == nil {
+		t.Errorf("DecodeLength of a forged length returned no error")
+	}
+}
+
+func TestDecodeValueDepth(t *testing.T) {
+	nested := func(options int) (*Schema, []byte) {
+		schema := strings.Repeat("option<", options) + "u8" + strings.Repeat(">", options)
+		return MustParseSchema(schema), append(bytes.Repeat([]byte{1}, options), 7)
+	}
+
+	// The u8 inside MaxDepth-1 options is at the depth limit.
+	schema, data := nested(DefaultLimits.MaxDepth - 1)
+	_, err := DecodeValue(schema, data)
+	if err != nil {
+		t.Errorf("DecodeValue at the depth limit returned %v", err)
+	}
+
+	schema, data = nested(DefaultLimits.MaxDepth)
+	_, err = DecodeValue(schema, data)
+	checkDecodeError(t, "DecodeValue beyond the depth limit", err, DefaultLimits.MaxDepth, "", "exceeds the depth limit")
+}
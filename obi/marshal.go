@@ -0,0 +1,219 @@
+package obi
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// Marshaler is implemented by types that encode themselves into OBI bytes.
+type Marshaler interface {
+	MarshalOBI() ([]byte, error)
+}
+
+// Appender is implemented by Marshaler types that can append their encoding to a buffer, such as
+// the types generated by obigen. It is used instead of MarshalOBI to avoid an allocation.
+type Appender interface {
+	AppendOBI(b []byte) ([]byte, error)
+}
+
+// Unmarshaler is implemented by types that decode themselves from the front of the given OBI bytes.
+// UnmarshalOBI returns the remaining bytes.
+type Unmarshaler interface {
+	UnmarshalOBI(data []byte) ([]byte, error)
+}
+
+// Schemer is implemented by Marshaler and Unmarshaler types to report the OBI schema they are encoded as.
+type Schemer interface {
+	OBISchema() string
+}
+
+var (
+	marshalerType   = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	schemerType     = reflect.TypeOf((*Schemer)(nil)).Elem()
+
+	// structSchemas caches the struct schemas reported by Schemer struct types, or nil for
+	// struct types that report another schema.
+	structSchemas sync.Map
+)
+
+// asMarshaler returns the Marshaler of the value, looking at its pointer if the value is addressable.
+func asMarshaler(rv reflect.Value) (Marshaler, bool) {
+	if rv.Type().Implements(marshalerType) && rv.CanInterface() {
+		return rv.Interface().(Marshaler), true
+	}
+	if rv.CanAddr() && reflect.PtrTo(rv.Type()).Implements(marshalerType) {
+		return rv.Addr().Interface().(Marshaler), true
+	}
+	return nil, false
+}
+
+// asUnmarshaler returns the Unmarshaler of an addressable value.
+func asUnmarshaler(ev reflect.Value) (Unmarshaler, bool) {
+	if ev.CanAddr() && reflect.PtrTo(ev.Type()).Implements(unmarshalerType) {
+		return ev.Addr().Interface().(Unmarshaler), true
+	}
+	return nil, false
+}
+
+// customSchema returns the schema reported by a Schemer type, if any.
+func customSchema(t reflect.Type) (string, bool) {
+	if t.Implements(schemerType) {
+		return reflect.Zero(t).Interface().(Schemer).OBISchema(), true
+	}
+	if reflect.PtrTo(t).Implements(schemerType) {
+		return reflect.New(t).Interface().(Schemer).OBISchema(), true
+	}
+	return "", false
+}
+
+// BigInt is a big.Int that is OBI encoded as an i64.
+type BigInt struct {
+	*big.Int
+}
+
+func (b BigInt) OBISchema() string { return "i64" }
+
+func (b BigInt) MarshalOBI() ([]byte, error) {
+	if b.Int == nil {
+		return EncodeSigned64(0), nil
+	}
+	if !b.IsInt64() {
+		return nil, fmt.Errorf("obi: %s is out of range of i64", b.Int)
+	}
+	return EncodeSigned64(b.Int64()), nil
+}
+
+func (b *BigInt) UnmarshalOBI(data []byte) ([]byte, error) {
+	val, rem, err := DecodeSigned64(data)
+	if err != nil {
+		return nil, err
+	}
+	b.Int = big.NewInt(val)
+	return rem, nil
+}
+
+// BigUint is a non-negative big.Int that is OBI encoded as a u64.
+type BigUint struct {
+	*big.Int
+}
+
+func (b BigUint) OBISchema() string { return "u64" }
+
+func (b BigUint) MarshalOBI() ([]byte, error) {
+	if b.Int == nil {
+		return EncodeUnsigned64(0), nil
+	}
+	if b.Sign() < 0 || !b.IsUint64() {
+		return nil, fmt.Errorf("obi: %s is out of range of u64", b.Int)
+	}
+	return EncodeUnsigned64(b.Uint64()), nil
+}
+
+func (b *BigUint) UnmarshalOBI(data []byte) ([]byte, error) {
+	val, rem, err := DecodeUnsigned64(data)
+	if err != nil {
+		return nil, err
+	}
+	b.Int = new(big.Int).SetUint64(val)
+	return rem, nil
+}
+
+// Precision is the number of decimal places of a Decimal, i.e. a Decimal[P] is OBI encoded as its
+// value multiplied by 10^P.Places().
+type Precision interface {
+	Places() int
+}
+
+// Micro is the precision of 6 decimal places, the multiplier of 10^6 Band oracle scripts usually use.
+type Micro struct{}
+
+func (Micro) Places() int { return 6 }
+
+// Decimal is a fixed-point decimal with the precision P that is OBI encoded as an i64 holding its
+// value multiplied by 10^P.Places(). Values that do not fit are rejected, extra decimal places are
+// truncated.
+type Decimal[P Precision] struct {
+	*big.Rat
+}
+
+func (d Decimal[P]) places() int {
+	var p P
+	return p.Places()
+}
+
+func (d Decimal[P]) multiplier() *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(d.places())), nil)
+}
+
+func (d Decimal[P]) OBISchema() string { return "i64" }
+
+func (d Decimal[P]) MarshalOBI() ([]byte, error) {
+	if d.Rat == nil {
+		return EncodeSigned64(0), nil
+	}
+	scaled := new(big.Int).Mul(d.Num(), d.multiplier())
+	scaled.Quo(scaled, d.Denom())
+	if !scaled.IsInt64() {
+		return nil, fmt.Errorf("obi: %s is out of range of i64 with precision %d", d.FloatString(d.places()), d.places())
+	}
+	return EncodeSigned64(scaled.Int64()), nil
+}
+
+func (d *Decimal[P]) UnmarshalOBI(data []byte) ([]byte, error) {
+	val, rem, err := DecodeSigned64(data)
+	if err != nil {
+		return nil, err
+	}
+	d.Rat = new(big.Rat).SetFrac(big.NewInt(val), d.multiplier())
+	return rem, nil
+}
+
+// String returns the decimal with the decimal places of its precision.
+func (d Decimal[P]) String() string {
+	if d.Rat == nil {
+		return (&big.Rat{}).FloatString(d.places())
+	}
+	return d.FloatString(d.places())
+}
+
+// checkCustomSchema checks the schema reported by a Schemer type against the expected schema.
+func checkCustomSchema(t reflect.Type, schema *Schema) (bool, error) {
+	custom, ok := customSchema(t)
+	if !ok {
+		return false, nil
+	}
+	s, err := ParseSchema(custom)
+	if err != nil {
+		return true, fmt.Errorf("obi: invalid schema of %s: %s", t, strings.TrimPrefix(err.Error(), "obi: "))
+	}
+	if s.String() != schema.String() {
+		return true, fmt.Errorf("obi: %s is encoded as %s which does not match %s", t, s, schema)
+	}
+	return true, nil
+}
+
+// reordered reports whether a struct type that encodes itself, such as a type generated by obigen,
+// has to be laid out as the struct schema by the `obi` tags of its fields instead, because it encodes
+// its fields in another order.
+func reordered(t reflect.Type, schema *Schema) bool {
+	if schema == nil || schema.Kind != KindStruct || t.Kind() != reflect.Struct {
+		return false
+	}
+	cached, ok := structSchemas.Load(t)
+	if !ok {
+		var own *Schema
+		if custom, ok := customSchema(t); ok {
+			s, err := ParseSchema(custom)
+			if err == nil && s.Kind == KindStruct {
+				own = s
+			}
+		}
+		cached, _ = structSchemas.LoadOrStore(t, own)
+	}
+	own := cached.(*Schema)
+	return own != nil && own.String() != schema.String()
+}
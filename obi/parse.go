@@ -0,0 +1,296 @@
+package obi
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Kind is the kind of an OBI schema type.
+type Kind int
+
+const (
+	KindU8 Kind = iota
+	KindU16
+	KindU32
+	KindU64
+	KindI8
+	KindI16
+	KindI32
+	KindI64
+	KindString
+	KindBytes
+	KindVector
+	KindStruct
+	KindBool
+	KindArray
+	KindOption
+	KindMap
+)
+
+var primitiveKinds = map[string]Kind{
+	"u8":     KindU8,
+	"u16":    KindU16,
+	"u32":    KindU32,
+	"u64":    KindU64,
+	"i8":     KindI8,
+	"i16":    KindI16,
+	"i32":    KindI32,
+	"i64":    KindI64,
+	"string": KindString,
+	"bytes":  KindBytes,
+	"bool":   KindBool,
+}
+
+// Schema is a node of a parsed OBI schema.
+//
+// Besides the types of Band's OBI, the schema supports:
+//   - bool, encoded as a single byte that is 0 or 1.
+//   - [T;N], a fixed-size array encoded as its N elements without a length prefix.
+//   - option<T>, encoded as a presence byte that is 0 or 1, followed by the value if it is present.
+//   - map<K,V>, encoded as the u32 number of entries followed by every key and value, sorted by the
+//     encoded bytes of the keys. Keys must be unique.
+type Schema struct {
+	Kind Kind
+	// Elem is the element type of a vector, array or option, or the value type of a map.
+	Elem *Schema
+	// Key is the key type of a map.
+	Key *Schema
+	// Len is the length of an array.
+	Len int
+	// Fields are the fields of a struct in encoding order.
+	Fields []Field
+}
+
+// Field is a named field of a struct schema.
+type Field struct {
+	Name string
+	Type *Schema
+}
+
+type schemaParser struct {
+	input string
+	pos   int
+}
+
+func (p *schemaParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("obi: invalid schema at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *schemaParser) peek() byte {
+	if p.pos >= len(p.input) {
+		return 0
+	}
+	return p.input[p.pos]
+}
+
+func (p *schemaParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expect %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+func (p *schemaParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.input) && isIdentByte(p.input[p.pos]) {
+		p.pos++
+	}
+	return p.input[start:p.pos]
+}
+
+func (p *schemaParser) parseType() (*Schema, error) {
+	switch p.peek() {
+	case '[':
+		p.pos++
+		elem, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() == ';' {
+			p.pos++
+			start := p.pos
+			for p.pos < len(p.input) && p.input[p.pos] >= '0' && p.input[p.pos] <= '9' {
+				p.pos++
+			}
+			length, err := strconv.ParseUint(p.input[start:p.pos], 10, 31)
+			if err != nil {
+				p.pos = start
+				return nil, p.errorf("expect array length")
+			}
+			if err := p.expect(']'); err != nil {
+				return nil, err
+			}
+			return &Schema{Kind: KindArray, Elem: elem, Len: int(length)}, nil
+		}
+		if err := p.expect(']'); err != nil {
+			return nil, err
+		}
+		return &Schema{Kind: KindVector, Elem: elem}, nil
+	case '{':
+		p.pos++
+		s := &Schema{Kind: KindStruct}
+		names := map[string]bool{}
+		for {
+			name := p.ident()
+			if name == "" {
+				return nil, p.errorf("expect field name")
+			}
+			if names[name] {
+				return nil, p.errorf("duplicate field %q", name)
+			}
+			names[name] = true
+			if err := p.expect(':'); err != nil {
+				return nil, err
+			}
+			t, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			s.Fields = append(s.Fields, Field{Name: name, Type: t})
+			if p.peek() == '}' {
+				p.pos++
+				return s, nil
+			}
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		name := p.ident()
+		switch name {
+		case "option":
+			if err := p.expect('<'); err != nil {
+				return nil, err
+			}
+			elem, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect('>'); err != nil {
+				return nil, err
+			}
+			return &Schema{Kind: KindOption, Elem: elem}, nil
+		case "map":
+			if err := p.expect('<'); err != nil {
+				return nil, err
+			}
+			key, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+			elem, err := p.parseType()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect('>'); err != nil {
+				return nil, err
+			}
+			return &Schema{Kind: KindMap, Key: key, Elem: elem}, nil
+		}
+		kind, ok := primitiveKinds[name]
+		if !ok {
+			return nil, p.errorf("unknown type %q", name)
+		}
+		return &Schema{Kind: kind}, nil
+	}
+}
+
+// ParseSchema parses a single OBI schema such as "{symbol:string,multiplier:u64}". Whitespace is ignored.
+func ParseSchema(schema string) (*Schema, error) {
+	p := &schemaParser{input: strings.Join(strings.Fields(schema), "")}
+	s, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.input) {
+		return nil, p.errorf("unexpected trailing input")
+	}
+	return s, nil
+}
+
+// MustParseSchema parses a single OBI schema. Panics on error.
+func MustParseSchema(schema string) *Schema {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		panic(err)
+	}
+	return s
+}
+
+// ParseOracleScriptSchema parses the schema of an oracle script such as
+// "{symbol:string,multiplier:u64}/{px:u64}" into its input and output schemas.
+func ParseOracleScriptSchema(schema string) (*Schema, *Schema, error) {
+	parts := strings.Split(schema, "/")
+	if len(parts) != 2 {
+		return nil, nil, errors.New("obi: oracle script schema must be <input>/<output>")
+	}
+	input, err := ParseSchema(parts[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	output, err := ParseSchema(parts[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return input, output, nil
+}
+
+func (s *Schema) writeTo(b *strings.Builder) {
+	switch s.Kind {
+	case KindVector:
+		b.WriteString("[")
+		s.Elem.writeTo(b)
+		b.WriteString("]")
+	case KindArray:
+		b.WriteString("[")
+		s.Elem.writeTo(b)
+		b.WriteString(";")
+		b.WriteString(strconv.Itoa(s.Len))
+		b.WriteString("]")
+	case KindOption:
+		b.WriteString("option<")
+		s.Elem.writeTo(b)
+		b.WriteString(">")
+	case KindMap:
+		b.WriteString("map<")
+		s.Key.writeTo(b)
+		b.WriteString(",")
+		s.Elem.writeTo(b)
+		b.WriteString(">")
+	case KindStruct:
+		b.WriteString("{")
+		for idx, field := range s.Fields {
+			if idx != 0 {
+				b.WriteString(",")
+			}
+			b.WriteString(field.Name)
+			b.WriteString(":")
+			field.Type.writeTo(b)
+		}
+		b.WriteString("}")
+	default:
+		for name, kind := range primitiveKinds {
+			if kind == s.Kind {
+				b.WriteString(name)
+				return
+			}
+		}
+	}
+}
+
+// String returns the compact form of the schema, the same form that GetSchema returns.
+func (s *Schema) String() string {
+	b := &strings.Builder{}
+	s.writeTo(b)
+	return b.String()
+}
@@ -0,0 +1,126 @@
+package obi
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+var propertyScalarTypes = []reflect.Type{
+	reflect.TypeOf(false),
+	reflect.TypeOf(uint8(0)),
+	reflect.TypeOf(uint16(0)),
+	reflect.TypeOf(uint32(0)),
+	reflect.TypeOf(uint64(0)),
+	reflect.TypeOf(int8(0)),
+	reflect.TypeOf(int16(0)),
+	reflect.TypeOf(int32(0)),
+	reflect.TypeOf(int64(0)),
+	reflect.TypeOf(""),
+	reflect.TypeOf([]byte(nil)),
+}
+
+var propertyKeyTypes = []reflect.Type{
+	reflect.TypeOf(""),
+	reflect.TypeOf(uint32(0)),
+	reflect.TypeOf(int16(0)),
+}
+
+// randomType returns a random OBI encodable type nested at most depth levels deep.
+func randomType(r *rand.Rand, depth int) reflect.Type {
+	if depth == 0 {
+		return propertyScalarTypes[r.Intn(len(propertyScalarTypes))]
+	}
+	switch r.Intn(6) {
+	case 0:
+		return reflect.SliceOf(randomType(r, depth-1))
+	case 1:
+		return reflect.ArrayOf(1+r.Intn(3), randomType(r, depth-1))
+	case 2:
+		elem := randomType(r, depth-1)
+		if elem.Kind() == reflect.Ptr {
+			// DecodeValue cannot tell an absent option from a present option holding an absent one.
+			return elem
+		}
+		return reflect.PtrTo(elem)
+	case 3:
+		return reflect.MapOf(propertyKeyTypes[r.Intn(len(propertyKeyTypes))], randomType(r, depth-1))
+	case 4:
+		return randomStruct(r, depth-1)
+	default:
+		return propertyScalarTypes[r.Intn(len(propertyScalarTypes))]
+	}
+}
+
+// randomStruct returns a struct type of 1 to 4 random fields.
+func randomStruct(r *rand.Rand, depth int) reflect.Type {
+	fields := []reflect.StructField{}
+	for idx := 0; idx < 1+r.Intn(4); idx++ {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("F%d", idx),
+			Type: randomType(r, depth),
+			Tag:  reflect.StructTag(fmt.Sprintf(`obi:"f%d"`, idx)),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// TestEncodeDecodeRoundTrip encodes random values of random struct types and checks that decoding
+// them from a byte slice, from a reader and as generic values gives back the same bytes.
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for round := 0; round < 200; round++ {
+		typ := randomStruct(r, 3)
+		rv, ok := quick.Value(typ, r)
+		if !ok {
+			t.Fatalf("cannot generate a value of %s", typ)
+		}
+		value := rv.Interface()
+
+		bz, err := Encode(value)
+		if err != nil {
+			t.Fatalf("Encode of %s returned %v", typ, err)
+		}
+
+		fromSlice := reflect.New(typ)
+		err = Decode(bz, fromSlice.Interface())
+		if err != nil {
+			t.Fatalf("Decode of %s returned %v", typ, err)
+		}
+		again, err := Encode(fromSlice.Elem().Interface())
+		if err != nil {
+			t.Fatalf("Encode of decoded %s returned %v", typ, err)
+		}
+		if !bytes.Equal(again, bz) {
+			t.Fatalf("%s encodes to %x but re-encodes to %x after decoding", typ, bz, again)
+		}
+
+		fromReader := reflect.New(typ)
+		err = NewDecoder(bytes.NewReader(bz)).Decode(fromReader.Interface())
+		if err != nil {
+			t.Fatalf("Decoder.Decode of %s returned %v", typ, err)
+		}
+		if !reflect.DeepEqual(fromSlice.Interface(), fromReader.Interface()) {
+			t.Fatalf("%s decodes to %+v from a slice but %+v from a reader", typ, fromSlice.Elem(), fromReader.Elem())
+		}
+
+		schema, err := GetSchema(value)
+		if err != nil {
+			t.Fatalf("GetSchema of %s returned %v", typ, err)
+		}
+		generic, err := DecodeValue(MustParseSchema(schema), bz)
+		if err != nil {
+			t.Fatalf("DecodeValue of %s returned %v", schema, err)
+		}
+		again, err = EncodeValue(MustParseSchema(schema), generic)
+		if err != nil {
+			t.Fatalf("EncodeValue of %s returned %v", schema, err)
+		}
+		if !bytes.Equal(again, bz) {
+			t.Fatalf("%s encodes to %x but re-encodes to %x as a generic value", schema, bz, again)
+		}
+	}
+}
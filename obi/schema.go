@@ -7,8 +7,219 @@ import (
 	"strings"
 )
 
-func getSchemaImpl(s *strings.Builder, t reflect.Type) error {
+type structField struct {
+	Index  int
+	Name   string
+	Schema *Schema
+}
+
+// structFields returns the fields of the struct type that take part in OBI encoding, in declaration
+// order. Fields tagged with `obi:"-"` are skipped. Name is the `obi` tag, or empty for untagged fields.
+func structFields(t reflect.Type) ([]structField, error) {
+	fields := []structField{}
+	names := map[string]bool{}
+	for idx := 0; idx < t.NumField(); idx++ {
+		field := t.Field(idx)
+		name, tagged := field.Tag.Lookup("obi")
+		if name == "-" {
+			continue
+		}
+		if name != "" {
+			if names[name] {
+				return nil, fmt.Errorf("obi: more than one field of %s is tagged %s", t.Name(), name)
+			}
+			names[name] = true
+		}
+		if field.PkgPath != "" {
+			if tagged {
+				return nil, fmt.Errorf("obi: unexported field %s of %s cannot be tagged", field.Name, t.Name())
+			}
+			return nil, fmt.Errorf("obi: unexported field %s of %s must be tagged with `obi:\"-\"`", field.Name, t.Name())
+		}
+		fields = append(fields, structField{Index: idx, Name: name})
+	}
+	return fields, nil
+}
+
+// orderedFields returns the fields of the struct type in encoding order. Without a schema this is
+// the declaration order. With a schema, every schema field is matched to the struct field of the same
+// `obi` tag, along with its sub-schema.
+func orderedFields(t reflect.Type, schema *Schema) ([]structField, error) {
+	fields, err := structFields(t)
+	if err != nil {
+		return nil, err
+	}
+	if schema == nil {
+		return fields, nil
+	}
+
+	byName := map[string]structField{}
+	for _, field := range fields {
+		byName[field.Name] = field
+	}
+	ordered := []structField{}
+	for _, sf := range schema.Fields {
+		field, ok := byName[sf.Name]
+		if !ok {
+			return nil, fmt.Errorf("obi: no field of %s is tagged %s", t.Name(), sf.Name)
+		}
+		field.Schema = sf.Type
+		ordered = append(ordered, field)
+	}
+	return ordered, nil
+}
+
+// elem returns the element schema of a vector, array, option or map schema, or nil if there is no schema.
+func (s *Schema) elem() *Schema {
+	if s == nil {
+		return nil
+	}
+	return s.Elem
+}
+
+// key returns the key schema of a map schema, or nil if there is no schema.
+func (s *Schema) key() *Schema {
+	if s == nil {
+		return nil
+	}
+	return s.Key
+}
+
+var reflectKinds = map[reflect.Kind]Kind{
+	reflect.Uint8:  KindU8,
+	reflect.Uint16: KindU16,
+	reflect.Uint32: KindU32,
+	reflect.Uint64: KindU64,
+	reflect.Int8:   KindI8,
+	reflect.Int16:  KindI16,
+	reflect.Int32:  KindI32,
+	reflect.Int64:  KindI64,
+	reflect.String: KindString,
+	reflect.Bool:   KindBool,
+}
+
+// checkStructSchema checks that the fields of the struct type t can be laid out as the schema by their tags.
+func checkStructSchema(t reflect.Type, schema *Schema) error {
+	if schema.Kind != KindStruct {
+		return fmt.Errorf("obi: %s does not match %s", t, schema)
+	}
+	fields, err := structFields(t)
+	if err != nil {
+		return err
+	}
+	if len(fields) != len(schema.Fields) {
+		return fmt.Errorf("obi: %s has %d fields but %s has %d", t, len(fields), schema, len(schema.Fields))
+	}
+	ordered, err := orderedFields(t, schema)
+	if err != nil {
+		return err
+	}
+	for _, field := range ordered {
+		err := checkSchemaImpl(t.Field(field.Index).Type, field.Schema)
+		if err != nil {
+			return fmt.Errorf("obi: field %s of %s: %s", field.Name, t.Name(), strings.TrimPrefix(err.Error(), "obi: "))
+		}
+	}
+	return nil
+}
+
+// checkSchemaImpl checks that values of type t can be laid out as the schema.
+func checkSchemaImpl(t reflect.Type, schema *Schema) error {
+	if t == nil {
+		return errors.New("obi: nil value has no schema")
+	}
+	if t.Kind() == reflect.Ptr {
+		if schema.Kind != KindOption {
+			return fmt.Errorf("obi: %s does not match %s", t, schema)
+		}
+		return checkSchemaImpl(t.Elem(), schema.Elem)
+	}
+	if reordered(t, schema) {
+		return checkStructSchema(t, schema)
+	}
+	if ok, err := checkCustomSchema(t, schema); ok {
+		return err
+	}
+	if t.Implements(marshalerType) || reflect.PtrTo(t).Implements(unmarshalerType) {
+		return fmt.Errorf("obi: %s must implement Schemer to be checked against a schema", t)
+	}
 	switch t.Kind() {
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if schema.Kind != KindBytes {
+				return fmt.Errorf("obi: %s does not match %s", t, schema)
+			}
+			return nil
+		}
+		if schema.Kind != KindVector {
+			return fmt.Errorf("obi: %s does not match %s", t, schema)
+		}
+		return checkSchemaImpl(t.Elem(), schema.Elem)
+	case reflect.Array:
+		if schema.Kind != KindArray || schema.Len != t.Len() {
+			return fmt.Errorf("obi: %s does not match %s", t, schema)
+		}
+		return checkSchemaImpl(t.Elem(), schema.Elem)
+	case reflect.Map:
+		if schema.Kind != KindMap {
+			return fmt.Errorf("obi: %s does not match %s", t, schema)
+		}
+		err := checkSchemaImpl(t.Key(), schema.Key)
+		if err != nil {
+			return err
+		}
+		return checkSchemaImpl(t.Elem(), schema.Elem)
+	case reflect.Struct:
+		return checkStructSchema(t, schema)
+	default:
+		kind, ok := reflectKinds[t.Kind()]
+		if !ok {
+			return fmt.Errorf("obi: unsupported value type: %s", t.Kind())
+		}
+		if kind != schema.Kind {
+			return fmt.Errorf("obi: %s does not match %s", t, schema)
+		}
+		return nil
+	}
+}
+
+// CheckSchema returns an error if the value cannot be laid out as the given schema. Struct fields are
+// matched to the schema by their `obi` tag, so they may be declared in a different order.
+func CheckSchema(v interface{}, schema string) error {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return err
+	}
+	return checkSchemaImpl(reflect.TypeOf(v), s)
+}
+
+// getSchemaImpl writes the schema of t. visiting holds the struct types being written, since a
+// recursive type has no finite schema.
+func getSchemaImpl(s *strings.Builder, t reflect.Type, visiting map[reflect.Type]bool) error {
+	if t == nil {
+		return errors.New("obi: nil value has no schema")
+	}
+	if t.Kind() == reflect.Ptr {
+		s.WriteString("option<")
+		err := getSchemaImpl(s, t.Elem(), visiting)
+		if err != nil {
+			return err
+		}
+		s.WriteString(">")
+		return nil
+	}
+	if custom, ok := customSchema(t); ok {
+		schema, err := ParseSchema(custom)
+		if err != nil {
+			return fmt.Errorf("obi: invalid schema of %s: %s", t, strings.TrimPrefix(err.Error(), "obi: "))
+		}
+		s.WriteString(schema.String())
+		return nil
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		s.WriteString("bool")
+		return nil
 	case reflect.Uint8:
 		s.WriteString("u8")
 		return nil
@@ -42,29 +253,57 @@ func getSchemaImpl(s *strings.Builder, t reflect.Type) error {
 			return nil
 		}
 		s.WriteString("[")
-		err := getSchemaImpl(s, t.Elem())
+		err := getSchemaImpl(s, t.Elem(), visiting)
 		if err != nil {
 			return err
 		}
 		s.WriteString("]")
 		return nil
+	case reflect.Array:
+		s.WriteString("[")
+		err := getSchemaImpl(s, t.Elem(), visiting)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(s, ";%d]", t.Len())
+		return nil
+	case reflect.Map:
+		s.WriteString("map<")
+		err := getSchemaImpl(s, t.Key(), visiting)
+		if err != nil {
+			return err
+		}
+		s.WriteString(",")
+		err = getSchemaImpl(s, t.Elem(), visiting)
+		if err != nil {
+			return err
+		}
+		s.WriteString(">")
+		return nil
 	case reflect.Struct:
-		if t.NumField() == 0 {
+		if visiting[t] {
+			return fmt.Errorf("obi: recursive type %s has no schema", t)
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+		fields, err := structFields(t)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
 			return errors.New("obi: empty struct is not supported")
 		}
 		s.WriteString("{")
-		for idx := 0; idx < t.NumField(); idx++ {
-			field := t.Field(idx)
-			name, ok := field.Tag.Lookup("obi")
-			if !ok {
-				return fmt.Errorf("obi: no obi tag found for field %s of %s", field.Name, t.Name())
+		for idx, field := range fields {
+			if field.Name == "" {
+				return fmt.Errorf("obi: no obi tag found for field %s of %s", t.Field(field.Index).Name, t.Name())
 			}
 			if idx != 0 {
 				s.WriteString(",")
 			}
-			s.WriteString(name)
+			s.WriteString(field.Name)
 			s.WriteString(":")
-			err := getSchemaImpl(s, field.Type)
+			err := getSchemaImpl(s, t.Field(field.Index).Type, visiting)
 			if err != nil {
 				return err
 			}
@@ -79,7 +318,7 @@ func getSchemaImpl(s *strings.Builder, t reflect.Type) error {
 // GetSchema returns the compact OBI individual schema of the given value.
 func GetSchema(v interface{}) (string, error) {
 	s := &strings.Builder{}
-	err := getSchemaImpl(s, reflect.TypeOf(v))
+	err := getSchemaImpl(s, reflect.TypeOf(v), map[reflect.Type]bool{})
 	if err != nil {
 		return "", err
 	}
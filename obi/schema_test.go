@@ -0,0 +1,238 @@
+package obi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+// ownOrder encodes itself in declaration order like a type generated by obigen.
+type ownOrder struct {
+	Symbol     string `obi:"symbol"`
+	Multiplier uint64 `obi:"multiplier"`
+}
+
+// ownOrderCalls counts the calls of the methods of ownOrder.
+var ownOrderCalls int
+
+func (v ownOrder) OBISchema() string { return "{symbol:string,multiplier:u64}" }
+
+func (v ownOrder) MarshalOBI() ([]byte, error) { return v.AppendOBI(nil) }
+
+func (v ownOrder) AppendOBI(b []byte) ([]byte, error) {
+	ownOrderCalls++
+	b = append(b, EncodeString(v.Symbol)...)
+	return append(b, EncodeUnsigned64(v.Multiplier)...), nil
+}
+
+func (v *ownOrder) UnmarshalOBI(data []byte) ([]byte, error) {
+	ownOrderCalls++
+	var err error
+	v.Symbol, data, err = DecodeString(data)
+	if err != nil {
+		return nil, err
+	}
+	v.Multiplier, data, err = DecodeUnsigned64(data)
+	return data, err
+}
+
+func TestSelfEncodingStructKeepsSchemaOrder(t *testing.T) {
+	value := ownOrder{Symbol: "LUNA", Multiplier: 1000000}
+	reversed := "{multiplier:u64,symbol:string}"
+	want, _ := hex.DecodeString("00000000000f4240" + "00000004" + "4c554e41")
+
+	err := CheckSchema(value, reversed)
+	if err != nil {
+		t.Fatalf("CheckSchema returned %v", err)
+	}
+	err = CheckSchema(value, "{multiplier:u64,name:string}")
+	if err == nil {
+		t.Errorf("CheckSchema of a schema with another field returned no error")
+	}
+
+	ownOrderCalls = 0
+	got, err := EncodeWithSchema(reversed, value)
+	if err != nil {
+		t.Fatalf("EncodeWithSchema returned %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("EncodeWithSchema = %x, want %x", got, want)
+	}
+
+	var decoded ownOrder
+	err = DecodeWithSchema(reversed, want, &decoded)
+	if err != nil || decoded != value {
+		t.Errorf("DecodeWithSchema = %+v, %v, want %+v", decoded, err, value)
+	}
+	decoded = ownOrder{}
+	err = NewDecoder(bytes.NewReader(want)).DecodeWithSchema(reversed, &decoded)
+	if err != nil || decoded != value {
+		t.Errorf("Decoder.DecodeWithSchema = %+v, %v, want %+v", decoded, err, value)
+	}
+	if ownOrderCalls != 0 {
+		t.Errorf("the methods of ownOrder were called %d times for a schema in another order", ownOrderCalls)
+	}
+
+	// The methods are used for their own schema.
+	got, err = EncodeWithSchema(value.OBISchema(), value)
+	if err != nil || !bytes.Equal(got, MustEncode(value)) {
+		t.Errorf("EncodeWithSchema of the own schema = %x, %v, want %x", got, err, MustEncode(value))
+	}
+	err = DecodeWithSchema(value.OBISchema(), got, &decoded)
+	if err != nil || decoded != value {
+		t.Errorf("DecodeWithSchema of the own schema = %+v, %v, want %+v", decoded, err, value)
+	}
+	if ownOrderCalls == 0 {
+		t.Errorf("the methods of ownOrder were not called for its own schema")
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	for _, tc := range []struct {
+		schema string
+		want   string
+	}{
+		{"u8", "u8"},
+		{" { symbol : string , multiplier : u64 } ", "{symbol:string,multiplier:u64}"},
+		{"[{px:i64,ok:bool}]", "[{px:i64,ok:bool}]"},
+		{"[bytes;4]", "[bytes;4]"},
+		{"option<[u32]>", "option<[u32]>"},
+		{"map<string,map<u8,i16>>", "map<string,map<u8,i16>>"},
+	} {
+		s, err := ParseSchema(tc.schema)
+		if err != nil {
+			t.Errorf("ParseSchema(%q) returned %v", tc.schema, err)
+			continue
+		}
+		if s.String() != tc.want {
+			t.Errorf("ParseSchema(%q) = %s, want %s", tc.schema, s, tc.want)
+		}
+	}
+}
+
+func TestParseSchemaErrors(t *testing.T) {
+	for _, tc := range []struct {
+		schema string
+		err    string
+	}{
+		{"", `obi: invalid schema at offset 0: unknown type ""`},
+		{"u128", `obi: invalid schema at offset 4: unknown type "u128"`},
+		{"[u8", `obi: invalid schema at offset 3: expect ']'`},
+		{"[u8;]", `obi: invalid schema at offset 4: expect array length`},
+		{"[u8;x]", `obi: invalid schema at offset 4: expect array length`},
+		{"{}", `obi: invalid schema at offset 1: expect field name`},
+		{"{a;u8}", `obi: invalid schema at offset 2: expect ':'`},
+		{"{a:u8;b:u8}", `obi: invalid schema at offset 5: expect ','`},
+		{"{a:u8,a:u16}", `obi: invalid schema at offset 7: duplicate field "a"`},
+		{"option<u8", `obi: invalid schema at offset 9: expect '>'`},
+		{"map<u8>", `obi: invalid schema at offset 6: expect ','`},
+		{"u8u8", `obi: invalid schema at offset 4: unknown type "u8u8"`},
+		{"u8}", `obi: invalid schema at offset 2: unexpected trailing input`},
+	} {
+		_, err := ParseSchema(tc.schema)
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("ParseSchema(%q) returned %v, want %s", tc.schema, err, tc.err)
+		}
+	}
+
+	for _, schema := range []string{"{a:u8}", "{a:u8}/{b:u8}/{c:u8}", "{a:u8}/{b:u8"} {
+		_, _, err := ParseOracleScriptSchema(schema)
+		if err == nil {
+			t.Errorf("ParseOracleScriptSchema(%q) returned no error", schema)
+		}
+	}
+}
+
+// skipped has fields tagged `obi:"-"` that are left out of its schema and encoding.
+type skipped struct {
+	Symbol string `obi:"symbol"`
+	Cached []byte `obi:"-"`
+	cache  int    `obi:"-"`
+	Px     uint64 `obi:"px"`
+}
+
+func TestSkippedFields(t *testing.T) {
+	value := skipped{Symbol: "LUNA", Cached: []byte{1}, cache: 1, Px: 5}
+	schema, err := GetSchema(value)
+	if err != nil || schema != "{symbol:string,px:u64}" {
+		t.Errorf("GetSchema = %s, %v, want {symbol:string,px:u64}", schema, err)
+	}
+	bz, err := Encode(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := MustEncode("LUNA", uint64(5)); !bytes.Equal(bz, want) {
+		t.Errorf("Encode = %x, want %x", bz, want)
+	}
+
+	decoded := skipped{Cached: []byte{2}, cache: 2}
+	err = Decode(bz, &decoded)
+	if err != nil || decoded.Symbol != "LUNA" || decoded.Px != 5 || !bytes.Equal(decoded.Cached, []byte{2}) || decoded.cache != 2 {
+		t.Errorf("Decode = %+v, %v, want the skipped fields kept", decoded, err)
+	}
+	err = CheckSchema(value, "{px:u64,symbol:string}")
+	if err != nil {
+		t.Errorf("CheckSchema returned %v", err)
+	}
+}
+
+type untagged struct {
+	Symbol string
+}
+
+type duplicateTag struct {
+	A uint8 `obi:"a"`
+	B uint8 `obi:"a"`
+}
+
+type taggedUnexported struct {
+	a uint8 `obi:"a"`
+}
+
+type untaggedUnexported struct {
+	a uint8
+}
+
+type price struct {
+	Symbol string `obi:"symbol"`
+	Px     uint32 `obi:"px"`
+}
+
+func TestTagErrors(t *testing.T) {
+	for _, tc := range []struct {
+		v      interface{}
+		schema string
+		err    string
+	}{
+		{untagged{}, "", "obi: no obi tag found for field Symbol of untagged"},
+		{duplicateTag{}, "", "obi: more than one field of duplicateTag is tagged a"},
+		{taggedUnexported{}, "", "obi: unexported field a of taggedUnexported cannot be tagged"},
+		{untaggedUnexported{}, "", "obi: unexported field a of untaggedUnexported must be tagged with `obi:\"-\"`"},
+		{price{}, "{symbol:string,price:u32}", "obi: no field of price is tagged price"},
+		{price{}, "{symbol:string}", "obi: obi.price has 2 fields but {symbol:string} has 1"},
+		{price{}, "{symbol:string,px:u64}", "obi: field px of price: uint32 does not match u64"},
+		{price{}, "[u32]", "obi: obi.price does not match [u32]"},
+	} {
+		var err error
+		if tc.schema == "" {
+			_, err = GetSchema(tc.v)
+		} else {
+			err = CheckSchema(tc.v, tc.schema)
+		}
+		if err == nil || err.Error() != tc.err {
+			t.Errorf("%T with schema %q returned %v, want %s", tc.v, tc.schema, err, tc.err)
+		}
+	}
+
+	// Encoding and decoding with a schema fail the same way.
+	_, err := EncodeWithSchema("{symbol:string,price:u32}", price{})
+	if err == nil || !strings.Contains(err.Error(), "no field of price is tagged price") {
+		t.Errorf("EncodeWithSchema returned %v", err)
+	}
+	var p price
+	err = DecodeWithSchema("{symbol:string,px:u64}", MustEncode("LUNA", uint64(5)), &p)
+	if err == nil || !strings.Contains(err.Error(), "uint32 does not match u64") {
+		t.Errorf("DecodeWithSchema returned %v", err)
+	}
+}
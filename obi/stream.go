@@ -0,0 +1,101 @@
+package obi
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+)
+
+// Encoder writes OBI encoded values to an io.Writer, reusing its buffer between values.
+type Encoder struct {
+	w   io.Writer
+	buf []byte
+}
+
+// NewEncoder returns an Encoder writing to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func (e *Encoder) write(rv reflect.Value, schema *Schema) error {
+	bz, err := appendImpl(e.buf[:0], rv, schema)
+	if err != nil {
+		return err
+	}
+	e.buf = bz
+	_, err = e.w.Write(bz)
+	return err
+}
+
+// Encode writes the OBI encoding of the given input(s) like Encode.
+func (e *Encoder) Encode(v ...interface{}) error {
+	for _, each := range v {
+		err := e.write(reflect.ValueOf(each), nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeWithSchema writes the OBI encoding of the given input laid out as the schema like EncodeWithSchema.
+func (e *Encoder) EncodeWithSchema(schema string, v interface{}) error {
+	s, err := ParseSchema(schema)
+	if err != nil {
+		return err
+	}
+	err = checkSchemaImpl(reflect.TypeOf(v), s)
+	if err != nil {
+		return err
+	}
+	return e.write(reflect.ValueOf(v), s)
+}
+
+// Decoder reads OBI encoded values from an io.Reader. It buffers the reader, so it may read data
+// beyond the values it decodes. Types implementing Unmarshaler must also implement Schemer to be
+// decoded from a Decoder.
+type Decoder struct {
+	d *decodeState
+}
+
+// NewDecoder returns a Decoder reading from r with the current DefaultLimits.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{d: &decodeState{r: bufio.NewReader(r), limits: DefaultLimits}}
+}
+
+// SetLimits sets the limits of the lengths the Decoder accepts.
+func (dec *Decoder) SetLimits(limits Limits) {
+	dec.d.limits = limits
+}
+
+// Offset returns the number of bytes decoded so far, which is where a DecodeError is located.
+func (dec *Decoder) Offset() int {
+	return dec.d.offset
+}
+
+// Decode reads the next value(s) like Decode. Reaching the end of the reader before a value
+// starts returns io.EOF.
+func (dec *Decoder) Decode(v ...interface{}) error {
+	for _, each := range v {
+		if _, err := dec.d.r.Peek(1); err == io.EOF {
+			return io.EOF
+		}
+		err := dec.d.decodePtr(each, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeWithSchema reads the next value laid out as the schema like DecodeWithSchema.
+func (dec *Decoder) DecodeWithSchema(schema string, v interface{}) error {
+	s, err := checkedPtr(schema, v)
+	if err != nil {
+		return err
+	}
+	if _, err := dec.d.r.Peek(1); err == io.EOF {
+		return io.EOF
+	}
+	return dec.d.decodePtr(v, s)
+}
@@ -0,0 +1,194 @@
+package obi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/big"
+	"reflect"
+	"testing"
+)
+
+type streamValue struct {
+	Flag   bool
+	Small  uint8
+	Signed int16
+	Big    int64
+	Name   string
+	Raw    []byte
+	List   []uint32
+	Fixed  [2]int8
+	Note   *string
+	Table  map[string]uint16
+	Price  BigInt
+}
+
+func streamValues() []streamValue {
+	note := "note"
+	return []streamValue{
+		{
+			Flag:   true,
+			Small:  7,
+			Signed: -300,
+			Big:    -1 << 40,
+			Name:   "luna",
+			Raw:    []byte{0xde, 0xad},
+			List:   []uint32{1, 2, 3},
+			Fixed:  [2]int8{-1, 1},
+			Note:   &note,
+			Table:  map[string]uint16{"a": 1, "b": 2},
+			Price:  BigInt{big.NewInt(-42)},
+		},
+		{
+			Name:  "",
+			Raw:   []byte{},
+			List:  []uint32{},
+			Table: map[string]uint16{},
+			Price: BigInt{big.NewInt(0)},
+		},
+	}
+}
+
+func TestEncoderMatchesEncode(t *testing.T) {
+	values := streamValues()
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	want := []byte{}
+	for _, value := range values {
+		err := enc.Encode(value)
+		if err != nil {
+			t.Fatalf("Encoder.Encode returned %v", err)
+		}
+		want = append(want, MustEncode(value)...)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("Encoder wrote %x, want %x", buf.Bytes(), want)
+	}
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	values := streamValues()
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	for _, value := range values {
+		err := enc.Encode(value)
+		if err != nil {
+			t.Fatalf("Encoder.Encode returned %v", err)
+		}
+	}
+
+	dec := NewDecoder(bytes.NewReader(buf.Bytes()))
+	offset := 0
+	for idx, want := range values {
+		var got streamValue
+		err := dec.Decode(&got)
+		if err != nil {
+			t.Fatalf("Decoder.Decode of value %d returned %v", idx, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Decoder.Decode of value %d = %+v, want %+v", idx, got, want)
+		}
+
+		var fromSlice streamValue
+		err = Decode(MustEncode(want), &fromSlice)
+		if err != nil {
+			t.Fatalf("Decode of value %d returned %v", idx, err)
+		}
+		if !reflect.DeepEqual(got, fromSlice) {
+			t.Errorf("Decoder decoded %+v but Decode decoded %+v", got, fromSlice)
+		}
+
+		offset += len(MustEncode(want))
+		if dec.Offset() != offset {
+			t.Errorf("Decoder.Offset() = %d after value %d, want %d", dec.Offset(), idx, offset)
+		}
+	}
+
+	var extra streamValue
+	if err := dec.Decode(&extra); err != io.EOF {
+		t.Errorf("Decoder.Decode at the end returned %v, want io.EOF", err)
+	}
+}
+
+func TestDecoderWithSchemaRoundTrip(t *testing.T) {
+	type tagged struct {
+		Symbols    []string `obi:"symbols"`
+		Multiplier uint64   `obi:"multiplier"`
+	}
+	schema := "{multiplier:u64,symbols:[string]}"
+	want := tagged{Symbols: []string{"KRW", "MNT"}, Multiplier: 1000000}
+
+	buf := &bytes.Buffer{}
+	err := NewEncoder(buf).EncodeWithSchema(schema, want)
+	if err != nil {
+		t.Fatalf("Encoder.EncodeWithSchema returned %v", err)
+	}
+	bz, err := EncodeWithSchema(schema, want)
+	if err != nil {
+		t.Fatalf("EncodeWithSchema returned %v", err)
+	}
+	if !bytes.Equal(buf.Bytes(), bz) {
+		t.Errorf("Encoder wrote %x, want %x", buf.Bytes(), bz)
+	}
+
+	var got tagged
+	err = NewDecoder(buf).DecodeWithSchema(schema, &got)
+	if err != nil {
+		t.Fatalf("Decoder.DecodeWithSchema returned %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Decoder.DecodeWithSchema = %+v, want %+v", got, want)
+	}
+}
+
+// TestTruncatedInput checks that every prefix of a valid encoding fails to decode at the same
+// place whether it is decoded from a byte slice or from a reader.
+func TestTruncatedInput(t *testing.T) {
+	bz := MustEncode(streamValues()[0])
+	for size := 1; size < len(bz); size++ {
+		data := bz[:size]
+
+		var fromSlice streamValue
+		sliceErr := Decode(data, &fromSlice)
+		var sliceDE *DecodeError
+		if !errors.As(sliceErr, &sliceDE) {
+			t.Fatalf("Decode of %d bytes returned %v, want a DecodeError", size, sliceErr)
+		}
+
+		var fromReader streamValue
+		readerErr := NewDecoder(bytes.NewReader(data)).Decode(&fromReader)
+		var readerDE *DecodeError
+		if !errors.As(readerErr, &readerDE) {
+			t.Fatalf("Decoder.Decode of %d bytes returned %v, want a DecodeError", size, readerErr)
+		}
+
+		if sliceDE.Offset != readerDE.Offset || sliceDE.Path != readerDE.Path || sliceDE.Expected != readerDE.Expected {
+			t.Errorf("%d bytes fail at offset %d %s (%s) from a slice but at offset %d %s (%s) from a reader",
+				size, sliceDE.Offset, sliceDE.Path, sliceDE.Expected, readerDE.Offset, readerDE.Path, readerDE.Expected)
+		}
+		if sliceDE.Offset > size {
+			t.Errorf("%d bytes fail at offset %d beyond the data", size, sliceDE.Offset)
+		}
+		if sliceDE.Remaining != size-sliceDE.Offset {
+			t.Errorf("%d bytes fail at offset %d with %d bytes left", size, sliceDE.Offset, sliceDE.Remaining)
+		}
+		if readerDE.Remaining != -1 {
+			t.Errorf("Decoder.Decode reported %d bytes left, want -1", readerDE.Remaining)
+		}
+	}
+}
+
+func TestTrailingData(t *testing.T) {
+	bz := append(MustEncode(uint16(1)), 0xff)
+	var v uint16
+	err := Decode(bz, &v)
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Err != ErrTrailingData || de.Offset != 2 || de.Remaining != 1 {
+		t.Errorf("Decode with a trailing byte returned %v", err)
+	}
+
+	rem, err := DecodeLenient(bz, &v)
+	if err != nil || v != 1 || !bytes.Equal(rem, []byte{0xff}) {
+		t.Errorf("DecodeLenient returned %d, %x, %v", v, rem, err)
+	}
+}
@@ -0,0 +1,48 @@
+#!/usr/bin/env python3
+"""Checks the golden vectors of golden.json against pyobi, Band's reference OBI encoder.
+
+Every vector whose reference is "pyobi" is encoded with pyobi from its schema and value. The
+vectors of this package's schema extensions (bool, [T;N], option<T> and map<K,V>) have no
+reference and are skipped.
+
+    pip install pyobi
+    python3 gen_golden.py          # report vectors whose hex differs from pyobi
+    python3 gen_golden.py --write  # replace their hex with the bytes of pyobi
+"""
+
+import json
+import os
+import sys
+
+from pyobi import PyObi
+
+PATH = os.path.join(os.path.dirname(os.path.abspath(__file__)), "golden.json")
+
+
+def main():
+    write = sys.argv[1:] == ["--write"]
+    with open(PATH) as f:
+        text = f.read()
+    vectors = json.loads(text)
+
+    mismatches = 0
+    for vector in vectors:
+        if vector["reference"] != "pyobi":
+            continue
+        # PyObi takes an oracle script schema, so the schema is used as both input and output.
+        want = PyObi(vector["schema"] + "/" + vector["schema"]).encode_input(vector["value"]).hex()
+        if vector["hex"] == want:
+            continue
+        mismatches += 1
+        print("%s: golden.json has %s but pyobi encodes %s" % (vector["name"], vector["hex"], want))
+        text = text.replace('"hex": "%s"' % vector["hex"], '"hex": "%s"' % want, 1)
+
+    if write and mismatches:
+        with open(PATH, "w") as f:
+            f.write(text)
+    elif mismatches:
+        sys.exit(1)
+
+
+if __name__ == "__main__":
+    main()
@@ -0,0 +1,402 @@
+package obi
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+)
+
+// MapEntry is an entry of a map decoded by DecodeValue.
+type MapEntry struct {
+	Key   interface{}
+	Value interface{}
+}
+
+// mapEntries converts the generic forms of a map into its entries.
+func mapEntries(v interface{}) ([]MapEntry, error) {
+	switch x := v.(type) {
+	case []MapEntry:
+		return x, nil
+	case map[string]interface{}:
+		entries := []MapEntry{}
+		for key, value := range x {
+			entries = append(entries, MapEntry{Key: key, Value: value})
+		}
+		return entries, nil
+	case []interface{}:
+		entries := []MapEntry{}
+		for _, each := range x {
+			pair, ok := each.([]interface{})
+			if !ok || len(pair) != 2 {
+				return nil, fmt.Errorf("obi: map entry must be a [key, value] pair but got %v", each)
+			}
+			entries = append(entries, MapEntry{Key: pair[0], Value: pair[1]})
+		}
+		return entries, nil
+	default:
+		return nil, fmt.Errorf("obi: expect map entries but got %T", v)
+	}
+}
+
+var integerRanges = map[Kind][2]*big.Int{
+	KindU8:  {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint8)},
+	KindU16: {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint16)},
+	KindU32: {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint32)},
+	KindU64: {big.NewInt(0), new(big.Int).SetUint64(math.MaxUint64)},
+	KindI8:  {big.NewInt(math.MinInt8), big.NewInt(math.MaxInt8)},
+	KindI16: {big.NewInt(math.MinInt16), big.NewInt(math.MaxInt16)},
+	KindI32: {big.NewInt(math.MinInt32), big.NewInt(math.MaxInt32)},
+	KindI64: {big.NewInt(math.MinInt64), big.NewInt(math.MaxInt64)},
+}
+
+// toBigInt converts any Go integer, an integral float64, a json.Number or a decimal string into a big.Int.
+func toBigInt(v interface{}) (*big.Int, error) {
+	switch x := v.(type) {
+	case int:
+		return big.NewInt(int64(x)), nil
+	case int8:
+		return big.NewInt(int64(x)), nil
+	case int16:
+		return big.NewInt(int64(x)), nil
+	case int32:
+		return big.NewInt(int64(x)), nil
+	case int64:
+		return big.NewInt(x), nil
+	case uint:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint8:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint16:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint32:
+		return new(big.Int).SetUint64(uint64(x)), nil
+	case uint64:
+		return new(big.Int).SetUint64(x), nil
+	case float64:
+		if x != math.Trunc(x) {
+			return nil, fmt.Errorf("obi: %v is not an integer", x)
+		}
+		n, _ := big.NewFloat(x).Int(nil)
+		return n, nil
+	case json.Number:
+		return toBigInt(string(x))
+	case string:
+		n, ok := new(big.Int).SetString(x, 10)
+		if !ok {
+			return nil, fmt.Errorf("obi: %q is not an integer", x)
+		}
+		return n, nil
+	default:
+		return nil, fmt.Errorf("obi: %T is not an integer", v)
+	}
+}
+
+func encodeInteger(kind Kind, v interface{}) ([]byte, error) {
+	n, err := toBigInt(v)
+	if err != nil {
+		return nil, err
+	}
+	bounds := integerRanges[kind]
+	if n.Cmp(bounds[0]) < 0 || n.Cmp(bounds[1]) > 0 {
+		return nil, fmt.Errorf("obi: %s is out of range of %s", n, (&Schema{Kind: kind}).String())
+	}
+	switch kind {
+	case KindU8:
+		return EncodeUnsigned8(uint8(n.Uint64())), nil
+	case KindU16:
+		return EncodeUnsigned16(uint16(n.Uint64())), nil
+	case KindU32:
+		return EncodeUnsigned32(uint32(n.Uint64())), nil
+	case KindU64:
+		return EncodeUnsigned64(n.Uint64()), nil
+	case KindI8:
+		return EncodeSigned8(int8(n.Int64())), nil
+	case KindI16:
+		return EncodeSigned16(int16(n.Int64())), nil
+	case KindI32:
+		return EncodeSigned32(int32(n.Int64())), nil
+	default:
+		return EncodeSigned64(n.Int64()), nil
+	}
+}
+
+func encodeValueImpl(schema *Schema, v interface{}) ([]byte, error) {
+	switch schema.Kind {
+	case KindU8, KindU16, KindU32, KindU64, KindI8, KindI16, KindI32, KindI64:
+		return encodeInteger(schema.Kind, v)
+	case KindString:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("obi: expect string but got %T", v)
+		}
+		return EncodeString(s), nil
+	case KindBool:
+		b, ok := v.(bool)
+		if !ok {
+			return nil, fmt.Errorf("obi: expect bool but got %T", v)
+		}
+		return EncodeBool(b), nil
+	case KindArray:
+		elems, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("obi: expect []interface{} but got %T", v)
+		}
+		if len(elems) != schema.Len {
+			return nil, fmt.Errorf("obi: expect %d elements but got %d", schema.Len, len(elems))
+		}
+		res := []byte{}
+		for _, elem := range elems {
+			each, err := encodeValueImpl(schema.Elem, elem)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, each...)
+		}
+		return res, nil
+	case KindOption:
+		if v == nil {
+			return EncodeBool(false), nil
+		}
+		each, err := encodeValueImpl(schema.Elem, v)
+		if err != nil {
+			return nil, err
+		}
+		return append(EncodeBool(true), each...), nil
+	case KindMap:
+		entries, err := mapEntries(v)
+		if err != nil {
+			return nil, err
+		}
+		encoded := []EncodedEntry{}
+		for _, entry := range entries {
+			key, err := encodeValueImpl(schema.Key, entry.Key)
+			if err != nil {
+				return nil, err
+			}
+			value, err := encodeValueImpl(schema.Elem, entry.Value)
+			if err != nil {
+				return nil, err
+			}
+			encoded = append(encoded, EncodedEntry{Key: key, Value: value})
+		}
+		return encodeEntries(encoded)
+	case KindBytes:
+		switch x := v.(type) {
+		case []byte:
+			return EncodeBytes(x), nil
+		case string:
+			bz, err := hex.DecodeString(strings.TrimPrefix(x, "0x"))
+			if err != nil {
+				return nil, fmt.Errorf("obi: bytes must be hex encoded, %v", err)
+			}
+			return EncodeBytes(bz), nil
+		default:
+			return nil, fmt.Errorf("obi: expect bytes but got %T", v)
+		}
+	case KindVector:
+		elems, ok := v.([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("obi: expect []interface{} but got %T", v)
+		}
+		res := EncodeUnsigned32(uint32(len(elems)))
+		for _, elem := range elems {
+			each, err := encodeValueImpl(schema.Elem, elem)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, each...)
+		}
+		return res, nil
+	case KindStruct:
+		fields, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("obi: expect map[string]interface{} but got %T", v)
+		}
+		if len(fields) != len(schema.Fields) {
+			return nil, fmt.Errorf("obi: expect %d fields but got %d", len(schema.Fields), len(fields))
+		}
+		res := []byte{}
+		for _, field := range schema.Fields {
+			fv, ok := fields[field.Name]
+			if !ok {
+				return nil, fmt.Errorf("obi: missing field %s", field.Name)
+			}
+			each, err := encodeValueImpl(field.Type, fv)
+			if err != nil {
+				return nil, err
+			}
+			res = append(res, each...)
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("obi: unsupported schema kind: %d", schema.Kind)
+	}
+}
+
+// EncodeValue encodes a generic value according to the schema. Structs are given as
+// map[string]interface{}, vectors and arrays as []interface{}, bytes as []byte or a hex string and
+// integers as any Go integer, an integral float64, a json.Number or a decimal string. Absent options
+// are nil, and maps are []MapEntry, [key, value] pairs or map[string]interface{}.
+func EncodeValue(schema *Schema, v interface{}) ([]byte, error) {
+	return encodeValueImpl(schema, v)
+}
+
+// decodeEntryKey decodes a map key with the given function and checks that its encoded bytes
+// come strictly after those of the previous key.
+func decodeEntryKey(data []byte, prev []byte, decode func([]byte) ([]byte, error)) ([]byte, []byte, error) {
+	rem, err := decode(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	key := data[:len(data)-len(rem)]
+	if prev != nil && bytes.Compare(prev, key) >= 0 {
+		return nil, nil, &DecodeError{Expected: "map key", Remaining: len(data), Err: ErrUnsortedMapKeys}
+	}
+	return key, rem, nil
+}
+
+// decodeValueImpl decodes a value of the schema nested at the given depth.
+func decodeValueImpl(schema *Schema, data []byte, depth int) (interface{}, []byte, error) {
+	err := checkDepth(depth, DefaultLimits.MaxDepth)
+	if err != nil {
+		return nil, nil, decodeErrorAt(data, schema.String, err)
+	}
+	v, rem, err := decodeValueKind(schema, data, depth)
+	if err != nil {
+		return nil, nil, decodeErrorAt(data, schema.String, err)
+	}
+	return v, rem, nil
+}
+
+func decodeValueKind(schema *Schema, data []byte, depth int) (interface{}, []byte, error) {
+	switch schema.Kind {
+	case KindU8:
+		val, rem, err := DecodeUnsigned8(data)
+		return val, rem, err
+	case KindU16:
+		val, rem, err := DecodeUnsigned16(data)
+		return val, rem, err
+	case KindU32:
+		val, rem, err := DecodeUnsigned32(data)
+		return val, rem, err
+	case KindU64:
+		val, rem, err := DecodeUnsigned64(data)
+		return val, rem, err
+	case KindI8:
+		val, rem, err := DecodeSigned8(data)
+		return val, rem, err
+	case KindI16:
+		val, rem, err := DecodeSigned16(data)
+		return val, rem, err
+	case KindI32:
+		val, rem, err := DecodeSigned32(data)
+		return val, rem, err
+	case KindI64:
+		val, rem, err := DecodeSigned64(data)
+		return val, rem, err
+	case KindString:
+		val, rem, err := DecodeString(data)
+		return val, rem, err
+	case KindBytes:
+		val, rem, err := DecodeBytes(data)
+		return val, rem, err
+	case KindBool:
+		val, rem, err := DecodeBool(data)
+		return val, rem, err
+	case KindArray:
+		rem := data
+		elems := []interface{}{}
+		for idx := 0; idx < schema.Len; idx++ {
+			var elem interface{}
+			var err error
+			elem, rem, err = decodeValueImpl(schema.Elem, rem, depth+1)
+			if err != nil {
+				return nil, nil, withPath(err, fmt.Sprintf("[%d]", idx))
+			}
+			elems = append(elems, elem)
+		}
+		return elems, rem, nil
+	case KindOption:
+		present, rem, err := DecodeBool(data)
+		if err != nil || !present {
+			return nil, rem, err
+		}
+		return decodeValueImpl(schema.Elem, rem, depth+1)
+	case KindMap:
+		length, rem, err := DecodeLength(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		entries := []MapEntry{}
+		var prev []byte
+		for idx := 0; idx < length; idx++ {
+			var entry MapEntry
+			prev, rem, err = decodeEntryKey(rem, prev, func(data []byte) ([]byte, error) {
+				var rem []byte
+				var err error
+				entry.Key, rem, err = decodeValueImpl(schema.Key, data, depth+1)
+				return rem, err
+			})
+			if err != nil {
+				return nil, nil, withPath(err, fmt.Sprintf("[key %d]", idx))
+			}
+			entry.Value, rem, err = decodeValueImpl(schema.Elem, rem, depth+1)
+			if err != nil {
+				return nil, nil, withPath(err, fmt.Sprintf("[%v]", entry.Key))
+			}
+			entries = append(entries, entry)
+		}
+		return entries, rem, nil
+	case KindVector:
+		length, rem, err := DecodeLength(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		elems := []interface{}{}
+		for idx := 0; idx < length; idx++ {
+			var elem interface{}
+			elem, rem, err = decodeValueImpl(schema.Elem, rem, depth+1)
+			if err != nil {
+				return nil, nil, withPath(err, fmt.Sprintf("[%d]", idx))
+			}
+			elems = append(elems, elem)
+		}
+		return elems, rem, nil
+	case KindStruct:
+		rem := data
+		fields := map[string]interface{}{}
+		for _, field := range schema.Fields {
+			var fv interface{}
+			var err error
+			fv, rem, err = decodeValueImpl(field.Type, rem, depth+1)
+			if err != nil {
+				return nil, nil, withPath(err, "."+field.Name)
+			}
+			fields[field.Name] = fv
+		}
+		return fields, rem, nil
+	default:
+		return nil, nil, fmt.Errorf("obi: unsupported schema kind: %d", schema.Kind)
+	}
+}
+
+// DecodeValue decodes the data into a generic value according to the schema. Structs are
+// returned as map[string]interface{}, vectors and arrays as []interface{}, bytes as []byte and
+// integers as the Go integer type of the same size. Absent options are nil, and maps are
+// []MapEntry in encoding order. A present option holding an absent option is also nil, so it is
+// encoded back as absent by EncodeValue.
+func DecodeValue(schema *Schema, data []byte) (interface{}, error) {
+	v, rem, err := decodeValueImpl(schema, data, 1)
+	if err != nil {
+		return nil, locate(err, len(data))
+	}
+	err = trailingError(len(data), rem)
+	if err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,327 @@
+// Package terramock is an in-process stand-in for a Terra node. Node implements the parts of the
+// Tendermint RPC client the feeder uses (status, abci_query and broadcast_tx) on top of a
+// simulated auth and oracle module, so a whole prevote and vote cycle can run without terrad.
+package terramock
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cosmos/cosmos-sdk/codec"
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	auth_types "github.com/cosmos/cosmos-sdk/x/auth/types"
+	abci "github.com/tendermint/tendermint/abci/types"
+	"github.com/tendermint/tendermint/libs/bytes"
+	"github.com/tendermint/tendermint/libs/service"
+	rpcclient "github.com/tendermint/tendermint/rpc/client"
+	ctypes "github.com/tendermint/tendermint/rpc/core/types"
+	"github.com/tendermint/tendermint/types"
+	"github.com/terra-project/core/app"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// Node is a simulated Terra node. Every broadcast transaction is executed in a new block, and
+// AdvanceBlocks moves the chain forward in between. RPC methods the feeder does not use are
+// left unimplemented and panic when called.
+type Node struct {
+	*service.BaseService
+	rpcclient.EventsClient
+	rpcclient.HistoryClient
+	rpcclient.NetworkClient
+	rpcclient.SignClient
+	rpcclient.EvidenceClient
+	rpcclient.MempoolClient
+
+	mtx      sync.Mutex
+	cdc      *codec.Codec
+	chainID  string
+	height   int64
+	accounts map[string]*auth_types.BaseAccount
+	oracle   *oracle
+	txs      []TxResult
+}
+
+var _ rpcclient.Client = &Node{}
+
+// TxResult is a transaction broadcast to the node and the outcome of executing it.
+type TxResult struct {
+	Height int64
+	Msgs   []sdk.Msg
+	Code   uint32
+	Log    string
+}
+
+// NewNode returns a node of the given chain at height 1 with the default oracle params.
+func NewNode(chainID string) *Node {
+	node := &Node{
+		cdc:      app.MakeCodec(),
+		chainID:  chainID,
+		height:   1,
+		accounts: map[string]*auth_types.BaseAccount{},
+		oracle:   newOracle(terra_types.DefaultParams()),
+	}
+	node.BaseService = service.NewBaseService(nil, "TerraMock", node)
+	return node
+}
+
+// SetParams replaces the params of the oracle module.
+func (n *Node) SetParams(params terra_types.Params) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.oracle.params = params
+}
+
+// AddAccount creates an account for the address if it does not exist yet.
+func (n *Node) AddAccount(addr sdk.AccAddress) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.addAccount(addr)
+}
+
+func (n *Node) addAccount(addr sdk.AccAddress) {
+	if _, ok := n.accounts[addr.String()]; ok {
+		return
+	}
+	acc := auth_types.NewBaseAccountWithAddress(addr)
+	acc.AccountNumber = uint64(len(n.accounts))
+	n.accounts[addr.String()] = &acc
+}
+
+// AddValidator registers a bonded validator along with the account of its operator.
+func (n *Node) AddValidator(val sdk.ValAddress) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.addAccount(sdk.AccAddress(val))
+	n.oracle.validators[val.String()] = true
+}
+
+// DelegateFeeder lets the feeder account submit prevotes and votes on behalf of the validator.
+func (n *Node) DelegateFeeder(val sdk.ValAddress, feeder sdk.AccAddress) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	n.addAccount(feeder)
+	n.oracle.delegates[val.String()] = feeder
+}
+
+// Height returns the latest block height.
+func (n *Node) Height() int64 {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.height
+}
+
+// AdvanceBlocks produces count empty blocks, tallying the oracle at the end of each vote period.
+func (n *Node) AdvanceBlocks(count int64) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	for i := int64(0); i < count; i++ {
+		n.nextBlock()
+	}
+}
+
+func (n *Node) nextBlock() {
+	n.oracle.endBlock(n.height)
+	n.height++
+}
+
+// Prevotes returns the prevotes currently in the store.
+func (n *Node) Prevotes() terra_types.ExchangeRatePrevotes {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.oracle.queryPrevotes(nil, "")
+}
+
+// Votes returns the votes revealed in the current vote period.
+func (n *Node) Votes() terra_types.ExchangeRateVotes {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.oracle.queryVotes(nil, "")
+}
+
+// Tallies returns the votes of every past vote period that had any, keyed by the last block of the period.
+func (n *Node) Tallies() map[int64]terra_types.ExchangeRateVotes {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	tallies := map[int64]terra_types.ExchangeRateVotes{}
+	for height, votes := range n.oracle.tallies {
+		tallies[height] = append(terra_types.ExchangeRateVotes{}, votes...)
+	}
+	return tallies
+}
+
+// MissCounter returns the vote periods the validator missed in the current slash window.
+func (n *Node) MissCounter(val sdk.ValAddress) int64 {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return n.oracle.missCounters[val.String()]
+}
+
+// Txs returns all transactions broadcast to the node in order.
+func (n *Node) Txs() []TxResult {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return append([]TxResult{}, n.txs...)
+}
+
+func (n *Node) Status() (*ctypes.ResultStatus, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	status := &ctypes.ResultStatus{}
+	status.NodeInfo.Network = n.chainID
+	status.SyncInfo.LatestBlockHeight = n.height
+	status.SyncInfo.LatestBlockTime = time.Now()
+	return status, nil
+}
+
+func (n *Node) ABCIInfo() (*ctypes.ResultABCIInfo, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	return &ctypes.ResultABCIInfo{Response: abci.ResponseInfo{Data: "terra", LastBlockHeight: n.height}}, nil
+}
+
+func (n *Node) ABCIQuery(path string, data bytes.HexBytes) (*ctypes.ResultABCIQuery, error) {
+	return n.ABCIQueryWithOptions(path, data, rpcclient.DefaultABCIQueryOptions)
+}
+
+func (n *Node) ABCIQueryWithOptions(path string, data bytes.HexBytes, opts rpcclient.ABCIQueryOptions) (*ctypes.ResultABCIQuery, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	res := abci.ResponseQuery{Height: n.height}
+	value, err := n.query(path, data)
+	if err != nil {
+		res.Codespace, res.Code, res.Log = sdkerrors.ABCIInfo(err, false)
+	} else {
+		res.Value = value
+	}
+	return &ctypes.ResultABCIQuery{Response: res}, nil
+}
+
+func (n *Node) query(path string, data []byte) ([]byte, error) {
+	switch strings.TrimPrefix(path, "/") {
+	case fmt.Sprintf("custom/%s/%s", auth_types.QuerierRoute, auth_types.QueryAccount):
+		var params auth_types.QueryAccountParams
+		if err := auth_types.ModuleCdc.UnmarshalJSON(data, &params); err != nil {
+			return nil, sdkerrors.Wrap(sdkerrors.ErrJSONUnmarshal, err.Error())
+		}
+		acc, ok := n.accounts[params.Address.String()]
+		if !ok {
+			return nil, sdkerrors.Wrapf(sdkerrors.ErrUnknownAddress, "account %s does not exist", params.Address)
+		}
+		return codec.MarshalJSONIndent(auth_types.ModuleCdc, acc)
+	case fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryParameters):
+		return codec.MarshalJSONIndent(n.cdc, n.oracle.params)
+	case fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryPrevotes):
+		var params terra_types.QueryPrevotesParams
+		if err := n.cdc.UnmarshalJSON(data, &params); err != nil {
+			return nil, sdkerrors.Wrap(sdkerrors.ErrJSONUnmarshal, err.Error())
+		}
+		return codec.MarshalJSONIndent(n.cdc, n.oracle.queryPrevotes(params.Voter, params.Denom))
+	case fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryVotes):
+		var params terra_types.QueryVotesParams
+		if err := n.cdc.UnmarshalJSON(data, &params); err != nil {
+			return nil, sdkerrors.Wrap(sdkerrors.ErrJSONUnmarshal, err.Error())
+		}
+		return codec.MarshalJSONIndent(n.cdc, n.oracle.queryVotes(params.Voter, params.Denom))
+	case fmt.Sprintf("custom/%s/%s", terra_types.QuerierRoute, terra_types.QueryMissCounter):
+		var params terra_types.QueryMissCounterParams
+		if err := n.cdc.UnmarshalJSON(data, &params); err != nil {
+			return nil, sdkerrors.Wrap(sdkerrors.ErrJSONUnmarshal, err.Error())
+		}
+		return codec.MarshalJSONIndent(n.cdc, n.oracle.missCounters[params.Validator.String()])
+	default:
+		return nil, sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "unknown query path %s", path)
+	}
+}
+
+// BroadcastTxCommit executes the transaction in a new block, like a node does in block mode.
+func (n *Node) BroadcastTxCommit(tx types.Tx) (*ctypes.ResultBroadcastTxCommit, error) {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+	res := &ctypes.ResultBroadcastTxCommit{Hash: tx.Hash()}
+	stdTx, err := n.checkTx(tx)
+	if err != nil {
+		res.CheckTx.Codespace, res.CheckTx.Code, res.CheckTx.Log = sdkerrors.ABCIInfo(err, false)
+		return res, nil
+	}
+	n.nextBlock()
+	res.Height = n.height
+	res.DeliverTx = n.deliverTx(stdTx)
+	return res, nil
+}
+
+// BroadcastTxSync executes the transaction in a new block and only reports the result of checking it.
+func (n *Node) BroadcastTxSync(tx types.Tx) (*ctypes.ResultBroadcastTx, error) {
+	res, err := n.BroadcastTxCommit(tx)
+	if err != nil {
+		return nil, err
+	}
+	return &ctypes.ResultBroadcastTx{
+		Code:      res.CheckTx.Code,
+		Codespace: res.CheckTx.Codespace,
+		Log:       res.CheckTx.Log,
+		Hash:      res.Hash,
+	}, nil
+}
+
+func (n *Node) BroadcastTxAsync(tx types.Tx) (*ctypes.ResultBroadcastTx, error) {
+	return n.BroadcastTxSync(tx)
+}
+
+// checkTx decodes the transaction and verifies its signatures and account sequences.
+func (n *Node) checkTx(tx types.Tx) (auth_types.StdTx, error) {
+	decoded, err := auth_types.DefaultTxDecoder(n.cdc)(tx)
+	if err != nil {
+		return auth_types.StdTx{}, err
+	}
+	stdTx, ok := decoded.(auth_types.StdTx)
+	if !ok {
+		return auth_types.StdTx{}, sdkerrors.Wrapf(sdkerrors.ErrTxDecode, "unexpected tx type %T", decoded)
+	}
+	if err := stdTx.ValidateBasic(); err != nil {
+		return stdTx, err
+	}
+
+	signers := stdTx.GetSigners()
+	for i, sig := range stdTx.Signatures {
+		acc, ok := n.accounts[signers[i].String()]
+		if !ok {
+			return stdTx, sdkerrors.Wrapf(sdkerrors.ErrUnknownAddress, "account %s does not exist", signers[i])
+		}
+		if sig.PubKey == nil || !sdk.AccAddress(sig.PubKey.Address()).Equals(signers[i]) {
+			return stdTx, sdkerrors.Wrapf(sdkerrors.ErrInvalidPubKey, "pubkey does not match signer %s", signers[i])
+		}
+		signBytes := auth_types.StdSignBytes(n.chainID, acc.AccountNumber, acc.Sequence, stdTx.Fee, stdTx.Msgs, stdTx.Memo)
+		if !sig.PubKey.VerifyBytes(signBytes, sig.Signature) {
+			return stdTx, sdkerrors.Wrap(sdkerrors.ErrUnauthorized, "signature verification failed; verify correct account sequence and chain-id")
+		}
+	}
+	for i, signer := range signers {
+		acc := n.accounts[signer.String()]
+		if acc.PubKey == nil {
+			acc.PubKey = stdTx.Signatures[i].PubKey
+		}
+		acc.Sequence++
+	}
+	return stdTx, nil
+}
+
+// deliverTx runs the messages of the transaction, reverting all of them if any fails.
+func (n *Node) deliverTx(tx auth_types.StdTx) abci.ResponseDeliverTx {
+	res := abci.ResponseDeliverTx{}
+	staged := n.oracle.clone()
+	for i, msg := range tx.Msgs {
+		if err := staged.handle(n.height, msg); err != nil {
+			res.Codespace, res.Code, res.Log = sdkerrors.ABCIInfo(sdkerrors.Wrapf(err, "message %d", i), false)
+			break
+		}
+	}
+	if res.IsOK() {
+		n.oracle = staged
+		res.Log = "[]"
+	}
+	n.txs = append(n.txs, TxResult{Height: n.height, Msgs: tx.Msgs, Code: res.Code, Log: res.Log})
+	return res
+}
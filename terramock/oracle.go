@@ -0,0 +1,187 @@
+package terramock
+
+import (
+	"fmt"
+	"sort"
+
+	sdk "github.com/cosmos/cosmos-sdk/types"
+	sdkerrors "github.com/cosmos/cosmos-sdk/types/errors"
+	"github.com/cosmos/cosmos-sdk/x/staking"
+	terra_types "github.com/terra-project/core/x/oracle"
+)
+
+// oracle simulates the state and message handling of the Terra oracle module.
+type oracle struct {
+	params     terra_types.Params
+	validators map[string]bool
+	delegates  map[string]sdk.AccAddress
+	// prevotes and votes are keyed by denom and validator.
+	prevotes map[string]terra_types.ExchangeRatePrevote
+	votes    map[string]terra_types.ExchangeRateVote
+	tallies  map[int64]terra_types.ExchangeRateVotes
+	// missCounters are the vote periods of the slash window each validator missed.
+	missCounters map[string]int64
+}
+
+func newOracle(params terra_types.Params) *oracle {
+	return &oracle{
+		params:     params,
+		validators: map[string]bool{},
+		delegates:  map[string]sdk.AccAddress{},
+		prevotes:   map[string]terra_types.ExchangeRatePrevote{},
+		votes:      map[string]terra_types.ExchangeRateVote{},
+		tallies:    map[int64]terra_types.ExchangeRateVotes{},
+
+		missCounters: map[string]int64{},
+	}
+}
+
+func voteKey(denom string, val sdk.ValAddress) string {
+	return denom + "/" + val.String()
+}
+
+// clone copies the state so that a transaction can be reverted.
+func (o *oracle) clone() *oracle {
+	c := newOracle(o.params)
+	for k, v := range o.validators {
+		c.validators[k] = v
+	}
+	for k, v := range o.delegates {
+		c.delegates[k] = v
+	}
+	for k, v := range o.prevotes {
+		c.prevotes[k] = v
+	}
+	for k, v := range o.votes {
+		c.votes[k] = v
+	}
+	for k, v := range o.missCounters {
+		c.missCounters[k] = v
+	}
+	c.tallies = o.tallies
+	return c
+}
+
+func (o *oracle) isVoteTarget(denom string) bool {
+	for _, d := range o.params.Whitelist {
+		if d.Name == denom {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFeeder mirrors the permission checks the oracle handler does for every message.
+func (o *oracle) checkFeeder(feeder sdk.AccAddress, val sdk.ValAddress) error {
+	if !feeder.Equals(val) && !o.delegates[val.String()].Equals(feeder) {
+		return sdkerrors.Wrap(terra_types.ErrNoVotingPermission, feeder.String())
+	}
+	if !o.validators[val.String()] {
+		return sdkerrors.Wrap(staking.ErrNoValidatorFound, val.String())
+	}
+	return nil
+}
+
+func (o *oracle) handle(height int64, msg sdk.Msg) error {
+	if err := msg.ValidateBasic(); err != nil {
+		return err
+	}
+	switch msg := msg.(type) {
+	case terra_types.MsgExchangeRatePrevote:
+		if !o.isVoteTarget(msg.Denom) {
+			return sdkerrors.Wrap(terra_types.ErrUnknowDenom, msg.Denom)
+		}
+		if err := o.checkFeeder(msg.Feeder, msg.Validator); err != nil {
+			return err
+		}
+		o.prevotes[voteKey(msg.Denom, msg.Validator)] = terra_types.NewExchangeRatePrevote(msg.Hash, msg.Denom, msg.Validator, height)
+		return nil
+	case terra_types.MsgExchangeRateVote:
+		if err := o.checkFeeder(msg.Feeder, msg.Validator); err != nil {
+			return err
+		}
+		key := voteKey(msg.Denom, msg.Validator)
+		prevote, ok := o.prevotes[key]
+		if !ok {
+			return sdkerrors.Wrap(terra_types.ErrNoPrevote, fmt.Sprintf("(%s, %s)", msg.Validator, msg.Denom))
+		}
+		if height/o.params.VotePeriod-prevote.SubmitBlock/o.params.VotePeriod != 1 {
+			return terra_types.ErrRevealPeriodMissMatch
+		}
+		hash := terra_types.GetVoteHash(msg.Salt, msg.ExchangeRate, msg.Denom, msg.Validator)
+		if !prevote.Hash.Equal(hash) {
+			return sdkerrors.Wrap(terra_types.ErrVerificationFailed, fmt.Sprintf("must be given %s not %s", prevote.Hash, hash))
+		}
+		delete(o.prevotes, key)
+		o.votes[key] = terra_types.NewExchangeRateVote(msg.ExchangeRate, msg.Denom, msg.Validator)
+		return nil
+	default:
+		return sdkerrors.Wrapf(sdkerrors.ErrUnknownRequest, "unrecognized message type: %T", msg)
+	}
+}
+
+// endBlock keeps the votes of a vote period that ends at the height, counts the misses of the
+// validators and clears the ballot like the EndBlocker of the oracle module. Unlike the module,
+// every vote counts as valid, so a validator misses a period only if it did not vote for all
+// denoms of the whitelist.
+func (o *oracle) endBlock(height int64) {
+	if (height+1)%o.params.VotePeriod != 0 {
+		return
+	}
+	votes := o.queryVotes(nil, "")
+	if len(votes) > 0 {
+		o.tallies[height] = votes
+	}
+
+	valid := map[string]int{}
+	for _, vote := range votes {
+		if o.isVoteTarget(vote.Denom) {
+			valid[vote.Voter.String()]++
+		}
+	}
+	for val := range o.validators {
+		if valid[val] != len(o.params.Whitelist) {
+			o.missCounters[val]++
+		}
+	}
+	if (height+1)%o.params.SlashWindow == 0 {
+		o.missCounters = map[string]int64{}
+	}
+
+	o.votes = map[string]terra_types.ExchangeRateVote{}
+	for key, prevote := range o.prevotes {
+		if height > prevote.SubmitBlock+o.params.VotePeriod {
+			delete(o.prevotes, key)
+		}
+	}
+}
+
+// queryPrevotes returns the prevotes of the voter and denom, where empty values match all, in the
+// order of the store.
+func (o *oracle) queryPrevotes(voter sdk.ValAddress, denom string) terra_types.ExchangeRatePrevotes {
+	prevotes := terra_types.ExchangeRatePrevotes{}
+	for _, pv := range o.prevotes {
+		if (voter.Empty() || pv.Voter.Equals(voter)) && (denom == "" || pv.Denom == denom) {
+			prevotes = append(prevotes, pv)
+		}
+	}
+	sort.Slice(prevotes, func(i, j int) bool {
+		return voteKey(prevotes[i].Denom, prevotes[i].Voter) < voteKey(prevotes[j].Denom, prevotes[j].Voter)
+	})
+	return prevotes
+}
+
+// queryVotes returns the votes of the voter and denom, where empty values match all, in the order
+// of the store.
+func (o *oracle) queryVotes(voter sdk.ValAddress, denom string) terra_types.ExchangeRateVotes {
+	votes := terra_types.ExchangeRateVotes{}
+	for _, v := range o.votes {
+		if (voter.Empty() || v.Voter.Equals(voter)) && (denom == "" || v.Denom == denom) {
+			votes = append(votes, v)
+		}
+	}
+	sort.Slice(votes, func(i, j int) bool {
+		return voteKey(votes[i].Denom, votes[i].Voter) < voteKey(votes[j].Denom, votes[j].Voter)
+	})
+	return votes
+}